@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
@@ -38,19 +40,36 @@ var games = []string{
 
 var wagers = []int{50, 100, 150, 200, 300}
 
+const usage = `usage:
+  seed MODE fixed|random|none open|closed
+  seed -scenario FILE [-keep] MODE
+
+MODE is dev, test or prod. Scenario files are json, yaml is not supported.
+
+`
+
+// main seeds the database of MODE, either with the fixed or random
+// sessions of this file or with the sessions of a scenario file:
+//
+//	seed MODE fixed|random|none open|closed
+//	seed -scenario FILE [-keep] MODE
 func main() {
-	if len(os.Args) < 4 {
-		log.Fatal("seed MODE ACTIVE")
+	scenarioFile := flag.String("scenario", "", "seed the scenario of a json `file`")
+	keep := flag.Bool("keep", false, "keep the existing data when seeding a scenario")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
 	}
-	var seedMode string
-	var open bool
-	if len(os.Args) > 3 {
-		seedMode = os.Args[2]
-		open = os.Args[3] == "open"
+	flag.Parse()
+	if !validArgs(*scenarioFile != "") {
+		flag.Usage()
+		os.Exit(2)
 	}
+	seedMode := flag.Arg(1)
+	open := flag.Arg(2) == "open"
 
-	e := env.New()
-	s, err := db.New("sqlite3", e.ConnectionString)
+	e := env.FromMode(flag.Arg(0))
+	s, err := db.Open(e.ConnectionString)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -58,11 +77,18 @@ func main() {
 
 	srv := services.InitServices(s)
 
+	if *scenarioFile != "" {
+		if err = runScenario(s, srv, *scenarioFile, *keep); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	err = s.RunFile("drop")
 	if err != nil {
 		log.Fatal("DROP", err)
 	}
-	err = s.RunFile("schema")
+	err = s.Migrate()
 	if err != nil {
 		log.Fatal("SCHEMA", err)
 	}
@@ -99,14 +125,14 @@ func main() {
 			}
 			gs.after(gsn.ID)
 			if !open || ls || ii < len(ss.gameSessions)-1 {
-				_, err = srv.GSession.End(gsn.ID)
+				_, err = srv.GSession.End(gsn.ID, services.AnyVersion)
 				if err != nil {
 					log.Fatal("GEND", err)
 				}
 			}
 		}
 		if !open || ls {
-			_, err := srv.Session.End(sn.ID)
+			_, err := srv.Session.End(sn.ID, services.AnyVersion)
 			if err != nil {
 				log.Fatal("END", err)
 			}
@@ -114,6 +140,23 @@ func main() {
 	}
 }
 
+// validArgs reports if the arguments are a MODE, followed by the seed
+// and state of the sessions unless a scenario is seeded.
+func validArgs(scenario bool) bool {
+	if scenario {
+		return flag.NArg() == 1
+	}
+	if flag.NArg() != 3 {
+		return false
+	}
+	switch flag.Arg(1) {
+	case "fixed", "random", "none":
+	default:
+		return false
+	}
+	return flag.Arg(2) == "open" || flag.Arg(2) == "closed"
+}
+
 func roll() bool {
 	return rand.Intn(2) > 0
 }
@@ -160,16 +203,16 @@ func randomGameSessions(srv *services.Services, p []db.ID, n int) []seedGameSess
 			gameID: game(),
 			wager:  wager(),
 			after: func(id db.ID) {
-				_, err := srv.GSession.EndRound(id, winner(p))
+				_, err := srv.GSession.EndRound(id, winner(p), services.AnyVersion)
 				if err != nil {
 					log.Fatal("END ROUND", err)
 				}
 				if roll() {
-					_, err = srv.GSession.NewRound(id, wager())
+					_, err = srv.GSession.NewRound(id, wager(), services.AnyVersion)
 					if err != nil {
 						log.Fatal("NEW ROUND", err)
 					}
-					_, err = srv.GSession.EndRound(id, winner(p))
+					_, err = srv.GSession.EndRound(id, winner(p), services.AnyVersion)
 					if err != nil {
 						log.Fatal("END ROUND", err)
 					}
@@ -189,32 +232,32 @@ func fixedSessions(srv *services.Services, open bool) []seedSession {
 					gameID: 2,
 					wager:  200,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
-						srv.GSession.NewRound(id, 400)
-						srv.GSession.EndRound(id, 2)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
+						srv.GSession.NewRound(id, 400, services.AnyVersion)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 3,
 					wager:  400,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
-						srv.GSession.NewRound(id, 200)
-						srv.GSession.EndRound(id, 1)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
+						srv.GSession.NewRound(id, 200, services.AnyVersion)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 1,
 					wager:  100,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 2)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 4,
 					wager:  400,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 3)
+						srv.GSession.EndRound(id, 3, services.AnyVersion)
 					},
 				},
 			},
@@ -226,32 +269,32 @@ func fixedSessions(srv *services.Services, open bool) []seedSession {
 					gameID: 2,
 					wager:  200,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
-						srv.GSession.NewRound(id, 400)
-						srv.GSession.EndRound(id, 2)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
+						srv.GSession.NewRound(id, 400, services.AnyVersion)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 3,
 					wager:  400,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
-						srv.GSession.NewRound(id, 200)
-						srv.GSession.EndRound(id, 1)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
+						srv.GSession.NewRound(id, 200, services.AnyVersion)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 3,
 					wager:  400,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 2)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 4,
 					wager:  800,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 3)
+						srv.GSession.EndRound(id, 3, services.AnyVersion)
 					},
 				},
 			},
@@ -263,16 +306,16 @@ func fixedSessions(srv *services.Services, open bool) []seedSession {
 					gameID: 2,
 					wager:  200,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 2)
-						srv.GSession.NewRound(id, 200)
-						srv.GSession.EndRound(id, 2)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
+						srv.GSession.NewRound(id, 200, services.AnyVersion)
+						srv.GSession.EndRound(id, 2, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 2,
 					wager:  600,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
 					},
 				},
 			},
@@ -284,17 +327,17 @@ func fixedSessions(srv *services.Services, open bool) []seedSession {
 					gameID: 2,
 					wager:  200,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 3)
+						srv.GSession.EndRound(id, 3, services.AnyVersion)
 					},
 				},
 				{
 					gameID: 2,
 					wager:  400,
 					after: func(id db.ID) {
-						srv.GSession.EndRound(id, 1)
-						srv.GSession.NewRound(id, 800)
+						srv.GSession.EndRound(id, 1, services.AnyVersion)
+						srv.GSession.NewRound(id, 800, services.AnyVersion)
 						if !open {
-							srv.GSession.EndRound(id, 3)
+							srv.GSession.EndRound(id, 3, services.AnyVersion)
 						}
 					},
 				},
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/scenario"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+// runScenario seeds the scenario of file into an empty database,
+// or next to the existing data if keep is set.
+func runScenario(s *db.Datastore, srv *services.Services, file string, keep bool) error {
+	if ext := strings.ToLower(filepath.Ext(file)); ext != ".json" {
+		return fmt.Errorf("unsupported scenario format %q, expected .json", ext)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc, err := scenario.Load(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if !keep {
+		if err = s.RunFile("drop"); err != nil {
+			return err
+		}
+		if err = s.Migrate(); err != nil {
+			return err
+		}
+	}
+	if len(sc.Sessions) > 0 && srv.Session.HasActive() {
+		return errvar.ErrHasActiveSession
+	}
+	p := &seeder{s: s, srv: srv, users: map[string]db.ID{}, games: map[string]db.ID{}}
+	if err = p.seedUsers(sc.Users); err != nil {
+		return err
+	}
+	if err = p.seedGames(sc.Games); err != nil {
+		return err
+	}
+	for i, ss := range sc.Sessions {
+		if err = p.seedSession(ss); err != nil {
+			return fmt.Errorf("sessions[%d]: %w", i, err)
+		}
+	}
+	// rounds are played in the order of the scenario, not of its times
+	return srv.Rating.Recompute()
+}
+
+type seeder struct {
+	s     *db.Datastore
+	srv   *services.Services
+	users map[string]db.ID
+	games map[string]db.ID
+}
+
+func (p *seeder) seedUsers(users []scenario.User) error {
+	for _, u := range users {
+		name := strings.ToLower(u.Name)
+		if usr, err := p.srv.User.ByName(name); err == nil {
+			p.users[name] = usr.ID
+			continue
+		}
+		password := u.Password
+		if password == "" {
+			password = scenario.DefaultPassword
+		}
+		h, err := utils.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		if _, err = p.srv.User.Create(name, h); err != nil {
+			return fmt.Errorf("user %q: %w", u.Name, err)
+		}
+	}
+	usrs, err := p.srv.User.All(nil)
+	if err != nil {
+		return err
+	}
+	for _, u := range usrs {
+		p.users[strings.ToLower(u.Name)] = u.ID
+	}
+	return p.srv.Result.UpdateUsers()
+}
+
+func (p *seeder) seedGames(games []string) error {
+	existing, err := p.srv.Game.All(nil)
+	if err != nil {
+		return err
+	}
+	for _, g := range existing {
+		p.games[strings.ToLower(g.Name)] = g.ID
+	}
+	for _, name := range games {
+		if _, ok := p.games[strings.ToLower(name)]; ok {
+			continue
+		}
+		g, err := p.srv.Game.Create(name)
+		if err != nil {
+			return fmt.Errorf("game %q: %w", name, err)
+		}
+		p.games[strings.ToLower(name)] = g.ID
+	}
+	return nil
+}
+
+func (p *seeder) seedSession(ss scenario.Session) error {
+	ids := make([]db.ID, 0, len(ss.Users))
+	for _, name := range ss.Users {
+		id, ok := p.users[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown user %q", name)
+		}
+		ids = append(ids, id)
+	}
+	sn, err := p.srv.Session.Create(ids)
+	if err != nil {
+		return err
+	}
+	for i, g := range ss.Games {
+		if err = p.seedGameSession(sn.ID, g, ss.IsOpen(i)); err != nil {
+			return fmt.Errorf("games[%d]: %w", i, err)
+		}
+	}
+	if !ss.Open {
+		if _, err = p.srv.Session.End(sn.ID, services.AnyVersion); err != nil {
+			return err
+		}
+	}
+	return backdate(p.s, "session", sn.ID, ss.Started, ss.Ended)
+}
+
+func (p *seeder) seedGameSession(sessionID db.ID, g scenario.GameSession, open bool) error {
+	gameID, ok := p.games[strings.ToLower(g.Game)]
+	if !ok {
+		return fmt.Errorf("unknown game %q", g.Game)
+	}
+	gs, err := p.srv.GSession.Create(sessionID, gameID, g.Rounds[0].Wager)
+	if err != nil {
+		return err
+	}
+	for i, r := range g.Rounds {
+		if i > 0 {
+			if _, err = p.srv.GSession.NewRound(gs.ID, r.Wager, services.AnyVersion); err != nil {
+				return err
+			}
+		}
+		if r.Winner == "" {
+			continue
+		}
+		_, err = p.srv.GSession.EndRound(gs.ID, p.users[strings.ToLower(r.Winner)], services.AnyVersion)
+		if err != nil {
+			return fmt.Errorf("rounds[%d]: %w", i, err)
+		}
+	}
+	if !open {
+		if _, err = p.srv.GSession.End(gs.ID, services.AnyVersion); err != nil {
+			return err
+		}
+	}
+	return backdate(p.s, "game_session", gs.ID, g.Started, g.Ended)
+}
+
+// backdate sets the times of a row of table to those of the scenario,
+// times left out keep the time of seeding.
+func backdate(s *db.Datastore, table string, id db.ID, started *time.Time, ended *time.Time) error {
+	if started != nil {
+		_, err := s.Exec(fmt.Sprintf("UPDATE %s SET started = ? WHERE id = ?", table),
+			services.FormatTime(*started), id)
+		if err != nil {
+			return err
+		}
+	}
+	if ended != nil {
+		_, err := s.Exec(fmt.Sprintf("UPDATE %s SET ended = ? WHERE id = ? AND ended IS NOT NULL", table),
+			services.FormatTime(*ended), id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
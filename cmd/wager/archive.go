@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lindeneg/wager/internal/archive"
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/importer"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+// runArchive runs the archive commands, which use the env file of MODE:
+//
+//	wager export [-passwords] [-o FILE] [MODE]
+//	wager import [MODE] FILE
+//	wager import-history [-dry-run] [MODE] FILE
+func runArchive(cmd string, args []string) error {
+	switch cmd {
+	case "export":
+		return exportArchive(args)
+	case "import-history":
+		return importHistory(args)
+	}
+	return importArchive(args)
+}
+
+func exportArchive(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	passwords := fs.Bool("passwords", false, "include password hashes")
+	out := fs.String("o", "", "write the archive to `file` instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wager export [-passwords] [-o FILE] [MODE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	s, ss, err := openServices(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer s.DB.Close()
+	a, err := ss.Archive.Export(*passwords)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+func importArchive(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wager import [MODE] FILE")
+		fmt.Fprintln(fs.Output(), "restores an archive into an empty database, FILE - reads stdin")
+	}
+	fs.Parse(args)
+	mode, r, err := modeAndFile(fs)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var a archive.Archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return err
+	}
+	s, ss, err := openServices(mode)
+	if err != nil {
+		return err
+	}
+	defer s.DB.Close()
+	if err = s.Migrate(); err != nil {
+		return err
+	}
+	if err = ss.Archive.Import(a); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d users, %d games, %d sessions, %d game sessions and %d rounds\n",
+		len(a.Users), len(a.Games), len(a.Sessions), len(a.GameSessions), len(a.Rounds))
+	missing := 0
+	for _, u := range a.Users {
+		if u.Password == "" {
+			missing++
+		}
+	}
+	if missing > 0 {
+		fmt.Fprintf(os.Stderr, "%d users have no password hash and cannot sign in\n", missing)
+	}
+	return nil
+}
+
+func importHistory(args []string) error {
+	fs := flag.NewFlagSet("import-history", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without importing it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wager import-history [-dry-run] [MODE] FILE")
+		fmt.Fprintf(fs.Output(), "creates ended sessions from a csv with the columns %s, FILE - reads stdin\n",
+			strings.Join(importer.Columns, ", "))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	mode, r, err := modeAndFile(fs)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	rows, err := importer.Parse(r)
+	if err != nil {
+		return err
+	}
+	s, ss, err := openServices(mode)
+	if err != nil {
+		return err
+	}
+	defer s.DB.Close()
+	report, err := ss.Archive.ImportHistory(rows, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stderr, report)
+	return nil
+}
+
+// modeAndFile are the optional MODE and the FILE arguments of fs,
+// a FILE of - is stdin.
+func modeAndFile(fs *flag.FlagSet) (string, io.ReadCloser, error) {
+	mode, file := "", fs.Arg(0)
+	if fs.NArg() == 2 {
+		mode, file = fs.Arg(0), fs.Arg(1)
+	}
+	if file == "" || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if file == "-" {
+		return mode, io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(file)
+	return mode, f, err
+}
+
+func openServices(mode string) (*db.Datastore, *services.Services, error) {
+	e := env.FromMode(mode)
+	s, err := db.Open(e.ConnectionString)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, services.InitServices(s), nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"os"
 
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/env"
@@ -12,23 +13,40 @@ import (
 	"github.com/lindeneg/wager/internal/services"
 )
 
+const webhookWorkers = 2
+
 //go:embed public/*
 var publicFS embed.FS
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import" ||
+		os.Args[1] == "import-history") {
+		if err := runArchive(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	e := env.New()
-	s, err := db.New("sqlite3", e.ConnectionString)
+	s, err := db.Open(e.ConnectionString)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer s.DB.Close()
 	if e.Mode == env.ModeTest {
 		fmt.Println("ENV", e)
-		s.RunFile("schema")
+	}
+	if err = s.Migrate(); err != nil {
+		log.Fatal(err)
 	}
 	p, err := fs.Sub(publicFS, "public")
 	if err != nil {
 		log.Fatal(err)
 	}
-	server.New(e, services.InitServices(s), p).Start()
+	ss := services.InitServices(s)
+	ss.Dispatcher.Start(webhookWorkers)
+	err = server.New(e, ss, p).Start()
+	ss.Dispatcher.Stop()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
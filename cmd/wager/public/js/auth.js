@@ -1,15 +1,19 @@
+import "./shared.js";
+
 const http = window.clHttp;
 const { enableBtn, disableBtn } = window.clCommon;
 
 const usernameInput = document.getElementById("username");
 const passwordInput = document.getElementById("password");
 const inviteCodeInput = document.getElementById("invite-code");
+const codeInput = document.getElementById("code");
 const submitBtn = document.getElementById("submit");
 
 const state = {
     username: usernameInput.value ?? "",
     password: passwordInput.value ?? "",
     inviteCode: inviteCodeInput?.value ?? "",
+    code: codeInput?.value ?? "",
     isLogin: window.location.pathname === "/login",
 };
 
@@ -32,6 +36,8 @@ submitBtn.addEventListener("click", async () => {
     if (!state.isLogin) {
         path = "/signup";
         body.inviteCode = state.inviteCode;
+    } else if (state.code) {
+        body.code = state.code;
     }
     http.clearError();
     disableBtn(submitBtn);
@@ -58,5 +64,6 @@ const onInput = ({ target }) => {
 usernameInput.addEventListener("input", onInput);
 passwordInput.addEventListener("input", onInput);
 inviteCodeInput?.addEventListener("input", onInput);
+codeInput?.addEventListener("input", onInput);
 
 checkState();
@@ -1,4 +1,9 @@
-import { tableProps } from "./shared.js";
+import {
+    tableProps,
+    tickLiveDurations,
+    withQuery,
+    listRows,
+} from "./shared.js";
 
 const c = window.clEl;
 const http = window.clHttp;
@@ -7,6 +12,9 @@ const { tempDisable, enableElIf, getNameFromId, strToUser } = window.clCommon;
 const users = Array.from(document.querySelectorAll(".usr-result-box")).map(
     (e) => strToUser(e.id)
 );
+const activeUsers = Array.from(
+    document.querySelectorAll(".usr-result-box:not([data-deactivated])")
+).map((e) => strToUser(e.id));
 
 const beginBtn = document.getElementById("begin-session");
 const newGameBtn = document.getElementById("add-game");
@@ -26,9 +34,9 @@ const ctx = window.clTable.initialize({
     },
     onFetch: async (search) => {
         const disabled = tempDisable(ctx.nextBtn, ctx.prevBtn);
-        const { data } = await http.getJson("/session?" + search);
+        const { data } = await http.getJson("/session?" + withQuery(search));
         disabled.revert();
-        return data.map((e) => {
+        return listRows(search, data).map((e) => {
             return {
                 ...e,
                 sessions: e.gameSessions.length,
@@ -45,6 +53,7 @@ const ctx = window.clTable.initialize({
 });
 
 enableElIf(!ctx.table.active(), beginBtn);
+tickLiveDurations();
 
 const newGameHandler = () => {
     const input = c.input({
@@ -92,7 +101,7 @@ const newSessionHandler = () => {
                     "gap-1",
                     "wrap",
                 ]),
-                ...users.map((usr) =>
+                ...activeUsers.map((usr) =>
                     c.button(
                         { innerText: usr.name },
                         [],
@@ -1,4 +1,12 @@
-import { tableProps, inProgress } from "./shared.js";
+import {
+    tableProps,
+    inProgress,
+    tickLiveDurations,
+    withQuery,
+    listRows,
+    idempotent,
+    ifMatch,
+} from "./shared.js";
 
 const c = window.clEl;
 const http = window.clHttp;
@@ -31,11 +39,19 @@ const ROUND_KIND = {
 
 const sessionId = Number(window.location.pathname.split("/").pop());
 
+// a double-tap sends the same key twice, so the server applies it once
+const pageKey = Math.random().toString(36).slice(2);
+/**
+ * @param {...(string|number)} parts
+ * @returns {string} */
+const actionKey = (...parts) => [pageKey, ...parts].join("-");
+
 const stateEl = document.getElementById("initial-state");
 const activeResultWrapperEl = document.getElementById("active-result-wrapper");
 const activeGameEl = document.getElementById("active-game");
 const activeResultEl = document.getElementById("active-result");
 const activeResultTitleEl = document.getElementById("active-result-title");
+const sessionTitleEl = document.getElementById("session-title");
 const activeGameConfig = document.getElementById("game-config");
 const startGameBtn = document.getElementById("start-game");
 const endGameBtn = document.getElementById("end-game");
@@ -194,6 +210,26 @@ const resultBox = (userId, resultData) => {
     );
 };
 
+/**
+ * Game session state received from events, by game session id.
+ * @type {Record<number, {result: Record<string, any>, rounds: any[]}>} */
+const live = {};
+
+/**
+ * The state of a row, patched with the latest event.
+ * @param {any} row
+ * @returns {Record<string, any>} */
+const gameState = (row) => {
+    const s = row.state();
+    return { ...s, ...live[s.id] };
+};
+
+/**
+ * @param {Record<string, Record<string, number>>} result
+ * @returns {boolean} */
+const resolvedOnce = (result) =>
+    Object.values(result).some((owe) => Object.values(owe).some((v) => v > 0));
+
 /** @param {number} kind */
 const renderSelectedResult = (kind) => {
     let isActive = false;
@@ -211,11 +247,12 @@ const renderSelectedResult = (kind) => {
         isActive = true;
     }
     const currentIdx = Number(roundCountEl.dataset.idx);
-    const rounds = selected.state().rounds;
+    const selectedState = gameState(selected);
+    const rounds = selectedState.rounds;
 
     const getRoundResult = () => {
         if (kind === ROUND_KIND.NEXT && currentIdx === 0) {
-            return [selected.state().result, -1];
+            return [selectedState.result, -1];
         }
         let idx = 0;
         if (currentIdx > -1) {
@@ -231,7 +268,7 @@ const renderSelectedResult = (kind) => {
     let result, idx;
     switch (kind) {
         case ROUND_KIND.TOTAL:
-            [result, idx] = [selected.state().result, -1];
+            [result, idx] = [selectedState.result, -1];
             break;
         case ROUND_KIND.PREV:
         case ROUND_KIND.NEXT:
@@ -247,7 +284,7 @@ const renderSelectedResult = (kind) => {
     const isTotal = idx < 0;
 
     const isActiveRound = isTotal
-        ? inProgress(selected.state().ended)
+        ? inProgress(selectedState.ended)
         : !!rounds[idx].active;
 
     roundCountEl.innerText = createRouteTitle(
@@ -273,7 +310,7 @@ const renderSelectedResult = (kind) => {
     showElIf(isActiveRound && !isTotal, whoWonEl);
     hideEl(startGameBtn);
 
-    gameSelectEl.value = state.gameId[selected.state().game];
+    gameSelectEl.value = state.gameId[selectedState.game];
     wagerInputEl.value = isTotal ? 0 : rounds[idx].wager;
 
     Object.keys(result).forEach((key) => {
@@ -306,16 +343,59 @@ const ctx = window.clTable.initialize({
     onFetch: async (search) => {
         const disabled = tempDisable(ctx.nextBtn, ctx.prevBtn);
         const { data } = await http.getJson(
-            `/game-session/${state.sessionId}?${search}`
+            `/game-session/${state.sessionId}?${withQuery(search)}`
         );
         disabled.revert();
-        return data.map((e) => ({
+        return listRows(search, data).map((e) => ({
             ...e,
             game: state.gameName[e.gameId],
         }));
     },
 });
 
+tickLiveDurations();
+
+/**
+ * Patches the page after a round of the active game session changed,
+ * mirroring the state the page would render with.
+ * @param {any} gs */
+const patchActiveGameSession = (gs) => {
+    const active = ctx.table.active();
+    if (!active || active.state().id !== gs.id) {
+        return window.location.reload();
+    }
+    live[gs.id] = { result: gs.result, rounds: gs.rounds };
+    activeResultTitleEl.dataset.version = gs.version;
+    const roundsEl = active.el.querySelector('td[data-name="rounds"]');
+    if (roundsEl) roundsEl.innerText = gs.rounds.length;
+    const round = gs.rounds.find((r) => r.active);
+    const resolved = resolvedOnce(gs.result);
+    stateEl.innerText = round
+        ? STATE_KIND.ROUND_IN_PROGRESS
+        : STATE_KIND.GAME_IN_PROGRESS;
+    enableElIf(!round, newRoundBtn);
+    enableElIf(!round && resolved, endGameBtn);
+    enableElIf(gs.rounds.length === 1 && !resolved, cancelGameBtn);
+    whoWonBtns.forEach((e) => e.classList.remove("success"));
+    disableBtn(endRoundBtn);
+    const selected = ctx.table.selected();
+    if (selected && selected.state().id !== gs.id) return;
+    roundCountEl.dataset.idx = -1;
+    renderSelectedResult(round ? ROUND_KIND.PREV : ROUND_KIND.TOTAL);
+};
+
+if (!state.is(STATE_KIND.SESSION_ENDED)) {
+    const events = new EventSource(`/api/session/${sessionId}/events`);
+    ["new-round", "end-round"].forEach((kind) => {
+        events.addEventListener(kind, (e) => {
+            patchActiveGameSession(JSON.parse(e.data).gameSession);
+        });
+    });
+    ["create", "end", "cancel"].forEach((kind) => {
+        events.addEventListener(kind, () => window.location.reload());
+    });
+}
+
 [ctx.nextBtn, ctx.prevBtn].forEach((btn) => {
     btn.addEventListener("click", () => {
         const active = ctx.table.active();
@@ -345,6 +425,7 @@ whoWonBtns.forEach((btn) => {
 
 startGameBtn.addEventListener("click", async () => {
     if (!state.is(STATE_KIND.GAME_INACTIVE)) return;
+    idempotent(actionKey("start-game"));
     const { err } = await http.postJson("/game-session", {
         sessionId,
         gameId: Number(gameSelectEl.value),
@@ -358,6 +439,8 @@ endGameBtn.addEventListener("click", async () => {
     if (!state.is(STATE_KIND.GAME_IN_PROGRESS)) return;
     const active = ctx.table.active();
     if (!active) return;
+    idempotent(actionKey("end-game", active.state().id));
+    ifMatch(activeResultTitleEl.dataset.version);
     const { err } = await http.postJson(
         `/game-session/${active.state().id}/end`
     );
@@ -369,6 +452,7 @@ cancelGameBtn.addEventListener("click", async () => {
     if (!state.is(STATE_KIND.ROUND_IN_PROGRESS)) return;
     const active = ctx.table.active();
     if (!active) return;
+    ifMatch(activeResultTitleEl.dataset.version);
     const { err } = await http.delete(`/game-session/${active.state().id}`);
     if (err) return;
     window.location.reload();
@@ -379,6 +463,9 @@ newRoundBtn.addEventListener("click", async () => {
     const active = ctx.table.active();
     if (!active) return;
     const id = active.state().id;
+    const round = gameState(active).rounds.length;
+    idempotent(actionKey("new-round", id, round));
+    ifMatch(activeResultTitleEl.dataset.version);
     const { err } = await http.postJson(`/game-session/${id}/new-round`, {
         id,
         wager: Number(wagerInputEl.value),
@@ -392,6 +479,9 @@ endRoundBtn.addEventListener("click", async () => {
     const active = ctx.table.active();
     if (!active) return;
     const id = active.state().id;
+    const round = gameState(active).rounds.length;
+    idempotent(actionKey("end-round", id, round));
+    ifMatch(activeResultTitleEl.dataset.version);
     const { err } = await http.postJson(`/game-session/${id}/end-round`, {
         id,
         winnerId: winnerId(),
@@ -402,6 +492,8 @@ endRoundBtn.addEventListener("click", async () => {
 
 endSessionBtn.addEventListener("click", async () => {
     if (!state.is(STATE_KIND.GAME_INACTIVE)) return;
+    idempotent(actionKey("end-session"));
+    ifMatch(sessionTitleEl.dataset.version);
     const { err } = await http.postJson(`/session/${sessionId}/end`);
     if (err) return;
     window.location.reload();
@@ -409,6 +501,7 @@ endSessionBtn.addEventListener("click", async () => {
 
 cancelSessionBtn.addEventListener("click", async () => {
     if (!state.is(STATE_KIND.GAME_INACTIVE) || ctx.hasData()) return;
+    ifMatch(sessionTitleEl.dataset.version);
     const { err } = await http.delete(`/session/${sessionId}`);
     if (err) return;
     window.location.assign("/");
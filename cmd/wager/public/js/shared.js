@@ -1,12 +1,129 @@
-const { durationInMins } = window.clCommon;
-
 const IN_PROGRESS_VALS = [null, "<nil>", "In Progress"];
+const SAFE_METHODS = ["GET", "HEAD", "OPTIONS"];
+const CSRF_HEADER = "X-CSRF-Token";
+const IDEMPOTENCY_HEADER = "Idempotency-Key";
+
+const csrfToken =
+    document.querySelector('meta[name="csrf-token"]')?.content ?? "";
+
+const nativeFetch = window.fetch.bind(window);
+
+/** Headers of the next state-changing request. */
+let pending = new Headers();
+
+/**
+ * Sends key as the Idempotency-Key of the next state-changing request,
+ * so repeating an action from the same page state only applies it once.
+ * @param {string} key */
+export const idempotent = (key) => {
+    pending.set(IDEMPOTENCY_HEADER, key);
+};
+
+/**
+ * Makes the next state-changing request fail if the resource is no
+ * longer at version, e.g. because someone else changed it meanwhile.
+ * @param {number | string} version */
+export const ifMatch = (version) => {
+    pending.set("If-Match", `"${version}"`);
+};
+
+/**
+ * Attaches the csrf token and pending headers to every
+ * state-changing same-origin request.
+ * @param {RequestInfo | URL} input
+ * @param {RequestInit} [init]
+ * @returns {Promise<Response>} */
+window.fetch = (input, init = {}) => {
+    const req = input instanceof Request ? input : null;
+    const method = (init.method ?? req?.method ?? "GET").toUpperCase();
+    const url = new URL(req?.url ?? String(input), window.location.href);
+    if (
+        SAFE_METHODS.includes(method) ||
+        url.origin !== window.location.origin
+    ) {
+        return nativeFetch(input, init);
+    }
+    const headers = new Headers(init.headers ?? req?.headers);
+    if (csrfToken) headers.set(CSRF_HEADER, csrfToken);
+    pending.forEach((v, k) => headers.set(k, v));
+    pending = new Headers();
+    return nativeFetch(input, { ...init, headers });
+};
 
 /**
  * @param {unknown} v
  * @returns {boolean} */
 export const inProgress = (v) => IN_PROGRESS_VALS.includes(v);
 
+/**
+ * Formats like time.Duration.String() for whole seconds, e.g. 1h2m3s.
+ * @param {number} ms
+ * @returns {string} */
+export const formatDuration = (ms) => {
+    const total = Math.max(Math.round(ms / 1000), 0);
+    const h = Math.floor(total / 3600);
+    const m = Math.floor((total % 3600) / 60);
+    const s = total % 60;
+    if (h > 0) return `${h}h${m}m${s}s`;
+    if (m > 0) return `${m}m${s}s`;
+    return `${s}s`;
+};
+
+/**
+ * Keeps the duration of elements with a data-live start time ticking.
+ * For table rows the duration cell is updated. */
+export const tickLiveDurations = () => {
+    setInterval(() => {
+        const now = Date.now();
+        document.querySelectorAll("[data-live]").forEach((el) => {
+            const target =
+                el.tagName === "TR"
+                    ? el.querySelector('td[data-name="duration"]')
+                    : el;
+            if (!target) return;
+            target.innerText = formatDuration(
+                now - Date.parse(el.dataset.live)
+            );
+        });
+    }, 1000);
+};
+
+/**
+ * Adds the sort and filters of the current page to a table search.
+ * @param {string} search
+ * @returns {string} */
+export const withQuery = (search) => {
+    const params = new URLSearchParams(search);
+    new URLSearchParams(window.location.search).forEach((v, k) => {
+        if (!params.has(k)) params.set(k, v);
+    });
+    return params.toString();
+};
+
+/**
+ * The rows of a list response, with the active row on top of the first page.
+ * @template T
+ * @param {string} search
+ * @param {{data: T[], active?: T}} list
+ * @returns {T[]} */
+export const listRows = (search, list) => {
+    const offset = Number(new URLSearchParams(search).get("offset"));
+    const { active, data } = list;
+    if (!active || offset > 0 || data.some((e) => e.id === active.id)) {
+        return data;
+    }
+    return [active, ...data];
+};
+
+const sortSelect = document.getElementById("sort-select");
+
+sortSelect?.addEventListener("change", () => {
+    const params = new URLSearchParams(window.location.search);
+    params.set("sort", sortSelect.value);
+    params.delete("offset");
+    window.location.search = params.toString();
+});
+
 /** @type {import("./globals").TableConfig} */
 export const tableProps = {
     id: "session-table",
@@ -21,11 +138,20 @@ export const tableProps = {
                     return "In Progress";
                 }
                 return new Date(val).toLocaleString();
-            case "duration":
-                if (inProgress(data["ended"])) {
-                    return "-";
+            case "duration": {
+                const started = Date.parse(data["started"]);
+                const active = inProgress(data["ended"]);
+                const ms =
+                    (active ? Date.now() : Date.parse(data["ended"])) -
+                    started;
+                if (Number.isNaN(ms)) return val;
+                if (active) {
+                    row.el.dataset.live = data["started"];
+                } else {
+                    delete row.el.dataset.live;
                 }
-                return durationInMins(data["started"], data["ended"]);
+                return formatDuration(ms);
+            }
             case "rounds":
                 if (Array.isArray(val)) return val.length;
                 return val;
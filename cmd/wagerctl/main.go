@@ -0,0 +1,350 @@
+// Command wagerctl administers a wager database with the env file of MODE:
+//
+//	wagerctl [-mode MODE] user list|add NAME|rename ID NAME|password ID|deactivate ID|activate ID
+//	wagerctl [-mode MODE] game list|add NAME|rename ID NAME
+//	wagerctl [-mode MODE] session list|end ID|cancel ID
+//	wagerctl [-mode MODE] balances
+//	wagerctl [-mode MODE] recompute
+//
+// Passwords are read from the first line of stdin.
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/export"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+const usage = `usage: wagerctl [-mode MODE] COMMAND
+
+commands:
+  user list
+  user add NAME                 reads the password from stdin
+  user rename ID NAME
+  user password ID              reads the password from stdin
+  user deactivate ID
+  user activate ID
+  game list
+  game add NAME
+  game rename ID NAME
+  session list
+  session end ID                ends a stuck session, dropping its active round
+  session cancel ID             deletes an active session and its game sessions
+  balances                      prints the ledger
+  recompute                     rebuilds the ledger and ratings from ended sessions
+`
+
+var errUsage = errors.New("invalid arguments")
+
+type ctl struct {
+	s  *services.Services
+	tw *tabwriter.Writer
+}
+
+func main() {
+	fs := flag.NewFlagSet("wagerctl", flag.ExitOnError)
+	mode := fs.String("mode", "", "use the env file of `mode` (test, dev or prod)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	e := env.FromMode(*mode)
+	s, err := db.Open(e.ConnectionString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.DB.Close()
+	c := ctl{s: services.InitServices(s), tw: tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)}
+	err = c.run(fs.Args())
+	c.tw.Flush()
+	if err == errUsage {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (c ctl) run(args []string) error {
+	cmd, sub, rest := args[0], "", []string{}
+	if len(args) > 1 {
+		sub, rest = args[1], args[2:]
+	}
+	switch cmd {
+	case "user":
+		return c.user(sub, rest)
+	case "game":
+		return c.game(sub, rest)
+	case "session":
+		return c.session(sub, rest)
+	case "balances":
+		return c.balances()
+	case "recompute":
+		return c.recompute()
+	}
+	return errUsage
+}
+
+func (c ctl) user(sub string, args []string) error {
+	switch {
+	case sub == "list":
+		usrs, err := c.s.User.All(nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.tw, "ID\tNAME\tDEACTIVATED")
+		for _, u := range usrs {
+			deactivated := ""
+			if u.Deactivated != nil {
+				deactivated = u.Deactivated.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(c.tw, "%d\t%s\t%s\n", u.ID, u.Name, deactivated)
+		}
+		return nil
+	case sub == "add" && len(args) == 1:
+		name := strings.ToLower(args[0])
+		if err := utils.ValidateUsername(name); err != nil {
+			return err
+		}
+		hash, err := readPassword()
+		if err != nil {
+			return err
+		}
+		usr, err := c.s.User.Create(name, hash)
+		if err != nil {
+			return err
+		}
+		if err = c.s.Result.UpdateUsers(); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.tw, "created user %d %s\n", usr.ID, usr.Name)
+		return nil
+	case sub == "rename" && len(args) == 2:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(args[1])
+		if err = utils.ValidateUsername(name); err != nil {
+			return err
+		}
+		return c.s.User.Rename(id, name)
+	case sub == "password" && len(args) == 1:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		hash, err := readPassword()
+		if err != nil {
+			return err
+		}
+		return c.s.User.SetPassword(id, hash)
+	case sub == "deactivate" && len(args) == 1:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		return c.s.User.Deactivate(id)
+	case sub == "activate" && len(args) == 1:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		return c.s.User.Reactivate(id)
+	}
+	return errUsage
+}
+
+func (c ctl) game(sub string, args []string) error {
+	switch {
+	case sub == "list":
+		games, err := c.s.Game.All(nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.tw, "ID\tNAME")
+		for _, g := range games {
+			fmt.Fprintf(c.tw, "%d\t%s\n", g.ID, g.Name)
+		}
+		return nil
+	case sub == "add" && len(args) == 1:
+		g, err := c.s.Game.Create(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.tw, "created game %d %s\n", g.ID, g.Name)
+		return nil
+	case sub == "rename" && len(args) == 2:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		return c.s.Game.Rename(id, args[1])
+	}
+	return errUsage
+}
+
+func (c ctl) session(sub string, args []string) error {
+	if sub == "list" {
+		return c.sessions()
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "end":
+		return c.endSession(id)
+	case "cancel":
+		if err = c.s.Session.Cancel(id, services.AnyVersion); err != nil {
+			return err
+		}
+		return c.s.Rating.Recompute()
+	}
+	return errUsage
+}
+
+func (c ctl) sessions() error {
+	spec, err := services.SessionQuery.Parse(url.Values{"state": {"all"}}, nil)
+	if err != nil {
+		return err
+	}
+	ss, err := c.s.Session.AllWithSessions(spec)
+	if err != nil {
+		return err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.tw, "ID\tUSERS\tGAMES\tSTARTED\tENDED")
+	for _, s := range ss {
+		names := make([]string, 0, len(s.Users))
+		for _, id := range s.Users {
+			names = append(names, userName(id, usrs))
+		}
+		ended := "active"
+		if s.Ended != nil {
+			ended = s.Ended.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(c.tw, "%d\t%s\t%d\t%s\t%s\n", s.ID, strings.Join(names, ", "),
+			len(s.GameSessions), s.Started.Local().Format("2006-01-02 15:04"), ended)
+	}
+	return nil
+}
+
+// endSession ends the active game session of a session, dropping its
+// active round, or cancels it if no round has ended, then ends the session.
+func (c ctl) endSession(id db.ID) error {
+	gs, err := c.s.GSession.ActiveFromSession(id)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		if _, idx := gs.Rounds.Active(); idx > -1 {
+			if gs, err = c.s.GSession.DropRound(gs.ID, services.AnyVersion); err != nil {
+				return err
+			}
+		}
+		if len(gs.Rounds) == 0 {
+			err = c.s.GSession.Cancel(gs.ID, services.AnyVersion)
+		} else {
+			_, err = c.s.GSession.End(gs.ID, services.AnyVersion)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	ss, err := c.s.Session.End(id, services.AnyVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.tw, "ended session %d with %d game sessions\n", ss.ID, len(ss.GameSessions))
+	return nil
+}
+
+func (c ctl) balances() error {
+	rm, err := c.s.Result.Current()
+	if err != nil {
+		return err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return err
+	}
+	return c.table(export.Balances(rm, usrs))
+}
+
+func (c ctl) recompute() error {
+	if _, err := c.s.Result.Recompute(); err != nil {
+		return err
+	}
+	if err := c.s.Rating.Recompute(); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.tw, "recomputed the ledger and ratings")
+	return c.balances()
+}
+
+func (c ctl) table(rows [][]string) error {
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(c.tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" && err != nil {
+		return "", err
+	}
+	if len(password) < 8 {
+		return "", errors.New("password must be minimum 8 characters")
+	}
+	return utils.HashPassword(password)
+}
+
+func parseID(s string) (db.ID, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid id %q", s)
+	}
+	return db.ID(id), nil
+}
+
+func userName(id db.ID, usrs []services.User) string {
+	for _, u := range usrs {
+		if u.ID == id {
+			return u.Name
+		}
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,301 @@
+// Package archive is the format of full database backups,
+// and checks that an archive is consistent before it is restored.
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// Version is the version of archives written by this build,
+// archives of other versions are refused.
+const Version = 1
+
+// Archive holds every row needed to restore the history of a database.
+// Two-factor secrets, ratings, webhooks and idempotency keys are left out,
+// ratings are recomputed from the rounds after a restore.
+type Archive struct {
+	Version      int              `json:"version"`
+	Exported     time.Time        `json:"exported"`
+	Users        []User           `json:"users"`
+	Games        []Game           `json:"games"`
+	Sessions     []Session        `json:"sessions"`
+	Participants []Participant    `json:"participants"`
+	GameSessions []GameSession    `json:"gameSessions"`
+	Rounds       []Round          `json:"rounds"`
+	Ledger       result.ResultMap `json:"ledger"`
+	Events       []Event          `json:"events"`
+}
+
+type User struct {
+	ID   db.ID  `json:"id"`
+	Name string `json:"name"`
+	// Password is the password hash, only exported on request.
+	Password    string     `json:"password,omitempty"`
+	Deactivated *time.Time `json:"deactivated,omitempty"`
+}
+
+type Game struct {
+	ID   db.ID  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Session struct {
+	ID      db.ID            `json:"id"`
+	Result  result.ResultMap `json:"result"`
+	Started time.Time        `json:"started"`
+	Ended   *time.Time       `json:"ended"`
+	Version int              `json:"version"`
+}
+
+type Participant struct {
+	ID        db.ID `json:"id"`
+	UserID    db.ID `json:"userId"`
+	SessionID db.ID `json:"sessionId"`
+}
+
+type GameSession struct {
+	ID        db.ID            `json:"id"`
+	SessionID db.ID            `json:"sessionId"`
+	GameID    db.ID            `json:"gameId"`
+	Result    result.ResultMap `json:"result"`
+	Started   time.Time        `json:"started"`
+	Ended     *time.Time       `json:"ended"`
+	Version   int              `json:"version"`
+}
+
+type Round struct {
+	ID            db.ID            `json:"id"`
+	GameSessionID db.ID            `json:"gameSessionId"`
+	Round         int              `json:"round"`
+	Wager         int              `json:"wager"`
+	Active        int              `json:"active"`
+	Result        result.ResultMap `json:"result"`
+	Version       int              `json:"version"`
+}
+
+type Event struct {
+	ID          db.ID     `json:"id"`
+	UserID      *db.ID    `json:"userId"`
+	Description string    `json:"description"`
+	Occured     time.Time `json:"occured"`
+}
+
+// Validate reports every reference to a missing row and every result
+// that does not add up. The result of a game session must net the same
+// as its rounds, a session as its ended game sessions and the ledger as
+// the ended sessions.
+func (a Archive) Validate() error {
+	if a.Version != Version {
+		return fmt.Errorf("unsupported archive version %d, expected %d", a.Version, Version)
+	}
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	users := map[db.ID]bool{}
+	names := map[string]bool{}
+	for _, u := range a.Users {
+		if users[u.ID] {
+			fail("user %d is duplicated", u.ID)
+		}
+		if names[u.Name] {
+			fail("user name %q is duplicated", u.Name)
+		}
+		users[u.ID] = true
+		names[u.Name] = true
+	}
+	games := map[db.ID]bool{}
+	names = map[string]bool{}
+	for _, g := range a.Games {
+		if games[g.ID] {
+			fail("game %d is duplicated", g.ID)
+		}
+		if names[g.Name] {
+			fail("game name %q is duplicated", g.Name)
+		}
+		games[g.ID] = true
+		names[g.Name] = true
+	}
+
+	sessions := map[db.ID]Session{}
+	active := 0
+	for _, s := range a.Sessions {
+		if _, ok := sessions[s.ID]; ok {
+			fail("session %d is duplicated", s.ID)
+		}
+		if s.Ended == nil {
+			active++
+		}
+		sessions[s.ID] = s
+	}
+	if active > 1 {
+		fail("%d sessions are active, expected at most 1", active)
+	}
+	participants := map[db.ID]map[db.ID]bool{}
+	for _, p := range a.Participants {
+		if !users[p.UserID] {
+			fail("participant %d references missing user %d", p.ID, p.UserID)
+		}
+		if _, ok := sessions[p.SessionID]; !ok {
+			fail("participant %d references missing session %d", p.ID, p.SessionID)
+			continue
+		}
+		if participants[p.SessionID] == nil {
+			participants[p.SessionID] = map[db.ID]bool{}
+		}
+		if participants[p.SessionID][p.UserID] {
+			fail("user %d participates in session %d twice", p.UserID, p.SessionID)
+		}
+		participants[p.SessionID][p.UserID] = true
+	}
+
+	gameSessions := map[db.ID]GameSession{}
+	activeGames := map[db.ID]int{}
+	for _, gs := range a.GameSessions {
+		if _, ok := gameSessions[gs.ID]; ok {
+			fail("game session %d is duplicated", gs.ID)
+		}
+		gameSessions[gs.ID] = gs
+		if !games[gs.GameID] {
+			fail("game session %d references missing game %d", gs.ID, gs.GameID)
+		}
+		s, ok := sessions[gs.SessionID]
+		if !ok {
+			fail("game session %d references missing session %d", gs.ID, gs.SessionID)
+			continue
+		}
+		if gs.Ended == nil {
+			if s.Ended != nil {
+				fail("game session %d is active in ended session %d", gs.ID, s.ID)
+			}
+			activeGames[s.ID]++
+		}
+	}
+	for id, n := range activeGames {
+		if n > 1 {
+			fail("session %d has %d active game sessions, expected at most 1", id, n)
+		}
+	}
+
+	rounds := map[db.ID]bool{}
+	activeRounds := map[db.ID]int{}
+	for _, r := range a.Rounds {
+		if rounds[r.ID] {
+			fail("round %d is duplicated", r.ID)
+		}
+		rounds[r.ID] = true
+		gs, ok := gameSessions[r.GameSessionID]
+		if !ok {
+			fail("round %d references missing game session %d", r.ID, r.GameSessionID)
+			continue
+		}
+		if r.Active == 1 {
+			if gs.Ended != nil {
+				fail("round %d is active in ended game session %d", r.ID, gs.ID)
+			}
+			activeRounds[gs.ID]++
+		}
+	}
+	for id, n := range activeRounds {
+		if n > 1 {
+			fail("game session %d has %d active rounds, expected at most 1", id, n)
+		}
+	}
+
+	for _, e := range a.Events {
+		if e.UserID != nil && !users[*e.UserID] {
+			fail("event %d references missing user %d", e.ID, *e.UserID)
+		}
+	}
+	for id := range a.Ledger {
+		if !users[id] {
+			fail("ledger references missing user %d", id)
+		}
+	}
+	for _, s := range a.Sessions {
+		for id := range s.Result {
+			if !participants[s.ID][id] {
+				fail("session %d result references user %d, who did not participate", s.ID, id)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return a.balance()
+}
+
+// balance recomputes every result from the results it was merged from.
+func (a Archive) balance() error {
+	var errs []error
+	rounds := map[db.ID][]result.ResultMap{}
+	for _, r := range a.Rounds {
+		rounds[r.GameSessionID] = append(rounds[r.GameSessionID], r.Result)
+	}
+	games := map[db.ID][]result.ResultMap{}
+	for _, gs := range a.GameSessions {
+		errs = append(errs, compare(
+			fmt.Sprintf("game session %d", gs.ID), "its rounds", gs.Result, rounds[gs.ID]))
+		if gs.Ended != nil {
+			games[gs.SessionID] = append(games[gs.SessionID], gs.Result)
+		}
+	}
+	var sessions []result.ResultMap
+	for _, s := range a.Sessions {
+		errs = append(errs, compare(
+			fmt.Sprintf("session %d", s.ID), "its ended game sessions", s.Result, games[s.ID]))
+		if s.Ended != nil {
+			sessions = append(sessions, s.Result)
+		}
+	}
+	errs = append(errs, compare("ledger", "the ended sessions", a.Ledger, sessions))
+	return errors.Join(errs...)
+}
+
+// compare fails if r does not net every user the same as parts together.
+func compare(name string, partsName string, r result.ResultMap, parts []result.ResultMap) error {
+	want := Nets(parts...)
+	got := Nets(r)
+	var errs []error
+	for _, id := range union(want, got) {
+		if got[id] != want[id] {
+			errs = append(errs, fmt.Errorf(
+				"%s nets user %d %d, but %s net %d", name, id, got[id], partsName, want[id]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Nets is what every user in results is owed in total, minus what they owe.
+func Nets(results ...result.ResultMap) map[db.ID]int {
+	nets := map[db.ID]int{}
+	for _, r := range results {
+		for id := range r {
+			nets[id] += r.Net(id)
+		}
+	}
+	return nets
+}
+
+// union is the sorted keys of a and b.
+func union(a map[db.ID]int, b map[db.ID]int) []db.ID {
+	ids := make([]db.ID, 0, len(a))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+func owes(n int) result.ResultMap {
+	return result.ResultMap{1: {2: 0}, 2: {1: n}}
+}
+
+func userID(id db.ID) *db.ID {
+	return &id
+}
+
+func validArchive() Archive {
+	t := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return Archive{
+		Version:      Version,
+		Users:        []User{{ID: 1, Name: "miles"}, {ID: 2, Name: "bill"}},
+		Games:        []Game{{ID: 1, Name: "Golf"}},
+		Sessions:     []Session{{ID: 1, Result: owes(150), Started: t, Ended: &t, Version: 2}},
+		Participants: []Participant{{ID: 1, UserID: 1, SessionID: 1}, {ID: 2, UserID: 2, SessionID: 1}},
+		GameSessions: []GameSession{
+			{ID: 1, SessionID: 1, GameID: 1, Result: owes(150), Started: t, Ended: &t, Version: 4},
+		},
+		Rounds: []Round{
+			{ID: 1, GameSessionID: 1, Round: 1, Wager: 100, Result: owes(100), Version: 2},
+			{ID: 2, GameSessionID: 1, Round: 2, Wager: 50, Result: owes(50), Version: 2},
+		},
+		Ledger: owes(150),
+		Events: []Event{
+			{ID: 1, UserID: userID(1), Description: "signed up", Occured: t},
+			{ID: 2, Description: "failed login attempt for unknown user \"jim\"", Occured: t},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("accepts a consistent archive", func(t *testing.T) {
+		assertNoError(t, validArchive().Validate())
+	})
+
+	t.Run("refuses other versions", func(t *testing.T) {
+		a := validArchive()
+		a.Version = Version + 1
+		assertErrContains(t, a.Validate(), "unsupported archive version")
+	})
+
+	t.Run("reports missing references", func(t *testing.T) {
+		a := validArchive()
+		a.Participants[1].UserID = 3
+		a.Rounds[0].GameSessionID = 2
+		a.Events[0].UserID = userID(4)
+		err := a.Validate()
+		assertErrContains(t, err, "participant 2 references missing user 3")
+		assertErrContains(t, err, "round 1 references missing game session 2")
+		assertErrContains(t, err, "event 1 references missing user 4")
+	})
+
+	t.Run("reports duplicates", func(t *testing.T) {
+		a := validArchive()
+		a.Games = append(a.Games, Game{ID: 1, Name: "Golf"})
+		err := a.Validate()
+		assertErrContains(t, err, "game 1 is duplicated")
+		assertErrContains(t, err, `game name "Golf" is duplicated`)
+	})
+
+	t.Run("reports active rows in ended parents", func(t *testing.T) {
+		a := validArchive()
+		a.Rounds[1].Active = 1
+		assertErrContains(t, a.Validate(), "round 2 is active in ended game session 1")
+	})
+
+	t.Run("reports results that do not add up", func(t *testing.T) {
+		a := validArchive()
+		a.GameSessions[0].Result = owes(200)
+		err := a.Validate()
+		assertErrContains(t, err, "game session 1 nets user 1 200, but its rounds net 150")
+		assertErrContains(t, err, "session 1 nets user 1 150, but its ended game sessions net 200")
+	})
+
+	t.Run("only counts ended sessions in the ledger", func(t *testing.T) {
+		a := validArchive()
+		a.Sessions[0].Ended = nil
+		a.GameSessions[0].Ended = nil
+		a.Sessions[0].Result = owes(0)
+		assertErrContains(t, a.Validate(), "ledger nets user 1 150, but the ended sessions net 0")
+	})
+}
+
+func TestNets(t *testing.T) {
+	t.Run("sums the net of every result", func(t *testing.T) {
+		got := Nets(owes(100), result.ResultMap{1: {2: 30}, 2: {1: 0}})
+		if got[1] != 70 || got[2] != -70 {
+			t.Errorf("got %v want map[1:70 2:-70]", got)
+		}
+	})
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertErrContains(t testing.TB, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("got no error, want %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want it to contain %q", err, want)
+	}
+}
@@ -0,0 +1,162 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+var Palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2",
+	"#59a14f", "#edc948", "#b07aa1", "#ff9da7",
+}
+
+type Series struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+// Line is a line chart where every series shares the same x positions.
+type Line struct {
+	Width  int
+	Height int
+	Labels []string
+	Series []Series
+}
+
+const (
+	padLeft   = 56
+	padRight  = 16
+	padTop    = 16
+	padBottom = 40
+	legendRow = 18
+	fontSize  = 12
+	textColor = "#eee"
+	gridColor = "#444"
+)
+
+func (l Line) points() int {
+	n := 0
+	for _, s := range l.Series {
+		if len(s.Values) > n {
+			n = len(s.Values)
+		}
+	}
+	return n
+}
+
+func (l Line) bounds() (float64, float64) {
+	lo, hi := 0.0, 0.0
+	for _, s := range l.Series {
+		for _, v := range s.Values {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+	if lo == hi {
+		hi = lo + 1
+	}
+	return lo, hi
+}
+
+// SVG renders the chart as a standalone svg element.
+// Every user supplied string is escaped.
+func (l Line) SVG() string {
+	var b strings.Builder
+	legend := legendRow * len(l.Series)
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="monospace" font-size="%d">`,
+		l.Width, l.Height+legend, l.Width, l.Height+legend, fontSize)
+	n := l.points()
+	if n == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s" text-anchor="middle">No data</text></svg>`,
+			l.Width/2, l.Height/2, textColor)
+		return b.String()
+	}
+	lo, hi := l.bounds()
+	plotW := float64(l.Width - padLeft - padRight)
+	plotH := float64(l.Height - padTop - padBottom)
+	x := func(i int) float64 {
+		if n == 1 {
+			return padLeft + plotW/2
+		}
+		return padLeft + plotW*float64(i)/float64(n-1)
+	}
+	y := func(v float64) float64 {
+		return padTop + plotH*(hi-v)/(hi-lo)
+	}
+	for _, v := range []float64{hi, (hi + lo) / 2, lo} {
+		fmt.Fprintf(&b,
+			`<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" stroke-dasharray="2,4"/>`,
+			padLeft, y(v), l.Width-padRight, y(v), gridColor)
+		fmt.Fprintf(&b,
+			`<text x="%d" y="%.1f" fill="%s" text-anchor="end" dominant-baseline="middle">%s</text>`,
+			padLeft-6, y(v), textColor, formatValue(v))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s"/>`,
+		padLeft, y(0), l.Width-padRight, y(0), textColor)
+	if len(l.Labels) > 0 {
+		for _, i := range labelIndexes(len(l.Labels), n) {
+			fmt.Fprintf(&b,
+				`<text x="%.1f" y="%d" fill="%s" text-anchor="middle">%s</text>`,
+				x(i), l.Height-padBottom+fontSize+8, textColor, html.EscapeString(l.Labels[i]))
+		}
+	}
+	for i, s := range l.Series {
+		color := s.Color
+		if color == "" {
+			color = Palette[i%len(Palette)]
+		}
+		pts := make([]string, len(s.Values))
+		for j, v := range s.Values {
+			pts[j] = fmt.Sprintf("%.1f,%.1f", x(j), y(v))
+		}
+		fmt.Fprintf(&b,
+			`<polyline fill="none" stroke="%s" stroke-width="2" points="%s"><title>%s</title></polyline>`,
+			html.EscapeString(color), strings.Join(pts, " "), html.EscapeString(s.Name))
+		ly := l.Height + legendRow*i + legendRow/2
+		fmt.Fprintf(&b,
+			`<rect x="%d" y="%d" width="12" height="4" fill="%s"/>`,
+			padLeft, ly-2, html.EscapeString(color))
+		fmt.Fprintf(&b,
+			`<text x="%d" y="%d" fill="%s" dominant-baseline="middle">%s</text>`,
+			padLeft+18, ly, textColor, html.EscapeString(s.Name))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+func (l Line) HTML() template.HTML {
+	return template.HTML(l.SVG())
+}
+
+// labelIndexes picks at most a handful of evenly spaced labels so they do not overlap.
+func labelIndexes(labels int, points int) []int {
+	n := labels
+	if points < n {
+		n = points
+	}
+	const max = 6
+	if n <= max {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+	idx := make([]int, max)
+	for i := range idx {
+		idx[i] = int(math.Round(float64(i) * float64(n-1) / float64(max-1)))
+	}
+	return idx
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.1f", v)
+}
@@ -0,0 +1,61 @@
+package chart
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineSVG(t *testing.T) {
+	t.Run("renders placeholder without data", func(t *testing.T) {
+		got := Line{Width: 200, Height: 100}.SVG()
+		assertContains(t, got, "No data")
+		assertContains(t, got, "</svg>")
+	})
+
+	t.Run("renders a polyline per series", func(t *testing.T) {
+		got := Line{
+			Width:  216,
+			Height: 156,
+			Labels: []string{"a", "b", "c"},
+			Series: []Series{
+				{Name: "miles", Values: []float64{0, 50, 100}},
+				{Name: "bill", Values: []float64{0, -50, -100}},
+			},
+		}.SVG()
+		if n := strings.Count(got, "<polyline"); n != 2 {
+			t.Errorf("got %d polylines want 2", n)
+		}
+		assertContains(t, got, `points="56.0,66.0 128.0,41.0 200.0,16.0"`)
+		assertContains(t, got, `points="56.0,66.0 128.0,91.0 200.0,116.0"`)
+		assertContains(t, got, ">100<")
+		assertContains(t, got, ">-100<")
+	})
+
+	t.Run("escapes names and labels", func(t *testing.T) {
+		got := Line{
+			Width:  200,
+			Height: 100,
+			Labels: []string{"<b>"},
+			Series: []Series{{Name: "<script>", Values: []float64{1}}},
+		}.SVG()
+		if strings.Contains(got, "<script>") || strings.Contains(got, "<b>") {
+			t.Errorf("expected names to be escaped, got %s", got)
+		}
+	})
+}
+
+func TestLabelIndexes(t *testing.T) {
+	t.Run("spreads labels evenly", func(t *testing.T) {
+		got := labelIndexes(11, 11)
+		if len(got) != 6 || got[0] != 0 || got[5] != 10 {
+			t.Errorf("unexpected indexes %v", got)
+		}
+	})
+}
+
+func assertContains(t testing.TB, got string, expected string) {
+	t.Helper()
+	if !strings.Contains(got, expected) {
+		t.Errorf("expected %q in %q", expected, got)
+	}
+}
@@ -3,10 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"path"
+	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
 type ID uint
@@ -15,14 +18,84 @@ func (id ID) ResultID() ID {
 	return id
 }
 
+// Dialect is the flavour of SQL spoken by a database, and the name of its driver.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// Driver-neutral classes of constraint errors, see Classify.
+var (
+	ErrUnique     = errors.New("unique constraint failed")
+	ErrForeignKey = errors.New("foreign key constraint failed")
+)
+
+// DialectOf is the dialect of a connection string, postgres urls and
+// keyword/value strings are PostgreSQL, anything else is a SQLite file.
+func DialectOf(connectionString string) Dialect {
+	s := strings.ToLower(strings.TrimSpace(connectionString))
+	if strings.HasPrefix(s, "postgres://") || strings.HasPrefix(s, "postgresql://") ||
+		strings.HasPrefix(s, "host=") || strings.HasPrefix(s, "dbname=") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// sqlStater is implemented by the errors of the common PostgreSQL drivers.
+type sqlStater interface {
+	SQLState() string
+}
+
+// Classify maps constraint errors of any driver to ErrUnique or
+// ErrForeignKey, other errors are returned as they are.
+func Classify(err error) error {
+	var se sqlite3.Error
+	if errors.As(err, &se) {
+		switch se.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrUnique
+		case sqlite3.ErrConstraintForeignKey:
+			return ErrForeignKey
+		}
+		return err
+	}
+	var ps sqlStater
+	if errors.As(err, &ps) {
+		switch ps.SQLState() {
+		case "23505":
+			return ErrUnique
+		case "23503":
+			return ErrForeignKey
+		}
+	}
+	return err
+}
+
 type Datastore struct {
 	DB      *sql.DB
 	Context context.Context
+	Dialect Dialect
+	// Dir holds the sql files, ./sql unless set.
+	Dir string
+}
+
+// sqlDir is Dir, or Dir/DIALECT for dialects other than SQLite.
+func (d *Datastore) sqlDir() string {
+	dir := d.Dir
+	if dir == "" {
+		dir = path.Join(".", "sql")
+	}
+	if d.Dialect != SQLite {
+		return path.Join(dir, string(d.Dialect))
+	}
+	return dir
 }
 
+// RunFile runs sql/name.sql, or sql/DIALECT/name.sql for dialects other than SQLite.
 func (d *Datastore) RunFile(name string) error {
-	p := path.Join(".", "sql", name+".sql")
-	s, err := os.ReadFile(p)
+	s, err := os.ReadFile(path.Join(d.sqlDir(), name+".sql"))
 	if err != nil {
 		return err
 	}
@@ -33,6 +106,11 @@ func (d *Datastore) RunFile(name string) error {
 	return nil
 }
 
+// Open opens the database of connectionString in its dialect.
+func Open(connectionString string) (*Datastore, error) {
+	return New(string(DialectOf(connectionString)), connectionString)
+}
+
 func New(driver string, connectionString string) (*Datastore, error) {
 	db, err := sql.Open(driver, connectionString)
 	if err != nil {
@@ -43,5 +121,5 @@ func New(driver string, connectionString string) (*Datastore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Datastore{db, ctx}, nil
+	return &Datastore{DB: db, Context: ctx, Dialect: Dialect(driver)}, nil
 }
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type pgError struct {
+	code string
+}
+
+func (e pgError) Error() string {
+	return "pq: " + e.code
+}
+
+func (e pgError) SQLState() string {
+	return e.code
+}
+
+func TestDialectOf(t *testing.T) {
+	t.Run("reads postgres urls and keyword strings", func(t *testing.T) {
+		for _, s := range []string{
+			"postgres://wager@localhost/wager",
+			"PostgreSQL://wager@localhost/wager?sslmode=disable",
+			"host=localhost dbname=wager",
+		} {
+			if d := DialectOf(s); d != Postgres {
+				t.Errorf("got dialect %q of %q want %q", d, s, Postgres)
+			}
+		}
+	})
+
+	t.Run("defaults to sqlite files", func(t *testing.T) {
+		for _, s := range []string{"./data/wager.db?_fk=true", ":memory:?_fk=true", "file:wager.db"} {
+			if d := DialectOf(s); d != SQLite {
+				t.Errorf("got dialect %q of %q want %q", d, s, SQLite)
+			}
+		}
+	})
+}
+
+func TestClassify(t *testing.T) {
+	t.Run("classifies sqlite constraints", func(t *testing.T) {
+		unique := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}
+		fk := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}
+		assertClass(t, unique, ErrUnique)
+		assertClass(t, fmt.Errorf("insert: %w", fk), ErrForeignKey)
+	})
+
+	t.Run("classifies postgres states", func(t *testing.T) {
+		assertClass(t, pgError{"23505"}, ErrUnique)
+		assertClass(t, pgError{"23503"}, ErrForeignKey)
+	})
+
+	t.Run("returns other errors as they are", func(t *testing.T) {
+		other := errors.New("other")
+		assertClass(t, other, other)
+		busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+		assertClass(t, busy, busy)
+		syntax := pgError{"42601"}
+		assertClass(t, syntax, syntax)
+	})
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("opens postgres", func(t *testing.T) {
+		d := postgresStore(t)
+		if d.Dialect != Postgres {
+			t.Errorf("got dialect %q want %q", d.Dialect, Postgres)
+		}
+	})
+
+	t.Run("opens sqlite", func(t *testing.T) {
+		d, err := Open(":memory:")
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		defer d.DB.Close()
+		if d.Dialect != SQLite {
+			t.Errorf("got dialect %q want %q", d.Dialect, SQLite)
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	schema := `CREATE TABLE IF NOT EXISTS user (id INTEGER PRIMARY KEY, name TEXT, flag INT);
+CREATE TABLE IF NOT EXISTS game (id INTEGER PRIMARY KEY);`
+	flag := "ALTER TABLE user ADD COLUMN flag INT;"
+
+	t.Run("creates new databases from the schema", func(t *testing.T) {
+		d := migrateStore(t, schema, map[string]string{"001_flag": flag})
+		assertNoError(t, d.Migrate())
+		assertApplied(t, d, "001_flag")
+		assertNoError(t, d.Migrate())
+	})
+
+	t.Run("migrates existing databases in order", func(t *testing.T) {
+		d := migrateStore(t, schema, map[string]string{
+			"002_seed": "INSERT INTO user (name, flag) VALUES ('miles', 1);",
+			"001_flag": flag,
+		})
+		_, err := d.DB.Exec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")
+		assertNoError(t, err)
+		assertNoError(t, d.Migrate())
+		assertApplied(t, d, "001_flag", "002_seed")
+		var n int
+		assertNoError(t, d.DB.QueryRow("SELECT COUNT(*) FROM game").Scan(&n))
+		assertNoError(t, d.Migrate())
+		assertNoError(t, d.DB.QueryRow("SELECT COUNT(*) FROM user WHERE flag = 1").Scan(&n))
+		if n != 1 {
+			t.Errorf("got %d flagged users want 1", n)
+		}
+	})
+
+	t.Run("creates postgres databases from their schema", func(t *testing.T) {
+		d := postgresStore(t)
+		assertNoError(t, d.Migrate())
+		ok, err := d.hasTable("user")
+		assertNoError(t, err)
+		if !ok {
+			t.Error("got no user table")
+		}
+		names, err := d.migrations()
+		assertNoError(t, err)
+		assertApplied(t, d, names...)
+		assertNoError(t, d.Migrate())
+	})
+
+	t.Run("has every migration for every dialect", func(t *testing.T) {
+		dir := filepath.Join("..", "..", "sql")
+		want, err := (&Datastore{Dir: dir, Dialect: SQLite}).migrations()
+		assertNoError(t, err)
+		got, err := (&Datastore{Dir: dir, Dialect: Postgres}).migrations()
+		assertNoError(t, err)
+		if fmt.Sprint(got) != fmt.Sprint(want) || len(want) == 0 {
+			t.Errorf("got postgres migrations %v want %v", got, want)
+		}
+	})
+
+	t.Run("stops at a failing migration", func(t *testing.T) {
+		d := migrateStore(t, schema, map[string]string{
+			"001_flag": flag,
+			"002_bad":  "ALTER TABLE user ADD COLUMN flag INT;",
+			"003_seed": "INSERT INTO user (name) VALUES ('miles');",
+		})
+		_, err := d.DB.Exec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")
+		assertNoError(t, err)
+		err = d.Migrate()
+		var me *MigrationError
+		if !errors.As(err, &me) || me.Name != "002_bad" {
+			t.Fatalf("got error %v want migration error of 002_bad", err)
+		}
+		assertApplied(t, d, "001_flag")
+	})
+}
+
+func TestRebind(t *testing.T) {
+	q := `SELECT id FROM "user?" WHERE name = ? AND password != '?' AND id > ?`
+
+	t.Run("keeps sqlite placeholders", func(t *testing.T) {
+		if got := SQLite.Rebind(q); got != q {
+			t.Errorf("got %q want %q", got, q)
+		}
+	})
+
+	t.Run("numbers postgres placeholders outside quotes", func(t *testing.T) {
+		want := `SELECT id FROM "user?" WHERE name = $1 AND password != '?' AND id > $2`
+		if got := Postgres.Rebind(q); got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	})
+}
+
+func migrateStore(t *testing.T, schema string, migrations map[string]string) *Datastore {
+	t.Helper()
+	dir := t.TempDir()
+	assertNoError(t, os.Mkdir(filepath.Join(dir, "migrate"), 0o755))
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "schema.sql"), []byte(schema), 0o644))
+	for name, q := range migrations {
+		assertNoError(t, os.WriteFile(filepath.Join(dir, "migrate", name+".sql"), []byte(q), 0o644))
+	}
+	d, err := Open(filepath.Join(dir, "wager.db"))
+	assertNoError(t, err)
+	t.Cleanup(func() { d.DB.Close() })
+	d.Dir = dir
+	return d
+}
+
+// postgresStore is the empty database of WAGER_TEST_POSTGRES,
+// tests using it are skipped unless it is set.
+func postgresStore(t *testing.T) *Datastore {
+	t.Helper()
+	conn := os.Getenv("WAGER_TEST_POSTGRES")
+	if conn == "" {
+		t.Skip("WAGER_TEST_POSTGRES is not set")
+	}
+	d, err := Open(conn)
+	assertNoError(t, err)
+	t.Cleanup(func() { d.DB.Close() })
+	d.Dir = filepath.Join("..", "..", "sql")
+	assertNoError(t, d.RunFile("drop"))
+	return d
+}
+
+func assertApplied(t testing.TB, d *Datastore, want ...string) {
+	t.Helper()
+	done, err := d.appliedMigrations()
+	assertNoError(t, err)
+	if len(done) != len(want) {
+		t.Errorf("got applied %v want %v", done, want)
+	}
+	for _, name := range want {
+		if !done[name] {
+			t.Errorf("got %s not applied", name)
+		}
+	}
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertClass(t testing.TB, err error, want error) {
+	t.Helper()
+	if got := Classify(err); got != want {
+		t.Errorf("got class %v of %v want %v", got, err, want)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migrate brings the database up to the current schema.
+//
+// A new database is created from sql/schema.sql, which is always current,
+// and every migration is recorded as applied. An existing database first
+// runs the migrations of sql/migrate it has not applied, in name order,
+// and then sql/schema.sql to add tables that are new in this release.
+// Dialects other than SQLite use sql/DIALECT/schema.sql and
+// sql/DIALECT/migrate, which have a migration of every name in sql/migrate.
+func (d *Datastore) Migrate() error {
+	existing, err := d.hasTable("user")
+	if err != nil {
+		return err
+	}
+	if _, err = d.DB.Exec(`CREATE TABLE IF NOT EXISTS migration
+(
+    name    TEXT PRIMARY KEY,
+    applied TIMESTAMP NOT NULL
+)`); err != nil {
+		return err
+	}
+	names, err := d.migrations()
+	if err != nil {
+		return err
+	}
+	if !existing {
+		if err = d.RunFile("schema"); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err = d.applied(d, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	done, err := d.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if done[name] {
+			continue
+		}
+		if err = d.migrate(name); err != nil {
+			return err
+		}
+	}
+	return d.RunFile("schema")
+}
+
+func (d *Datastore) migrate(name string) error {
+	s, err := os.ReadFile(path.Join(d.migrateDir(), name+".sql"))
+	if err != nil {
+		return err
+	}
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Tx.Exec(string(s)); err != nil {
+		return &MigrationError{Name: name, Err: err}
+	}
+	if err = d.applied(tx, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationError is returned when a migration fails,
+// the migration and those after it are not applied.
+type MigrationError struct {
+	Name string
+	Err  error
+}
+
+func (e *MigrationError) Error() string {
+	return "migration " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (d *Datastore) applied(e execer, name string) error {
+	_, err := e.Exec("INSERT INTO migration (name, applied) VALUES (?, ?)",
+		name, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (d *Datastore) appliedMigrations() (map[string]bool, error) {
+	done := map[string]bool{}
+	rows, err := d.Query("SELECT name FROM migration")
+	if err != nil {
+		return done, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return done, err
+		}
+		done[name] = true
+	}
+	return done, rows.Err()
+}
+
+// migrateDir is sql/migrate, or sql/DIALECT/migrate for dialects other than SQLite.
+func (d *Datastore) migrateDir() string {
+	return path.Join(d.sqlDir(), "migrate")
+}
+
+// migrations are the names of the files of the migrate directory without extension.
+func (d *Datastore) migrations() ([]string, error) {
+	entries, err := os.ReadDir(d.migrateDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".sql") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".sql"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d *Datastore) hasTable(name string) (bool, error) {
+	q := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if d.Dialect == Postgres {
+		q = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var n int
+	err := d.QueryRow(q, name).Scan(&n)
+	return n > 0, err
+}
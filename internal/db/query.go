@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rebind replaces the ? placeholders of q with those of the dialect,
+// PostgreSQL numbers them $1, $2 and so on. Quoted text is kept as it is.
+func (d Dialect) Rebind(q string) string {
+	if d != Postgres || !strings.Contains(q, "?") {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, c := range q {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// JSONArray is the name of the aggregate that collects values in a json array.
+func (d Dialect) JSONArray() string {
+	if d == Postgres {
+		return "json_agg"
+	}
+	return "json_group_array"
+}
+
+// JSONObject is the name of the function that builds a json object of key/value pairs.
+func (d Dialect) JSONObject() string {
+	if d == Postgres {
+		return "json_build_object"
+	}
+	return "json_object"
+}
+
+// Seconds is the sql expression of the whole seconds from the timestamp start to end.
+func (d Dialect) Seconds(start string, end string) string {
+	if d == Postgres {
+		return "CAST(EXTRACT(EPOCH FROM (" + end + " - " + start + ")) AS BIGINT)"
+	}
+	return "strftime('%s', " + end + ") - strftime('%s', " + start + ")"
+}
+
+// Exec, Query and QueryRow run q on the database in the dialect of d.
+func (d *Datastore) Exec(q string, args ...any) (sql.Result, error) {
+	return d.DB.Exec(d.Dialect.Rebind(q), args...)
+}
+
+func (d *Datastore) Query(q string, args ...any) (*sql.Rows, error) {
+	return d.DB.Query(d.Dialect.Rebind(q), args...)
+}
+
+func (d *Datastore) QueryRow(q string, args ...any) *sql.Row {
+	return d.DB.QueryRow(d.Dialect.Rebind(q), args...)
+}
+
+func (d *Datastore) Begin() (*Tx, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: d.Dialect}, nil
+}
+
+// Tx is a transaction that runs queries in the dialect of its database.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (t *Tx) Exec(q string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.Dialect.Rebind(q), args...)
+}
+
+func (t *Tx) Query(q string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.Dialect.Rebind(q), args...)
+}
+
+func (t *Tx) QueryRow(q string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.Dialect.Rebind(q), args...)
+}
+
+func (t *Tx) Prepare(q string) (*sql.Stmt, error) {
+	return t.Tx.Prepare(t.Dialect.Rebind(q))
+}
+
+// Resequence moves the id sequences of tables past their largest id once
+// rows were inserted with their ids, SQLite does so when inserting.
+func (t *Tx) Resequence(tables ...string) error {
+	if t.Dialect != Postgres {
+		return nil
+	}
+	for _, table := range tables {
+		_, err := t.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s",
+			table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -24,7 +26,19 @@ type Env struct {
 	InviteCode       string
 	JWTSecret        string
 	JWTCookie        string
-	Mode             Mode
+	IdempotencyTTL   time.Duration
+	// Admins are the names of the users allowed to use /api/admin.
+	Admins []string
+	Mode   Mode
+}
+
+func (e Env) IsAdmin(name string) bool {
+	for _, a := range e.Admins {
+		if a == name {
+			return true
+		}
+	}
+	return false
 }
 
 func envFileFromMode(m Mode) string {
@@ -52,6 +66,23 @@ func intOrDefault(s string, d int) int {
 	return d
 }
 
+func durationOrDefault(s string, d time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(s)); err == nil {
+		return v
+	}
+	return d
+}
+
+func listValue(s string) []string {
+	l := []string{}
+	for _, v := range strings.Split(os.Getenv(s), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
 func requiredValue(s string) string {
 	e := os.Getenv(s)
 	if e == "" {
@@ -67,14 +98,23 @@ func optionalValue(s string, d string) string {
 	return d
 }
 
+// New loads the environment of the mode given as the first argument.
 func New() Env {
-	mode := ModeDev
+	m := ""
 	if len(os.Args) > 1 {
-		m := Mode(os.Args[1])
-		if m != ModeProd && m != ModeTest && m != ModeDev {
+		m = os.Args[1]
+	}
+	return FromMode(m)
+}
+
+// FromMode loads the environment of m, which defaults to ModeDev.
+func FromMode(m string) Env {
+	mode := ModeDev
+	if m != "" {
+		mode = Mode(m)
+		if mode != ModeProd && mode != ModeTest && mode != ModeDev {
 			log.Fatal(fmt.Sprintf("unknown mode: '%s'", m))
 		}
-		mode = m
 	}
 	err := godotenv.Load(envFileFromMode(mode))
 	if err != nil {
@@ -87,6 +127,8 @@ func New() Env {
 		InviteCode:       requiredValue("INVITE_CODE"),
 		JWTSecret:        requiredValue("JWT_SECRET"),
 		JWTCookie:        optionalValue("JWT_COOKIE", "auth-wager-user"),
+		IdempotencyTTL:   durationOrDefault("IDEMPOTENCY_TTL", 24*time.Hour),
+		Admins:           listValue("ADMINS"),
 		Mode:             mode,
 	}
 }
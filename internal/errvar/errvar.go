@@ -15,3 +15,20 @@ var ErrGameSessionActive = errors.New("game-session has active round")
 var ErrGameSessionNoActive = errors.New("game-session has no active round")
 var ErrGameSessionWager = errors.New("game-session has resolved wager")
 var ErrWinnerIsNotParticipant = errors.New("winner is not participant")
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+var ErrTOTPRequired = errors.New("'code' is required")
+var ErrTOTPInvalid = errors.New("invalid 'code'")
+var ErrTOTPEnabled = errors.New("two-factor authentication already enabled")
+var ErrTOTPNotEnrolled = errors.New("two-factor authentication not enrolled")
+var ErrCSRFToken = errors.New("csrf token mismatch")
+var ErrCSRFOrigin = errors.New("cross-origin request refused")
+var ErrIdempotencyKey = errors.New("'Idempotency-Key' must be between 1-255 characters")
+var ErrIdempotencyKeyReused = errors.New("'Idempotency-Key' was used for a different request")
+var ErrIdempotencyKeyInFlight = errors.New("request with 'Idempotency-Key' is in progress")
+var ErrPreconditionRequired = errors.New("'If-Match' is required, \"*\" matches any version")
+var ErrPreconditionFailed = errors.New("'If-Match' does not match the current version")
+var ErrVersionConflict = errors.New("resource was changed by a concurrent request")
+var ErrDatabaseNotEmpty = errors.New("database is not empty")
+var ErrAdminRequired = errors.New("user is not an admin")
+var ErrUserDeactivated = errors.New("user is deactivated")
+var ErrQuerySpec = errors.New("query conditions need a sql repository")
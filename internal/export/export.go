@@ -0,0 +1,258 @@
+// Package export lays out the history as csv tables for spreadsheets.
+// Every table has a column per person, holding what the row nets them.
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+// Write writes rows to w as csv. Cells a spreadsheet would evaluate as a
+// formula, such as a name of =HYPERLINK(...), are prefixed with a quote to
+// stay text, numbers like the negative nets are kept as they are.
+func Write(w io.Writer, rows [][]string) error {
+	escaped := make([][]string, len(rows))
+	for i, row := range rows {
+		escaped[i] = make([]string, len(row))
+		for j, cell := range row {
+			escaped[i][j] = escape(cell)
+		}
+	}
+	return csv.NewWriter(w).WriteAll(escaped)
+}
+
+func escape(cell string) string {
+	if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return cell
+	}
+	if _, err := strconv.Atoi(cell); err == nil {
+		return cell
+	}
+	return "'" + cell
+}
+
+type nameable interface {
+	ResultID() db.ID
+	ResultName() string
+}
+
+// Sessions is a row per session. Wagered and rounds only count ended rounds.
+func Sessions(ss []services.SessionWithGames, users []services.User) [][]string {
+	people := participants(users, func(has func(db.ID)) {
+		for _, s := range ss {
+			for _, id := range s.Users {
+				has(id)
+			}
+		}
+	})
+	rows := [][]string{header(people,
+		"id", "started", "ended", "participants", "games", "rounds", "wagered")}
+	for _, s := range ss {
+		rounds, wagered := 0, 0
+		for _, gs := range s.GameSessions {
+			n, w := ended(gs.Rounds)
+			rounds += n
+			wagered += w
+		}
+		in := map[db.ID]bool{}
+		for _, id := range s.Users {
+			in[id] = true
+		}
+		rows = append(rows, append([]string{
+			formatID(s.ID),
+			formatTime(&s.Started),
+			formatTime(s.Ended),
+			names(s.Users, users),
+			strconv.Itoa(len(s.GameSessions)),
+			strconv.Itoa(rounds),
+			strconv.Itoa(wagered),
+		}, nets(people, in, s.Result)...))
+	}
+	return rows
+}
+
+// GameSessions is a row per game session.
+// Wagered and rounds only count ended rounds.
+func GameSessions(gs []services.GameSession, users []services.User, games []services.Game) [][]string {
+	people := participants(users, func(has func(db.ID)) {
+		for _, g := range gs {
+			for id := range g.Result {
+				has(id)
+			}
+		}
+	})
+	rows := [][]string{header(people,
+		"id", "session", "game", "started", "ended", "participants", "rounds", "wagered")}
+	for _, g := range gs {
+		rounds, wagered := ended(g.Rounds)
+		rows = append(rows, append([]string{
+			formatID(g.ID),
+			formatID(g.SessionID),
+			nameFromID(g.GameID, games),
+			formatTime(&g.Started),
+			formatTime(g.Ended),
+			names(keys(g.Result), users),
+			strconv.Itoa(rounds),
+			strconv.Itoa(wagered),
+		}, nets(people, g.Result, g.Result)...))
+	}
+	return rows
+}
+
+// Rounds is a row per ended round of gs, active rounds have no winner yet.
+func Rounds(gs []services.GameSession, users []services.User, games []services.Game) [][]string {
+	people := participants(users, func(has func(db.ID)) {
+		for _, g := range gs {
+			for _, r := range g.Rounds {
+				for id := range r.Result {
+					has(id)
+				}
+			}
+		}
+	})
+	rows := [][]string{header(people,
+		"id", "session", "game session", "game", "round", "wager", "winner", "participants")}
+	for _, g := range gs {
+		rounds := append(services.GameSessionRounds{}, g.Rounds...)
+		sort.Slice(rounds, func(i, j int) bool { return rounds[i].Round < rounds[j].Round })
+		for _, r := range rounds {
+			if r.Active == 1 {
+				continue
+			}
+			winner := ""
+			if w, ok := r.Result.Winner(); ok {
+				winner = nameFromID(w, users)
+			}
+			rows = append(rows, append([]string{
+				formatID(r.ID),
+				formatID(g.SessionID),
+				formatID(g.ID),
+				nameFromID(g.GameID, games),
+				strconv.Itoa(r.Round),
+				strconv.Itoa(r.Wager),
+				winner,
+				names(keys(r.Result), users),
+			}, nets(people, r.Result, r.Result)...))
+		}
+	}
+	return rows
+}
+
+// Balances is a row per person in the current result,
+// with their net and what they owe every other person.
+func Balances(r result.ResultMap, users []services.User) [][]string {
+	people := participants(users, func(has func(db.ID)) {
+		for id := range r {
+			has(id)
+		}
+	})
+	head := []string{"name", "net"}
+	for _, p := range people {
+		head = append(head, "owes "+p.Name)
+	}
+	rows := [][]string{head}
+	for _, p := range people {
+		row := []string{p.Name, strconv.Itoa(r.Net(p.ID))}
+		for _, other := range people {
+			row = append(row, strconv.Itoa(r[p.ID][other.ID]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// participants are the users passed to has by each, in the order of users.
+func participants(users []services.User, each func(has func(db.ID))) []services.User {
+	seen := map[db.ID]bool{}
+	each(func(id db.ID) {
+		seen[id] = true
+	})
+	people := make([]services.User, 0, len(seen))
+	for _, u := range users {
+		if seen[u.ID] {
+			people = append(people, u)
+		}
+	}
+	return people
+}
+
+func header(people []services.User, cols ...string) []string {
+	for _, p := range people {
+		cols = append(cols, p.Name)
+	}
+	return cols
+}
+
+// nets is what r nets each of people, blank for those not in.
+func nets[T any](people []services.User, in map[db.ID]T, r result.ResultMap) []string {
+	cells := make([]string, len(people))
+	for i, p := range people {
+		if _, ok := in[p.ID]; ok {
+			cells[i] = strconv.Itoa(r.Net(p.ID))
+		}
+	}
+	return cells
+}
+
+// ended counts the ended rounds and their wagers.
+func ended(rounds services.GameSessionRounds) (int, int) {
+	n, wagered := 0, 0
+	for _, r := range rounds {
+		if r.Active == 0 {
+			n++
+			wagered += r.Wager
+		}
+	}
+	return n, wagered
+}
+
+func keys(r result.ResultMap) []db.ID {
+	ids := make([]db.ID, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// names joins the names of ids in the order of users.
+func names(ids []db.ID, users []services.User) string {
+	in := map[db.ID]bool{}
+	for _, id := range ids {
+		in[id] = true
+	}
+	var n []string
+	for _, u := range users {
+		if in[u.ID] {
+			n = append(n, u.Name)
+		}
+	}
+	return strings.Join(n, ", ")
+}
+
+func nameFromID[T nameable](id db.ID, n []T) string {
+	for _, e := range n {
+		if e.ResultID() == id {
+			return e.ResultName()
+		}
+	}
+	return ""
+}
+
+func formatID(id db.ID) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return services.FormatTime(*t)
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+var (
+	users = []services.User{{ID: 1, Name: "miles"}, {ID: 2, Name: "bill"}, {ID: 3, Name: "jane"}}
+	games = []services.Game{{ID: 1, Name: "Golf"}}
+	start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func round(id db.ID, n int, wager int, active int, r result.ResultMap) services.GameSessionRound {
+	gr := services.GameSessionRound{GameSessionID: 1}
+	gr.ID = id
+	gr.Round = n
+	gr.Wager = wager
+	gr.Active = active
+	gr.Result = r
+	return gr
+}
+
+func gameSession() services.GameSession {
+	gs := services.GameSession{SessionID: 1, GameID: 1}
+	gs.ID = 1
+	gs.Started = start
+	gs.Ended = &start
+	gs.Result = result.ResultMap{1: {2: 0}, 2: {1: 150}}
+	// rounds are listed with the latest first
+	gs.Rounds = services.GameSessionRounds{
+		round(3, 3, 40, 1, result.ResultMap{1: {2: 0}, 2: {1: 0}}),
+		round(2, 2, 50, 0, result.ResultMap{1: {2: 0}, 2: {1: 50}}),
+		round(1, 1, 100, 0, result.ResultMap{1: {2: 0}, 2: {1: 100}}),
+	}
+	return gs
+}
+
+func TestSessions(t *testing.T) {
+	t.Run("has a net column per participant", func(t *testing.T) {
+		s := services.SessionWithGames{
+			Users:        services.Users{2, 1},
+			GameSessions: services.GameSessions{gameSession()},
+		}
+		s.ID = 1
+		s.Started = start
+		s.Result = result.ResultMap{1: {2: 0}, 2: {1: 150}}
+		got := Sessions([]services.SessionWithGames{s}, users)
+		assertRows(t, got,
+			"id,started,ended,participants,games,rounds,wagered,miles,bill",
+			"1,2024-01-01T12:00:00Z,,miles, bill,1,2,150,150,-150")
+	})
+}
+
+func TestGameSessions(t *testing.T) {
+	t.Run("names the game and counts ended rounds", func(t *testing.T) {
+		got := GameSessions([]services.GameSession{gameSession()}, users, games)
+		assertRows(t, got,
+			"id,session,game,started,ended,participants,rounds,wagered,miles,bill",
+			"1,1,Golf,2024-01-01T12:00:00Z,2024-01-01T12:00:00Z,miles, bill,2,150,150,-150")
+	})
+}
+
+func TestRounds(t *testing.T) {
+	t.Run("lists ended rounds in order with their winner", func(t *testing.T) {
+		got := Rounds([]services.GameSession{gameSession()}, users, games)
+		assertRows(t, got,
+			"id,session,game session,game,round,wager,winner,participants,miles,bill",
+			"1,1,1,Golf,1,100,miles,miles, bill,100,-100",
+			"2,1,1,Golf,2,50,miles,miles, bill,50,-50")
+	})
+}
+
+func TestBalances(t *testing.T) {
+	t.Run("has what every person owes every other", func(t *testing.T) {
+		r := result.ResultMap{1: {2: 0, 3: 20}, 2: {1: 70, 3: 0}, 3: {1: 0, 2: 10}}
+		got := Balances(r, users)
+		assertRows(t, got,
+			"name,net,owes miles,owes bill,owes jane",
+			"miles,50,0,0,20",
+			"bill,-60,70,0,0",
+			"jane,10,0,10,0")
+	})
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("keeps formulas as text", func(t *testing.T) {
+		var b strings.Builder
+		err := Write(&b, [][]string{
+			{"name", "net"},
+			{"=HYPERLINK(\"http://x\")", "-60"},
+			{"+cmd", "+5"},
+			{"-2+3", "@SUM(A1)"},
+			{"\tjim", "\rjim"},
+			{"bill", ""},
+		})
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		want := "name,net\n" +
+			"\"'=HYPERLINK(\"\"http://x\"\")\",-60\n" +
+			"'+cmd,+5\n" +
+			"'-2+3,'@SUM(A1)\n" +
+			"'\tjim,\"'\rjim\"\n" +
+			"bill,\n"
+		if b.String() != want {
+			t.Errorf("got %q want %q", b.String(), want)
+		}
+	})
+}
+
+// assertRows compares rows joined by commas, without csv quoting.
+func assertRows(t testing.TB, got [][]string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows %v want %d", len(got), got, len(want))
+	}
+	for i, row := range got {
+		if line := strings.Join(row, ","); line != want[i] {
+			t.Errorf("row %d: got %q want %q", i, line, want[i])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package hub
+
+import "sync"
+
+// Buffer is the number of messages a subscriber can fall behind
+// before further messages to it are dropped.
+const Buffer = 16
+
+// Hub is an in-process publish/subscribe hub where messages of type T
+// are published to the subscribers of a topic of type K.
+type Hub[K comparable, T any] struct {
+	mu     sync.Mutex
+	topics map[K]map[chan T]struct{}
+}
+
+func New[K comparable, T any]() *Hub[K, T] {
+	return &Hub[K, T]{topics: map[K]map[chan T]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the messages published to topic,
+// and a function that unsubscribes and closes the channel.
+func (h *Hub[K, T]) Subscribe(topic K) (<-chan T, func()) {
+	ch := make(chan T, Buffer)
+	h.mu.Lock()
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = map[chan T]struct{}{}
+		h.topics[topic] = subs
+	}
+	subs[ch] = struct{}{}
+	h.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(subs, ch)
+			if len(subs) == 0 {
+				delete(h.topics, topic)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish sends msg to every subscriber of topic without blocking.
+func (h *Hub[K, T]) Publish(topic K, msg T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.topics[topic] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Subscribers is the number of subscribers of topic.
+func (h *Hub[K, T]) Subscribers(topic K) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[topic])
+}
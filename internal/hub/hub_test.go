@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	t.Run("publishes to subscribers of a topic", func(t *testing.T) {
+		h := New[int, string]()
+		a, unsubA := h.Subscribe(1)
+		defer unsubA()
+		b, unsubB := h.Subscribe(1)
+		defer unsubB()
+		other, unsubOther := h.Subscribe(2)
+		defer unsubOther()
+		h.Publish(1, "end-round")
+		assertString(t, <-a, "end-round")
+		assertString(t, <-b, "end-round")
+		assertInt(t, len(other), 0)
+	})
+
+	t.Run("unsubscribing closes the channel once", func(t *testing.T) {
+		h := New[int, string]()
+		ch, unsub := h.Subscribe(1)
+		assertInt(t, h.Subscribers(1), 1)
+		unsub()
+		unsub()
+		if _, ok := <-ch; ok {
+			t.Error("got open channel")
+		}
+		assertInt(t, h.Subscribers(1), 0)
+		h.Publish(1, "end")
+	})
+
+	t.Run("drops messages to slow subscribers", func(t *testing.T) {
+		h := New[int, int]()
+		ch, unsub := h.Subscribe(1)
+		defer unsub()
+		for i := 0; i < Buffer+5; i++ {
+			h.Publish(1, i)
+		}
+		assertInt(t, len(ch), Buffer)
+		assertInt(t, <-ch, 0)
+	})
+
+	t.Run("is safe for concurrent use", func(t *testing.T) {
+		h := New[int, int]()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				ch, unsub := h.Subscribe(1)
+				h.Publish(1, 1)
+				<-ch
+				unsub()
+			}()
+			go func() {
+				defer wg.Done()
+				h.Publish(1, 2)
+			}()
+		}
+		wg.Wait()
+		assertInt(t, h.Subscribers(1), 0)
+	})
+}
+
+func assertString(t testing.TB, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
+
+func assertInt(t testing.TB, got int, expected int) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %d want %d", got, expected)
+	}
+}
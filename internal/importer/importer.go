@@ -0,0 +1,390 @@
+// Package importer plans the import of bets tracked before this app,
+// read from a csv with a row per round of date, game, participants,
+// winner and amount.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// Columns are the required columns of the header, in any order.
+var Columns = []string{"date", "game", "participants", "winner", "amount"}
+
+// layouts are the accepted formats of the date column, dates without a
+// time are played at midnight UTC.
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Row is a round as tracked elsewhere, Line is its line in the csv.
+type Row struct {
+	Line         int
+	Played       time.Time
+	Game         string
+	Participants []string
+	Winner       string
+	Amount       int
+}
+
+// LineError is a row that cannot be imported.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads every row of r, participants are separated by
+// commas, semicolons or pipes. Every invalid row is reported.
+func Parse(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, &LineError{1, errors.New("missing header")}
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var missing []string
+	for _, name := range Columns {
+		if _, ok := cols[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &LineError{1, fmt.Errorf("missing columns %s", strings.Join(missing, ", "))}
+	}
+	cr.FieldsPerRecord = len(header)
+	var rows []Row
+	var errs []error
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) && pe.Err == csv.ErrFieldCount {
+				errs = append(errs, &LineError{pe.Line, pe.Err})
+				continue
+			}
+			return nil, err
+		}
+		row, rowErrs := parseRow(record, cols)
+		for _, err := range rowErrs {
+			errs = append(errs, &LineError{line, err})
+		}
+		if len(rowErrs) > 0 {
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rows, nil
+}
+
+func parseRow(record []string, cols map[string]int) (Row, []error) {
+	field := func(name string) string {
+		return strings.TrimSpace(record[cols[name]])
+	}
+	var row Row
+	var errs []error
+	played, err := parseDate(field("date"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	row.Played = played
+	if row.Game = field("game"); row.Game == "" {
+		errs = append(errs, errors.New("'game' is required"))
+	}
+	row.Participants = strings.FieldsFunc(field("participants"), func(r rune) bool {
+		return r == ',' || r == ';' || r == '|'
+	})
+	seen := map[string]bool{}
+	names := row.Participants[:0]
+	for _, p := range row.Participants {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if seen[strings.ToLower(p)] {
+			errs = append(errs, fmt.Errorf("participant %q is repeated", p))
+		}
+		seen[strings.ToLower(p)] = true
+		names = append(names, p)
+	}
+	row.Participants = names
+	if len(row.Participants) < 2 {
+		errs = append(errs, errors.New("'participants' must name minimum 2 people"))
+	}
+	row.Winner = field("winner")
+	if !seen[strings.ToLower(row.Winner)] {
+		errs = append(errs, fmt.Errorf("winner %q is not a participant", row.Winner))
+	}
+	amount, err := strconv.Atoi(field("amount"))
+	if err != nil || amount <= 0 {
+		errs = append(errs, errors.New("'amount' must be a positive whole number"))
+	}
+	row.Amount = amount
+	return row, errs
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'date' %q must be a date (YYYY-MM-DD), optionally with a time", s)
+}
+
+type nameable interface {
+	ResultID() db.ID
+	ResultName() string
+}
+
+// Plan is the ended sessions to create from the rows of an import.
+// Rows are grouped into a session per day and set of participants,
+// and into a game session per run of rows of the same game.
+type Plan struct {
+	Sessions []Session
+	// NewGames are the names of the games to create.
+	NewGames []string
+	// Duplicates are the lines of the rows already imported, which are skipped.
+	Duplicates []int
+	names      map[db.ID]string
+}
+
+// Imported counts the rounds already played by day, game, participants
+// and amount. Rows matching a round are duplicates, one row per round.
+type Imported map[string]int
+
+// Add counts a round played at played, participants can be in any order.
+func (i Imported) Add(played time.Time, gameID db.ID, participants []db.ID, amount int) {
+	i[importedKey(played, gameID, participants, amount)]++
+}
+
+func importedKey(played time.Time, gameID db.ID, participants []db.ID, amount int) string {
+	ids := append([]db.ID{}, participants...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return fmt.Sprint(played.UTC().Format("2006-01-02"), gameID, ids, amount)
+}
+
+type Session struct {
+	Users   []db.ID
+	Started time.Time
+	Ended   time.Time
+	Games   []GameSession
+	Result  result.ResultMap
+}
+
+// GameSession has the id of its game, or 0 if Game is to be created.
+type GameSession struct {
+	GameID  db.ID
+	Game    string
+	Started time.Time
+	Ended   time.Time
+	Rounds  []Round
+	Result  result.ResultMap
+}
+
+type Round struct {
+	Line   int
+	Wager  int
+	Winner db.ID
+	Result result.ResultMap
+}
+
+func (r Round) ResultMap() result.ResultMap {
+	return r.Result
+}
+
+func (g GameSession) ResultMap() result.ResultMap {
+	return g.Result
+}
+
+// NewPlan maps the names of rows to users and games, ignoring case.
+// Unknown users are reported, unknown games are created and rows
+// of rounds in imported are skipped as duplicates.
+func NewPlan[U nameable, G nameable](rows []Row, users []U, games []G, imported Imported) (Plan, error) {
+	p := Plan{names: map[db.ID]string{}}
+	left := Imported{}
+	for k, n := range imported {
+		left[k] = n
+	}
+	userIDs := map[string]db.ID{}
+	for _, u := range users {
+		userIDs[strings.ToLower(u.ResultName())] = u.ResultID()
+		p.names[u.ResultID()] = u.ResultName()
+	}
+	gameIDs := map[string]db.ID{}
+	gameNames := map[string]string{}
+	for _, g := range games {
+		gameIDs[strings.ToLower(g.ResultName())] = g.ResultID()
+	}
+	rows = append([]Row{}, rows...)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Played.Before(rows[j].Played) })
+	var errs []error
+	var key string
+	for _, row := range rows {
+		ids := make([]db.ID, 0, len(row.Participants))
+		for _, name := range row.Participants {
+			id, ok := userIDs[strings.ToLower(name)]
+			if !ok {
+				errs = append(errs, &LineError{row.Line, fmt.Errorf("unknown user %q", name)})
+				continue
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) < len(row.Participants) {
+			continue
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		game := strings.ToLower(row.Game)
+		if gameID, ok := gameIDs[game]; ok {
+			if k := importedKey(row.Played, gameID, ids, row.Amount); left[k] > 0 {
+				left[k]--
+				p.Duplicates = append(p.Duplicates, row.Line)
+				continue
+			}
+		}
+		if _, ok := gameIDs[game]; !ok && gameNames[game] == "" {
+			gameNames[game] = row.Game
+			p.NewGames = append(p.NewGames, row.Game)
+		}
+		k := fmt.Sprint(row.Played.Format("2006-01-02"), ids)
+		if k != key || len(p.Sessions) == 0 {
+			key = k
+			p.Sessions = append(p.Sessions, Session{Users: ids, Started: row.Played})
+		}
+		s := &p.Sessions[len(p.Sessions)-1]
+		s.Ended = row.Played
+		if n := len(s.Games); n == 0 || !strings.EqualFold(s.Games[n-1].Game, row.Game) {
+			s.Games = append(s.Games, GameSession{
+				GameID: gameIDs[game], Game: row.Game, Started: row.Played,
+			})
+		}
+		gs := &s.Games[len(s.Games)-1]
+		gs.Ended = row.Played
+		r := Round{Line: row.Line, Wager: row.Amount, Winner: userIDs[strings.ToLower(row.Winner)]}
+		r.Result = result.New(ids)
+		r.Result.AddWinner(r.Winner, r.Wager)
+		gs.Rounds = append(gs.Rounds, r)
+	}
+	if len(errs) > 0 {
+		return Plan{}, errors.Join(errs...)
+	}
+	for i := range p.Sessions {
+		s := &p.Sessions[i]
+		for j := range s.Games {
+			s.Games[j].Result = result.Merge(s.Users, s.Games[j].Rounds...)
+			s.Games[j].Result.Resolve()
+		}
+		s.Result = result.Merge(s.Users, s.Games...)
+		s.Result.Resolve()
+	}
+	return p, nil
+}
+
+// Report is what an import creates, and what it nets each user by name.
+type Report struct {
+	DryRun       bool           `json:"dryRun"`
+	Sessions     int            `json:"sessions"`
+	GameSessions int            `json:"gameSessions"`
+	Rounds       int            `json:"rounds"`
+	NewGames     []string       `json:"newGames"`
+	Duplicates   []int          `json:"duplicates"`
+	Nets         map[string]int `json:"nets"`
+	From         *time.Time     `json:"from"`
+	To           *time.Time     `json:"to"`
+}
+
+func (p Plan) Report() Report {
+	r := Report{
+		Sessions: len(p.Sessions), NewGames: p.NewGames,
+		Duplicates: p.Duplicates, Nets: map[string]int{},
+	}
+	if r.NewGames == nil {
+		r.NewGames = []string{}
+	}
+	if r.Duplicates == nil {
+		r.Duplicates = []int{}
+	}
+	for _, s := range p.Sessions {
+		r.GameSessions += len(s.Games)
+		for _, gs := range s.Games {
+			r.Rounds += len(gs.Rounds)
+		}
+		for _, id := range s.Users {
+			r.Nets[p.names[id]] += s.Result.Net(id)
+		}
+	}
+	if n := len(p.Sessions); n > 0 {
+		r.From = &p.Sessions[0].Started
+		r.To = &p.Sessions[n-1].Ended
+	}
+	return r
+}
+
+// String is the report as lines of text, for the terminal.
+func (r Report) String() string {
+	var b strings.Builder
+	verb := "imported"
+	if r.DryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(&b, "%s %d sessions, %d game sessions and %d rounds\n",
+		verb, r.Sessions, r.GameSessions, r.Rounds)
+	if r.From != nil {
+		fmt.Fprintf(&b, "played from %s to %s\n",
+			r.From.Format("2006-01-02"), r.To.Format("2006-01-02"))
+	}
+	if len(r.NewGames) > 0 {
+		fmt.Fprintf(&b, "new games: %s\n", strings.Join(r.NewGames, ", "))
+	}
+	if len(r.Duplicates) > 0 {
+		lines := make([]string, len(r.Duplicates))
+		for i, l := range r.Duplicates {
+			lines[i] = strconv.Itoa(l)
+		}
+		fmt.Fprintf(&b, "skipped %d rows already imported, lines %s\n",
+			len(r.Duplicates), strings.Join(lines, ", "))
+	}
+	names := make([]string, 0, len(r.Nets))
+	for name := range r.Nets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s nets %d\n", name, r.Nets[name])
+	}
+	return b.String()
+}
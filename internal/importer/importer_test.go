@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+type named struct {
+	id   db.ID
+	name string
+}
+
+func (n named) ResultID() db.ID {
+	return n.id
+}
+
+func (n named) ResultName() string {
+	return n.name
+}
+
+var (
+	users = []named{{1, "miles"}, {2, "bill"}, {3, "jane"}}
+	games = []named{{1, "Golf"}}
+)
+
+const history = `date,game,participants,winner,amount
+2024-01-02 20:00,golf,"miles, bill",Bill,100
+2024-01-02 20:30,Golf,miles;bill,miles,40
+2024-01-02 21:00,Darts,miles|bill,bill,10
+2024-01-01,Golf,miles;bill;jane,jane,60
+`
+
+func TestParse(t *testing.T) {
+	t.Run("reads every row", func(t *testing.T) {
+		rows, err := Parse(strings.NewReader(history))
+		assertNoError(t, err)
+		if len(rows) != 4 {
+			t.Fatalf("got %d rows want 4", len(rows))
+		}
+		r := rows[0]
+		want := time.Date(2024, 1, 2, 20, 0, 0, 0, time.UTC)
+		if r.Line != 2 || !r.Played.Equal(want) || r.Game != "golf" || r.Winner != "Bill" || r.Amount != 100 {
+			t.Errorf("got %+v", r)
+		}
+		if strings.Join(rows[3].Participants, "/") != "miles/bill/jane" {
+			t.Errorf("got participants %v", rows[3].Participants)
+		}
+	})
+
+	t.Run("reports missing columns", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("date,game,winner\n"))
+		assertErrContains(t, err, "line 1: missing columns participants, amount")
+	})
+
+	t.Run("reports every invalid row", func(t *testing.T) {
+		_, err := Parse(strings.NewReader(`date,game,participants,winner,amount
+yesterday,Golf,miles;bill,miles,10
+2024-01-01,Golf,miles;bill,jane,-5
+2024-01-01,Golf,miles
+`))
+		assertErrContains(t, err, `line 2: 'date' "yesterday" must be a date`)
+		assertErrContains(t, err, `line 3: winner "jane" is not a participant`)
+		assertErrContains(t, err, "line 3: 'amount' must be a positive whole number")
+		assertErrContains(t, err, "line 4: wrong number of fields")
+	})
+}
+
+func TestNewPlan(t *testing.T) {
+	rows, err := Parse(strings.NewReader(history))
+	assertNoError(t, err)
+
+	t.Run("groups rows by day, participants and game", func(t *testing.T) {
+		p, err := NewPlan(rows, users, games, nil)
+		assertNoError(t, err)
+		if len(p.Sessions) != 2 {
+			t.Fatalf("got %d sessions want 2", len(p.Sessions))
+		}
+		first, second := p.Sessions[0], p.Sessions[1]
+		if len(first.Users) != 3 || len(first.Games) != 1 || first.Games[0].GameID != 1 {
+			t.Errorf("got first session %+v", first)
+		}
+		if len(second.Games) != 2 || len(second.Games[0].Rounds) != 2 || second.Games[1].GameID != 0 {
+			t.Errorf("got second session %+v", second)
+		}
+		if !second.Started.Equal(time.Date(2024, 1, 2, 20, 0, 0, 0, time.UTC)) ||
+			!second.Ended.Equal(time.Date(2024, 1, 2, 21, 0, 0, 0, time.UTC)) {
+			t.Errorf("got second session from %s to %s", second.Started, second.Ended)
+		}
+		if second.Games[0].Result.Net(2) != 60 || second.Result.Net(2) != 70 {
+			t.Errorf("got bill nets %d and %d want 60 and 70",
+				second.Games[0].Result.Net(2), second.Result.Net(2))
+		}
+	})
+
+	t.Run("creates unknown games once", func(t *testing.T) {
+		p, err := NewPlan(append(rows, Row{
+			Line: 6, Played: rows[2].Played, Game: "darts",
+			Participants: []string{"miles", "bill"}, Winner: "miles", Amount: 5,
+		}), users, games, nil)
+		assertNoError(t, err)
+		if strings.Join(p.NewGames, ",") != "Darts" {
+			t.Errorf("got new games %v want [Darts]", p.NewGames)
+		}
+	})
+
+	t.Run("reports unknown users", func(t *testing.T) {
+		_, err := NewPlan(rows, users[:2], games, nil)
+		assertErrContains(t, err, `line 5: unknown user "jane"`)
+	})
+
+	t.Run("skips rows already imported", func(t *testing.T) {
+		imported := Imported{}
+		// line 2 was imported once, so only one of it and its copy on line 6
+		// is skipped, line 3 was played on another day
+		imported.Add(time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), 1, []db.ID{2, 1}, 100)
+		imported.Add(time.Date(2024, 1, 3, 20, 0, 0, 0, time.UTC), 1, []db.ID{1, 2}, 40)
+		p, err := NewPlan(append(rows, Row{
+			Line: 6, Played: rows[0].Played, Game: "Golf",
+			Participants: []string{"bill", "miles"}, Winner: "miles", Amount: 100,
+		}), users, games, imported)
+		assertNoError(t, err)
+		r := p.Report()
+		if len(r.Duplicates) != 1 || r.Duplicates[0] != 2 {
+			t.Errorf("got duplicates %v want [2]", r.Duplicates)
+		}
+		if r.Rounds != 4 {
+			t.Errorf("got %d rounds want 4", r.Rounds)
+		}
+		if !strings.Contains(r.String(), "skipped 1 rows already imported, lines 2") {
+			t.Errorf("got report %q", r.String())
+		}
+	})
+
+	t.Run("reports what every user nets", func(t *testing.T) {
+		p, err := NewPlan(rows, users, games, nil)
+		assertNoError(t, err)
+		r := p.Report()
+		if r.Sessions != 2 || r.GameSessions != 3 || r.Rounds != 4 {
+			t.Errorf("got %d sessions, %d game sessions and %d rounds", r.Sessions, r.GameSessions, r.Rounds)
+		}
+		if r.Nets["miles"] != -100 || r.Nets["bill"] != 40 || r.Nets["jane"] != 60 {
+			t.Errorf("got nets %v", r.Nets)
+		}
+	})
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertErrContains(t testing.TB, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("got no error, want %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want it to contain %q", err, want)
+	}
+}
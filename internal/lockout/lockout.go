@@ -0,0 +1,146 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// FreeAttempts is the number of failures allowed before any delay is imposed.
+	FreeAttempts int
+	// BaseDelay is doubled for every failure after FreeAttempts, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures the key is locked for LockFor.
+	LockAfter int
+	LockFor   time.Duration
+	// ForgetAfter is how long a key must be idle before its failures are dropped.
+	ForgetAfter time.Duration
+}
+
+var DefaultConfig = Config{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	LockAfter:    10,
+	LockFor:      15 * time.Minute,
+	ForgetAfter:  time.Hour,
+}
+
+const pruneThreshold = 1024
+
+type entry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+type Tracker struct {
+	mu      sync.Mutex
+	cfg     Config
+	now     func() time.Time
+	entries map[string]*entry
+}
+
+func New(cfg Config, now func() time.Time) *Tracker {
+	if now == nil {
+		now = time.Now
+	}
+	return &Tracker{cfg: cfg, now: now, entries: map[string]*entry{}}
+}
+
+// Check returns how long the caller must wait before
+// another attempt is allowed for any of the given keys.
+func (t *Tracker) Check(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var wait time.Duration
+	for _, k := range keys {
+		e, ok := t.entries[k]
+		if !ok {
+			continue
+		}
+		if t.forgettable(e, now) {
+			delete(t.entries, k)
+			continue
+		}
+		if d := e.until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Fail records a failed attempt for every key and
+// returns the longest wait imposed as a result.
+func (t *Tracker) Fail(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if len(t.entries) > pruneThreshold {
+		t.prune(now)
+	}
+	var wait time.Duration
+	for _, k := range keys {
+		e, ok := t.entries[k]
+		if !ok || t.forgettable(e, now) {
+			e = &entry{}
+			t.entries[k] = e
+		}
+		e.failures++
+		e.last = now
+		e.until = now.Add(t.delay(e.failures))
+		if d := e.until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (t *Tracker) Reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, k := range keys {
+		delete(t.entries, k)
+	}
+}
+
+func (t *Tracker) Failures(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok || t.forgettable(e, t.now()) {
+		return 0
+	}
+	return e.failures
+}
+
+func (t *Tracker) delay(failures int) time.Duration {
+	if failures >= t.cfg.LockAfter {
+		return t.cfg.LockFor
+	}
+	if failures <= t.cfg.FreeAttempts {
+		return 0
+	}
+	d := t.cfg.BaseDelay
+	for i := t.cfg.FreeAttempts + 1; i < failures; i++ {
+		d *= 2
+		if d >= t.cfg.MaxDelay {
+			return t.cfg.MaxDelay
+		}
+	}
+	return d
+}
+
+func (t *Tracker) forgettable(e *entry, now time.Time) bool {
+	return now.After(e.until) && now.Sub(e.last) > t.cfg.ForgetAfter
+}
+
+func (t *Tracker) prune(now time.Time) {
+	for k, e := range t.entries {
+		if t.forgettable(e, now) {
+			delete(t.entries, k)
+		}
+	}
+}
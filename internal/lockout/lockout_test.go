@@ -0,0 +1,98 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTracker() (*Tracker, *clock) {
+	c := &clock{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return New(DefaultConfig, c.now), c
+}
+
+func TestFreeAttempts(t *testing.T) {
+	t.Run("no delay before free attempts are used", func(t *testing.T) {
+		tr, _ := newTracker()
+		for i := 0; i < DefaultConfig.FreeAttempts; i++ {
+			assertDuration(t, tr.Fail("user:bob"), 0)
+		}
+		assertDuration(t, tr.Check("user:bob"), 0)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	t.Run("delay doubles after free attempts", func(t *testing.T) {
+		tr, c := newTracker()
+		for i := 0; i < DefaultConfig.FreeAttempts; i++ {
+			tr.Fail("user:bob")
+		}
+		assertDuration(t, tr.Fail("user:bob"), time.Second)
+		assertDuration(t, tr.Check("user:bob"), time.Second)
+		c.advance(time.Second)
+		assertDuration(t, tr.Check("user:bob"), 0)
+		assertDuration(t, tr.Fail("user:bob"), 2*time.Second)
+		assertDuration(t, tr.Fail("user:bob"), 4*time.Second)
+	})
+
+	t.Run("longest wait across keys is returned", func(t *testing.T) {
+		tr, _ := newTracker()
+		for i := 0; i < DefaultConfig.FreeAttempts+2; i++ {
+			tr.Fail("ip:1.2.3.4")
+		}
+		tr.Fail("user:bob")
+		assertDuration(t, tr.Check("user:bob", "ip:1.2.3.4"), 2*time.Second)
+	})
+}
+
+func TestLockout(t *testing.T) {
+	t.Run("key is locked after too many failures", func(t *testing.T) {
+		tr, c := newTracker()
+		var wait time.Duration
+		for i := 0; i < DefaultConfig.LockAfter; i++ {
+			wait = tr.Fail("user:bob")
+		}
+		assertDuration(t, wait, DefaultConfig.LockFor)
+		c.advance(DefaultConfig.LockFor - time.Minute)
+		assertDuration(t, tr.Check("user:bob"), time.Minute)
+	})
+
+	t.Run("failures are forgotten after idle period", func(t *testing.T) {
+		tr, c := newTracker()
+		for i := 0; i < DefaultConfig.LockAfter; i++ {
+			tr.Fail("user:bob")
+		}
+		c.advance(DefaultConfig.LockFor + DefaultConfig.ForgetAfter)
+		assertDuration(t, tr.Check("user:bob"), 0)
+		if got := tr.Failures("user:bob"); got != 0 {
+			t.Errorf("got %d failures want 0", got)
+		}
+	})
+
+	t.Run("reset clears key", func(t *testing.T) {
+		tr, _ := newTracker()
+		for i := 0; i < DefaultConfig.LockAfter; i++ {
+			tr.Fail("user:bob")
+		}
+		tr.Reset("user:bob")
+		assertDuration(t, tr.Check("user:bob"), 0)
+	})
+}
+
+func assertDuration(t testing.TB, got time.Duration, expected time.Duration) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %s want %s", got, expected)
+	}
+}
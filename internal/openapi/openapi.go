@@ -0,0 +1,197 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Security   []Requirement        `json:"security,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+	schemas    *Schemas
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Requirement maps the name of a security scheme to its scopes.
+type Requirement map[string][]string
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	Name   string `json:"name,omitempty"`
+	In     string `json:"in,omitempty"`
+}
+
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+type Operation struct {
+	Tags        []string            `json:"tags,omitempty"`
+	Summary     string              `json:"summary,omitempty"`
+	OperationID string              `json:"operationId,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security overrides the document security, an empty list makes it public.
+	Security *[]Requirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func New(info Info) *Document {
+	s := NewSchemas()
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: s.Components},
+		schemas:    s,
+	}
+}
+
+// Schema is the schema of v, named types are added to the components.
+func (d *Document) Schema(v any) *Schema {
+	return d.schemas.Of(v)
+}
+
+// Add adds op to path, path parameters are added as required ids.
+func (d *Document) Add(method string, path string, op Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append([]Parameter{{
+			Name: m[1], In: "path", Required: true,
+			Schema: &Schema{Type: "integer", Minimum: ptr(1)},
+		}}, op.Parameters...)
+	}
+	if op.OperationID == "" {
+		op.OperationID = operationID(method, path)
+	}
+	switch strings.ToUpper(method) {
+	case "GET":
+		item.Get = &op
+	case "POST":
+		item.Post = &op
+	case "PUT":
+		item.Put = &op
+	case "PATCH":
+		item.Patch = &op
+	case "DELETE":
+		item.Delete = &op
+	default:
+		panic(fmt.Sprintf("openapi: unsupported method %q", method))
+	}
+}
+
+// Has reports if an operation exists for method and path.
+func (d *Document) Has(method string, path string) bool {
+	item, ok := d.Paths[path]
+	if !ok {
+		return false
+	}
+	for m, op := range item.operations() {
+		if m == strings.ToUpper(method) {
+			return op != nil
+		}
+	}
+	return false
+}
+
+// Routes are the method and path of every operation, sorted by path.
+func (d *Document) Routes() []string {
+	var routes []string
+	for path, item := range d.Paths {
+		for m, op := range item.operations() {
+			if op != nil {
+				routes = append(routes, m+" "+path)
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	return map[string]*Operation{
+		"GET": p.Get, "POST": p.Post, "PUT": p.Put,
+		"PATCH": p.Patch, "DELETE": p.Delete,
+	}
+}
+
+// JSON is a json request body or response content of schema.
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func operationID(method string, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '{' || r == '}'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testID uint
+
+type testBase struct {
+	ID      testID     `json:"id"`
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended"`
+}
+
+type testChild struct {
+	Name string `json:"name"`
+}
+
+type testShared[T any] struct {
+	Value T `json:"value"`
+}
+
+type testParent struct {
+	testBase
+	Children []testChild            `json:"children"`
+	Owner    *testChild             `json:"owner,omitempty"`
+	Result   map[testID]map[int]int `json:"result"`
+	Secret   string                 `json:"-"`
+	private  string
+}
+
+func TestSchemas(t *testing.T) {
+	t.Run("flattens embedded structs and follows json tags", func(t *testing.T) {
+		s := NewSchemas()
+		assertString(t, s.Of(testParent{}).Ref, "#/components/schemas/testParent")
+		p := s.Components["testParent"]
+		assertJSON(t, p.Required, `["id","started","ended","children","result"]`)
+		assertJSON(t, p.Properties["id"], `{"type":"integer","minimum":0}`)
+		assertJSON(t, p.Properties["started"], `{"type":"string","format":"date-time"}`)
+		assertJSON(t, p.Properties["ended"], `{"type":"string","format":"date-time","nullable":true}`)
+		assertJSON(t, p.Properties["owner"], `{"nullable":true,"allOf":[{"$ref":"#/components/schemas/testChild"}]}`)
+		assertJSON(t, p.Properties["result"], `{"type":"object","additionalProperties":`+
+			`{"type":"object","additionalProperties":{"type":"integer"}}}`)
+		if len(p.Properties) != 6 {
+			t.Errorf("got %d properties want 6", len(p.Properties))
+		}
+	})
+
+	t.Run("references named structs once", func(t *testing.T) {
+		s := NewSchemas()
+		s.Of([]testChild{})
+		s.Of(testParent{})
+		assertJSON(t, s.Components["testChild"], `{"type":"object","properties":`+
+			`{"name":{"type":"string"}},"required":["name"]}`)
+		if len(s.Components) != 2 {
+			t.Errorf("got %d components want 2", len(s.Components))
+		}
+	})
+
+	t.Run("names generic types after their arguments", func(t *testing.T) {
+		s := NewSchemas()
+		s.Of(testShared[testChild]{})
+		if _, ok := s.Components["testSharedtestChild"]; !ok {
+			t.Errorf("got components %v", s.Components)
+		}
+	})
+
+	t.Run("nil has no schema", func(t *testing.T) {
+		if s := NewSchemas().Of(nil); s != nil {
+			t.Errorf("got %v want nil", s)
+		}
+	})
+}
+
+func TestDocument(t *testing.T) {
+	t.Run("adds path parameters and operation ids", func(t *testing.T) {
+		d := New(Info{Title: "test", Version: "1"})
+		d.Add("POST", "/game-session/{id}/end", Operation{Responses: map[string]Response{}})
+		op := d.Paths["/game-session/{id}/end"].Post
+		assertString(t, op.OperationID, "postGameSessionIdEnd")
+		assertJSON(t, op.Parameters, `[{"name":"id","in":"path","required":true,`+
+			`"schema":{"type":"integer","minimum":1}}]`)
+	})
+
+	t.Run("lists its routes", func(t *testing.T) {
+		d := New(Info{Title: "test", Version: "1"})
+		d.Add("GET", "/session", Operation{})
+		d.Add("DELETE", "/session/{id}", Operation{})
+		d.Add("GET", "/session/{id}", Operation{})
+		assertJSON(t, d.Routes(), `["DELETE /session/{id}","GET /session","GET /session/{id}"]`)
+		if !d.Has("delete", "/session/{id}") || d.Has("POST", "/session") {
+			t.Error("got wrong routes")
+		}
+	})
+}
+
+func assertString(t testing.TB, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
+
+func assertJSON(t testing.TB, v any, expected string) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if string(b) != expected {
+		t.Errorf("got %s want %s", b, expected)
+	}
+}
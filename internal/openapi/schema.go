@@ -0,0 +1,160 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// Schemas derives schemas from go types the way encoding/json marshals them.
+// Named struct types become components and are referenced by name.
+type Schemas struct {
+	Components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func NewSchemas() *Schemas {
+	return &Schemas{
+		Components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// Of is the schema of the type of v, nil has no schema.
+func (s *Schemas) Of(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s *Schemas) of(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if schema.Ref != "" {
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: ptr(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return s.ref(t)
+	case reflect.Interface:
+		return &Schema{}
+	default:
+		panic(fmt.Sprintf("openapi: unsupported type %s", t))
+	}
+}
+
+func (s *Schemas) ref(t reflect.Type) *Schema {
+	name, ok := s.names[t]
+	if !ok {
+		name = s.name(t)
+		s.names[t] = name
+		// reserve the name before recursing into self-referencing types
+		s.Components[name] = nil
+		s.Components[name] = s.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// name is the name of t without type arguments and package paths,
+// prefixed with its package if the name is already taken.
+func (s *Schemas) name(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		args := strings.Split(name[i+1:len(name)-1], ",")
+		name = name[:i]
+		for _, arg := range args {
+			name += arg[strings.LastIndexByte(arg, '.')+1:]
+		}
+	}
+	if _, taken := s.Components[name]; taken {
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndexByte(pkg, '/')+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	return name
+}
+
+func (s *Schemas) object(t reflect.Type) *Schema {
+	o := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(o, t)
+	return o
+}
+
+func (s *Schemas) fields(o *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.fields(o, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		o.Properties[name] = s.of(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			o.Required = append(o.Required, name)
+		}
+	}
+}
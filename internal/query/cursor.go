@@ -0,0 +1,53 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Cursor positions a page relative to the row with Key and the Value it
+// had in the sort, so pages stay in place when that row is changed or
+// deleted. A nil Value is a NULL. The cursor is opaque to clients and
+// only valid for the sort it was created with.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Order  Order  `json:"o"`
+	Key    int64  `json:"k"`
+	Value  any    `json:"v"`
+	Before bool   `json:"b,omitempty"`
+}
+
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return c, err
+	}
+	if c.Key <= 0 {
+		return c, errors.New("cursor has no key")
+	}
+	switch v := c.Value.(type) {
+	case nil, string:
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			c.Value = i
+		} else if c.Value, err = v.Float64(); err != nil {
+			return c, err
+		}
+	default:
+		return c, errors.New("cursor has an invalid value")
+	}
+	return c, nil
+}
@@ -0,0 +1,74 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// ID filters by a positive id, cond must contain a single placeholder.
+func ID(cond string) Filter {
+	return func(name string, value string) (string, []any, error) {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return "", nil, fmt.Errorf("'%s' must be an id", name)
+		}
+		return cond, []any{id}, nil
+	}
+}
+
+// Time filters by a date or timestamp, cond must contain a single placeholder.
+// A date is extended to the end of the day if endOfDay is true.
+func Time(cond string, endOfDay bool) Filter {
+	return func(name string, value string) (string, []any, error) {
+		t, err := ParseTime(name, value, endOfDay)
+		if err != nil {
+			return "", nil, err
+		}
+		return cond, []any{t.Format(time.RFC3339)}, nil
+	}
+}
+
+// OneOf filters by the condition the value names.
+func OneOf(conds map[string]string) Filter {
+	return func(name string, value string) (string, []any, error) {
+		cond, ok := conds[value]
+		if !ok {
+			names := make([]string, 0, len(conds))
+			for n := range conds {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return "", nil, fmt.Errorf(
+				"'%s' must be one of %s", name, strings.Join(names, ", "))
+		}
+		return cond, nil, nil
+	}
+}
+
+// Contains filters by a substring, cond must contain a single placeholder
+// for a LIKE pattern that escapes with a backslash.
+func Contains(cond string) Filter {
+	escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return func(name string, value string) (string, []any, error) {
+		return cond, []any{"%" + escape.Replace(value) + "%"}, nil
+	}
+}
+
+func ParseTime(name string, value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("'%s' must be a date (YYYY-MM-DD) or RFC3339 timestamp", name)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
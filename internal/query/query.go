@@ -0,0 +1,404 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+)
+
+type Order string
+
+const (
+	Asc  Order = "asc"
+	Desc Order = "desc"
+)
+
+// Field is a sortable field and the sql expression it sorts by.
+type Field struct {
+	Name string
+	Expr string
+	// Dialects are the expressions of databases that spell Expr differently.
+	Dialects map[db.Dialect]string
+}
+
+// Filter turns the value of a query parameter into a
+// parameterised sql condition, an empty condition matches all rows.
+type Filter func(name string, value string) (string, []any, error)
+
+type Schema struct {
+	// Sorts are the whitelisted sort fields, the first is the default.
+	Sorts        []Field
+	DefaultOrder Order
+	Filters      map[string]Filter
+	// Defaults are used for filters missing from the query.
+	Defaults map[string]string
+	// Key is a unique column used to break ties and to position cursors.
+	Key string
+}
+
+type Spec struct {
+	Sort     string `json:"sort"`
+	Order    Order  `json:"order"`
+	P        *pagination.P
+	Cursor   *Cursor
+	expr     string
+	dialects map[db.Dialect]string
+	key      string
+	conds    []string
+	args     []any
+	filters  url.Values
+	raw      bool
+}
+
+// Default is the spec of the default sort without filters and pagination.
+func (s Schema) Default() Spec {
+	return s.spec(s.Sorts[0], s.DefaultOrder, nil)
+}
+
+func (s Schema) SortNames() []string {
+	names := make([]string, len(s.Sorts))
+	for i, f := range s.Sorts {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Parse validates the sort, order, cursor and filters found in values.
+// A cursor takes precedence over the offset of p.
+func (s Schema) Parse(values url.Values, p *pagination.P) (Spec, error) {
+	field := s.Sorts[0]
+	if v := values.Get("sort"); v != "" {
+		f, ok := s.field(v)
+		if !ok {
+			return Spec{}, fmt.Errorf(
+				"'sort' must be one of %s", strings.Join(s.SortNames(), ", "))
+		}
+		field = f
+	}
+	order := s.DefaultOrder
+	if v := values.Get("order"); v != "" {
+		if v != string(Asc) && v != string(Desc) {
+			return Spec{}, fmt.Errorf("'order' must be one of %s, %s", Asc, Desc)
+		}
+		order = Order(v)
+	}
+	spec := s.spec(field, order, p)
+	if err := spec.parseCursor(values); err != nil {
+		return Spec{}, err
+	}
+	names := make([]string, 0, len(s.Filters))
+	for name := range s.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := values.Get(name)
+		if v == "" {
+			v = s.Defaults[name]
+		}
+		if v == "" {
+			continue
+		}
+		if err := s.Filter(&spec, name, v); err != nil {
+			return Spec{}, err
+		}
+	}
+	return spec, nil
+}
+
+// Filter adds the filter name with value to spec,
+// as if value was found in the query.
+func (s Schema) Filter(spec *Spec, name string, value string) error {
+	f, ok := s.Filters[name]
+	if !ok {
+		return fmt.Errorf("'%s' is not a filter", name)
+	}
+	cond, args, err := f(name, value)
+	if err != nil {
+		return err
+	}
+	filters := url.Values{}
+	for n, vs := range spec.filters {
+		filters[n] = vs
+	}
+	filters[name] = append(filters[name][:len(filters[name]):len(filters[name])], value)
+	spec.filters = filters
+	if cond != "" {
+		spec.where(cond, args...)
+	}
+	return nil
+}
+
+func (s Schema) spec(f Field, o Order, p *pagination.P) Spec {
+	return Spec{
+		Sort: f.Name, Order: o, P: p,
+		expr: f.Expr, dialects: f.Dialects, key: s.Key,
+	}
+}
+
+func (s Schema) field(name string) (Field, bool) {
+	for _, f := range s.Sorts {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (s *Spec) parseCursor(values url.Values) error {
+	after, before := values.Get("after"), values.Get("before")
+	if after == "" && before == "" {
+		return nil
+	}
+	if after != "" && before != "" {
+		return errors.New("'after' and 'before' cannot be combined")
+	}
+	name, raw := "after", after
+	if before != "" {
+		name, raw = "before", before
+	}
+	c, err := ParseCursor(raw)
+	if err != nil || c.Before != (before != "") {
+		return fmt.Errorf("'%s' is not a valid cursor", name)
+	}
+	if c.Sort != s.Sort || c.Order != s.Order {
+		return fmt.Errorf("'%s' does not match the current sort", name)
+	}
+	s.Cursor = &c
+	if s.P != nil {
+		s.P.Offset = 0
+	}
+	return nil
+}
+
+// Where adds a condition that rows must match, only repositories
+// that run sql can match them. Copies of a spec never share conditions.
+func (s *Spec) Where(cond string, args ...any) {
+	s.where(cond, args...)
+	s.raw = true
+}
+
+func (s *Spec) where(cond string, args ...any) {
+	s.conds = append(s.conds[:len(s.conds):len(s.conds)], cond)
+	s.args = append(s.args[:len(s.args):len(s.args)], args...)
+}
+
+// Filters are the values of the filters of the spec by name.
+func (s Spec) Filters() url.Values {
+	filters := url.Values{}
+	for name, values := range s.filters {
+		filters[name] = append([]string{}, values...)
+	}
+	return filters
+}
+
+// Raw reports if conditions were added with Where.
+func (s Spec) Raw() bool {
+	return s.raw
+}
+
+// In is the spec with the sort expression of dialect d.
+func (s Spec) In(d db.Dialect) Spec {
+	if expr, ok := s.dialects[d]; ok {
+		s.expr = expr
+	}
+	return s
+}
+
+// Reversed reports if rows are selected in reverse order,
+// as they are when paging backwards from a cursor.
+func (s Spec) Reversed() bool {
+	return s.Cursor != nil && s.Cursor.Before
+}
+
+// Next is the cursor after the last row of a page with key and sort value.
+func (s Spec) Next(key int64, value any) Cursor {
+	return Cursor{Sort: s.Sort, Order: s.Order, Key: key, Value: value}
+}
+
+// Prev is the cursor before the first row of a page with key and sort value.
+func (s Spec) Prev(key int64, value any) Cursor {
+	return Cursor{Sort: s.Sort, Order: s.Order, Key: key, Value: value, Before: true}
+}
+
+// Select appends the conditions, cursor, order and pagination to base.
+// NULLs sort last in either order, and first when selected in reverse.
+func (s Spec) Select(base string) (string, []any) {
+	conds := s.conds
+	args := append([]any{}, s.args...)
+	desc := s.Order == Desc
+	if s.Reversed() {
+		desc = !desc
+	}
+	if s.Cursor != nil {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		cond, cargs := s.seek(op)
+		conds = append(conds[:len(conds):len(conds)], cond)
+		args = append(args, cargs...)
+	}
+	q := where(base, conds)
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	nulls := "LAST"
+	if s.Reversed() {
+		nulls = "FIRST"
+	}
+	order := []string{fmt.Sprintf("%s %s NULLS %s", s.expr, dir, nulls)}
+	if s.key != "" {
+		order = append(order, fmt.Sprintf("%s %s", s.key, dir))
+	}
+	q = fmt.Sprintf("%s ORDER BY %s", q, strings.Join(order, ", "))
+	if s.P != nil {
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, s.P.Limit, s.P.Offset)
+	}
+	return q, args
+}
+
+// seek is the condition of the rows after the cursor in the order they are
+// selected in, op compares in that order. The rows with a NULL value come
+// after all others, or before them when selected in reverse.
+func (s Spec) seek(op string) (string, []any) {
+	c := s.Cursor
+	if c.Value == nil {
+		if c.Before {
+			return fmt.Sprintf("(%s IS NOT NULL OR %s %s ?)", s.expr, s.key, op), []any{c.Key}
+		}
+		return fmt.Sprintf("(%s IS NULL AND %s %s ?)", s.expr, s.key, op), []any{c.Key}
+	}
+	cond := fmt.Sprintf("%[1]s %[3]s ? OR (%[1]s = ? AND %[2]s %[3]s ?)", s.expr, s.key, op)
+	if !c.Before {
+		cond += fmt.Sprintf(" OR %s IS NULL", s.expr)
+	}
+	return "(" + cond + ")", []any{c.Value, c.Value, c.Key}
+}
+
+// Count appends only the conditions to base.
+func (s Spec) Count(base string) (string, []any) {
+	return where(base, s.conds), append([]any{}, s.args...)
+}
+
+// Values are the sort values of rows of T by the name of the sort,
+// they must equal those of the sort expressions for cursors to hold.
+type Values[T any] map[string]func(T) any
+
+// For is the value of rows in the sort of s.
+func (v Values[T]) For(s Spec) func(T) any {
+	if f, ok := v[s.Sort]; ok {
+		return f
+	}
+	return func(T) any { return nil }
+}
+
+// Sort orders rows like Select does, by the sort value and key of every
+// row, and keeps the rows of the page after or before the cursor. It is
+// for repositories that do not run sql, rows must match the conditions.
+func Sort[T any](s Spec, rows []T, key func(T) int64, value func(T) any) []T {
+	cmp := func(a T, bKey int64, bValue any) int {
+		av := value(a)
+		c := 0
+		switch {
+		case av == nil && bValue == nil:
+		case av == nil:
+			return 1
+		case bValue == nil:
+			return -1
+		default:
+			c = compare(av, bValue)
+		}
+		if c == 0 {
+			c = compare(key(a), bKey)
+		}
+		if s.Order == Desc {
+			c = -c
+		}
+		return c
+	}
+	rows = append([]T{}, rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return cmp(rows[i], key(rows[j]), value(rows[j])) < 0
+	})
+	if s.Cursor != nil {
+		page := rows[:0]
+		for _, row := range rows {
+			c := cmp(row, s.Cursor.Key, s.Cursor.Value)
+			if (s.Cursor.Before && c < 0) || (!s.Cursor.Before && c > 0) {
+				page = append(page, row)
+			}
+		}
+		rows = page
+	}
+	if s.P == nil {
+		return rows
+	}
+	if s.Reversed() {
+		if s.P.Limit >= 0 && s.P.Limit < len(rows) {
+			rows = rows[len(rows)-s.P.Limit:]
+		}
+		return rows
+	}
+	if s.P.Offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[s.P.Offset:]
+	if s.P.Limit >= 0 && s.P.Limit < len(rows) {
+		rows = rows[:s.P.Limit]
+	}
+	return rows
+}
+
+// compare orders numbers by value and anything else by its text.
+func compare(a any, b any) int {
+	x, okA := number(a)
+	y, okB := number(b)
+	if okA && okB {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Ordered restores the order of rows selected in reverse.
+func Ordered[T any](s Spec, rows []T) []T {
+	if !s.Reversed() {
+		return rows
+	}
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows
+}
+
+func where(base string, conds []string) string {
+	if len(conds) == 0 {
+		return base
+	}
+	return fmt.Sprintf("%s WHERE %s", base, strings.Join(conds, " AND "))
+}
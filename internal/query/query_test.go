@@ -0,0 +1,279 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+)
+
+var testSchema = Schema{
+	Sorts: []Field{
+		{Name: "ended", Expr: "s.ended"},
+		{Name: "games", Expr: "(SELECT COUNT(*) FROM game_session g WHERE g.session_id = s.id)"},
+		{Name: "duration", Expr: "julianday(s.ended) - julianday(s.started)", Dialects: map[db.Dialect]string{
+			db.Postgres: "EXTRACT(EPOCH FROM (s.ended - s.started))",
+		}},
+	},
+	DefaultOrder: Desc,
+	Filters: map[string]Filter{
+		"game":  ID("EXISTS (SELECT 1 FROM game_session g WHERE g.session_id = s.id AND g.game_id = ?)"),
+		"from":  Time("s.started >= ?", false),
+		"to":    Time("s.started <= ?", true),
+		"state": OneOf(map[string]string{"active": "s.ended IS NULL", "ended": "s.ended IS NOT NULL", "all": ""}),
+		"name":  Contains("s.name LIKE ? ESCAPE '\\'"),
+	},
+	Defaults: map[string]string{"state": "ended"},
+	Key:      "s.id",
+}
+
+func TestParse(t *testing.T) {
+	t.Run("defaults without values", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{}, nil)
+		assertNoError(t, err)
+		got, args := spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE s.ended IS NOT NULL ORDER BY s.ended DESC NULLS LAST, s.id DESC")
+		assertArgs(t, args)
+	})
+
+	t.Run("filters can match all rows", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, _ := spec.Count("SELECT COUNT(*) FROM session s")
+		assertString(t, got, "SELECT COUNT(*) FROM session s")
+	})
+
+	t.Run("whitelists sort and order", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"sort": {"games"}, "order": {"asc"}}, nil)
+		assertNoError(t, err)
+		assertString(t, spec.Sort, "games")
+		assertString(t, string(spec.Order), "asc")
+		_, err = testSchema.Parse(url.Values{"sort": {"s.id; DROP TABLE user"}}, nil)
+		assertError(t, err)
+		_, err = testSchema.Parse(url.Values{"order": {"sideways"}}, nil)
+		assertError(t, err)
+	})
+
+	t.Run("parameterises filters and pagination", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{
+			"game":  {"2"},
+			"state": {"ended"},
+			"from":  {"2024-01-01"},
+			"to":    {"2024-01-31"},
+		}, pagination.New(10, 20))
+		assertNoError(t, err)
+		got, args := spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE "+
+			"s.started >= ? AND "+
+			"EXISTS (SELECT 1 FROM game_session g WHERE g.session_id = s.id AND g.game_id = ?) AND "+
+			"s.ended IS NOT NULL AND "+
+			"s.started <= ? "+
+			"ORDER BY s.ended DESC NULLS LAST, s.id DESC LIMIT ? OFFSET ?")
+		assertArgs(t, args, "2024-01-01T00:00:00Z", 2, "2024-01-31T23:59:59Z", 10, 20)
+	})
+
+	t.Run("counts without order and pagination", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"state": {"active"}}, pagination.New(10, 0))
+		assertNoError(t, err)
+		got, args := spec.Count("SELECT COUNT(*) FROM session s")
+		assertString(t, got, "SELECT COUNT(*) FROM session s WHERE s.ended IS NULL")
+		assertArgs(t, args)
+	})
+
+	t.Run("rejects malformed filters", func(t *testing.T) {
+		for _, v := range []url.Values{
+			{"game": {"abc"}},
+			{"game": {"-1"}},
+			{"from": {"yesterday"}},
+			{"state": {"paused"}},
+		} {
+			_, err := testSchema.Parse(v, nil)
+			assertError(t, err)
+		}
+	})
+
+	t.Run("positions pages after a cursor", func(t *testing.T) {
+		spec := testSchema.Default()
+		after := spec.Next(7, "2024-01-02T00:00:00Z").String()
+		spec, err := testSchema.Parse(url.Values{"after": {after}}, pagination.New(10, 30))
+		assertNoError(t, err)
+		got, args := spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE s.ended IS NOT NULL AND "+
+			"(s.ended < ? OR (s.ended = ? AND s.id < ?) OR s.ended IS NULL) "+
+			"ORDER BY s.ended DESC NULLS LAST, s.id DESC LIMIT ? OFFSET ?")
+		assertArgs(t, args, "2024-01-02T00:00:00Z", "2024-01-02T00:00:00Z", int64(7), 10, 0)
+		count, _ := spec.Count("SELECT COUNT(*) FROM session s")
+		assertString(t, count, "SELECT COUNT(*) FROM session s WHERE s.ended IS NOT NULL")
+	})
+
+	t.Run("reverses pages before a cursor", func(t *testing.T) {
+		before := testSchema.Default().Prev(7, "2024-01-02T00:00:00Z").String()
+		spec, err := testSchema.Parse(url.Values{"before": {before}, "state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, _ := spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE "+
+			"(s.ended > ? OR (s.ended = ? AND s.id > ?)) "+
+			"ORDER BY s.ended ASC NULLS FIRST, s.id ASC")
+		rows := Ordered(spec, []int{3, 2, 1})
+		assertArgs(t, []any{rows[0], rows[1], rows[2]}, 1, 2, 3)
+	})
+
+	t.Run("rejects foreign cursors", func(t *testing.T) {
+		games := Spec{Sort: "games", Order: Desc}
+		for _, v := range []url.Values{
+			{"after": {"bm90IGEgY3Vyc29y"}},
+			{"after": {games.Next(7, int64(3)).String()}},
+			{"after": {testSchema.Default().Prev(7, nil).String()}},
+			{"after": {testSchema.Default().Next(7, nil).String()}, "order": {"asc"}},
+			{"after": {"a"}, "before": {"b"}},
+		} {
+			_, err := testSchema.Parse(v, nil)
+			assertError(t, err)
+		}
+	})
+
+	t.Run("positions pages around rows without a value", func(t *testing.T) {
+		after := testSchema.Default().Next(7, nil).String()
+		spec, err := testSchema.Parse(url.Values{"after": {after}, "state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, args := spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE (s.ended IS NULL AND s.id < ?) "+
+			"ORDER BY s.ended DESC NULLS LAST, s.id DESC")
+		assertArgs(t, args, int64(7))
+		before := testSchema.Default().Prev(7, nil).String()
+		spec, err = testSchema.Parse(url.Values{"before": {before}, "state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, _ = spec.Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s WHERE (s.ended IS NOT NULL OR s.id > ?) "+
+			"ORDER BY s.ended ASC NULLS FIRST, s.id ASC")
+	})
+
+	t.Run("keeps the value of the cursor", func(t *testing.T) {
+		games := Spec{Sort: "games", Order: Desc}
+		for _, value := range []any{nil, "2024-01-02T00:00:00Z", int64(3), 1.5} {
+			c, err := ParseCursor(games.Next(7, value).String())
+			assertNoError(t, err)
+			if c.Value != value {
+				t.Errorf("got value %#v want %#v", c.Value, value)
+			}
+		}
+	})
+
+	t.Run("keeps conditions added by the caller", func(t *testing.T) {
+		spec := testSchema.Default()
+		spec.Where("s.id != ?", 4)
+		got, args := spec.Count("SELECT COUNT(*) FROM session s")
+		assertString(t, got, "SELECT COUNT(*) FROM session s WHERE s.id != ?")
+		assertArgs(t, args, 4)
+	})
+}
+
+func TestDialects(t *testing.T) {
+	t.Run("sorts by the expression of the dialect", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"sort": {"duration"}, "state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, _ := spec.In(db.Postgres).Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s ORDER BY EXTRACT(EPOCH FROM (s.ended - s.started)) DESC NULLS LAST, s.id DESC")
+		got, _ = spec.In(db.SQLite).Select("SELECT * FROM session s")
+		assertString(t, got, "SELECT * FROM session s ORDER BY julianday(s.ended) - julianday(s.started) DESC NULLS LAST, s.id DESC")
+	})
+}
+
+func TestContains(t *testing.T) {
+	t.Run("escapes like patterns", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"name": {`50%_off\`}, "state": {"all"}}, nil)
+		assertNoError(t, err)
+		got, args := spec.Count("SELECT COUNT(*) FROM session s")
+		assertString(t, got, `SELECT COUNT(*) FROM session s WHERE s.name LIKE ? ESCAPE '\'`)
+		assertArgs(t, args, `%50\%\_off\\%`)
+	})
+}
+
+func TestSort(t *testing.T) {
+	type row struct {
+		id    int64
+		ended any
+	}
+	rows := []row{{1, "2024-01-02"}, {2, nil}, {3, "2024-01-03"}, {4, "2024-01-02"}}
+	key := func(r row) int64 { return r.id }
+	value := func(r row) any { return r.ended }
+	ids := func(rows []row) []any {
+		ids := []any{}
+		for _, r := range rows {
+			ids = append(ids, r.id)
+		}
+		return ids
+	}
+
+	t.Run("orders like sql with NULLs last", func(t *testing.T) {
+		spec := testSchema.Default()
+		assertArgs(t, ids(Sort(spec, rows, key, value)), int64(3), int64(4), int64(1), int64(2))
+		spec, err := testSchema.Parse(url.Values{"order": {"asc"}}, nil)
+		assertNoError(t, err)
+		assertArgs(t, ids(Sort(spec, rows, key, value)), int64(1), int64(4), int64(3), int64(2))
+	})
+
+	t.Run("keeps the page around a cursor", func(t *testing.T) {
+		spec := testSchema.Default()
+		after := spec.Next(4, "2024-01-02").String()
+		spec, err := testSchema.Parse(url.Values{"after": {after}}, pagination.New(1, 0))
+		assertNoError(t, err)
+		assertArgs(t, ids(Sort(spec, rows, key, value)), int64(1))
+		before := testSchema.Default().Prev(2, nil).String()
+		spec, err = testSchema.Parse(url.Values{"before": {before}}, pagination.New(2, 0))
+		assertNoError(t, err)
+		assertArgs(t, ids(Sort(spec, rows, key, value)), int64(4), int64(1))
+	})
+}
+
+func TestFilter(t *testing.T) {
+	t.Run("keeps the values of filters", func(t *testing.T) {
+		spec, err := testSchema.Parse(url.Values{"game": {"2"}}, nil)
+		assertNoError(t, err)
+		assertNoError(t, testSchema.Filter(&spec, "game", "3"))
+		assertError(t, testSchema.Filter(&spec, "player", "3"))
+		filters := spec.Filters()
+		assertArgs(t, []any{filters.Get("state"), len(filters["game"])}, "ended", 2)
+		if spec.Raw() {
+			t.Error("got raw conditions")
+		}
+		spec.Where("s.id != ?", 4)
+		if !spec.Raw() {
+			t.Error("got no raw conditions")
+		}
+	})
+}
+
+func assertString(t testing.TB, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
+
+func assertArgs(t testing.TB, got []any, expected ...any) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("got %d args %v want %d args %v", len(got), got, len(expected), expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("arg %d: got %v want %v", i, got[i], expected[i])
+		}
+	}
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertError(t testing.TB, err error) {
+	t.Helper()
+	if err == nil {
+		t.Error("got no error")
+	}
+}
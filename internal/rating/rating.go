@@ -0,0 +1,76 @@
+package rating
+
+import (
+	"math"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+const (
+	Initial = 1000.0
+	K       = 32.0
+)
+
+// Expected is the probability of a rated a beating b.
+func Expected(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Placements ranks participants of a round, the winner
+// is placed first and everybody else ties for second.
+func Placements(participants []db.ID, winner db.ID) map[db.ID]int {
+	p := make(map[db.ID]int, len(participants))
+	for _, id := range participants {
+		if id == winner {
+			p[id] = 1
+		} else {
+			p[id] = 2
+		}
+	}
+	return p
+}
+
+// Update treats a multiplayer outcome as a set of pairwise games where a
+// lower placement beats a higher one and equal placements draw. K is scaled
+// by the number of opponents so a round moves ratings as much as a duel does.
+// Participants missing from ratings start at Initial.
+func Update(ratings map[db.ID]float64, placements map[db.ID]int) map[db.ID]float64 {
+	updated := make(map[db.ID]float64, len(placements))
+	if len(placements) < 2 {
+		for id := range placements {
+			updated[id] = current(ratings, id)
+		}
+		return updated
+	}
+	k := K / float64(len(placements)-1)
+	for id, place := range placements {
+		r := current(ratings, id)
+		delta := 0.0
+		for oid, oplace := range placements {
+			if oid == id {
+				continue
+			}
+			delta += k * (score(place, oplace) - Expected(r, current(ratings, oid)))
+		}
+		updated[id] = r + delta
+	}
+	return updated
+}
+
+func current(ratings map[db.ID]float64, id db.ID) float64 {
+	if r, ok := ratings[id]; ok {
+		return r
+	}
+	return Initial
+}
+
+func score(place int, other int) float64 {
+	switch {
+	case place < other:
+		return 1
+	case place > other:
+		return 0
+	default:
+		return 0.5
+	}
+}
@@ -0,0 +1,58 @@
+package rating
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+func TestExpected(t *testing.T) {
+	t.Run("equal ratings are even", func(t *testing.T) {
+		assertFloat(t, Expected(1000, 1000), 0.5)
+	})
+
+	t.Run("400 points is ten to one", func(t *testing.T) {
+		assertFloat(t, Expected(1400, 1000), 10.0/11.0)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("duel between new players", func(t *testing.T) {
+		got := Update(map[db.ID]float64{}, Placements([]db.ID{1, 2}, 1))
+		assertFloat(t, got[1], Initial+K/2)
+		assertFloat(t, got[2], Initial-K/2)
+	})
+
+	t.Run("multiplayer round is zero sum", func(t *testing.T) {
+		ratings := map[db.ID]float64{1: 1100, 2: 950, 3: 1000}
+		got := Update(ratings, Placements([]db.ID{1, 2, 3}, 2))
+		sum := 0.0
+		for id, r := range got {
+			sum += r - ratings[id]
+		}
+		assertFloat(t, sum, 0)
+		if got[2] <= ratings[2] {
+			t.Errorf("expected winner to gain rating, got %f", got[2])
+		}
+		if got[1] >= ratings[1] {
+			t.Errorf("expected favourite to lose rating, got %f", got[1])
+		}
+	})
+
+	t.Run("upset gains more than expected win", func(t *testing.T) {
+		ratings := map[db.ID]float64{1: 1200, 2: 1000}
+		upset := Update(ratings, Placements([]db.ID{1, 2}, 2))[2] - ratings[2]
+		expected := Update(ratings, Placements([]db.ID{1, 2}, 1))[1] - ratings[1]
+		if upset <= expected {
+			t.Errorf("expected upset gain %f to exceed %f", upset, expected)
+		}
+	})
+}
+
+func assertFloat(t testing.TB, got float64, expected float64) {
+	t.Helper()
+	if math.Abs(got-expected) > 1e-9 {
+		t.Errorf("got %f want %f", got, expected)
+	}
+}
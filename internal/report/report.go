@@ -0,0 +1,194 @@
+// Package report summarises a session for sharing, with the rounds of
+// every game, what each person nets and the transfers that settle it.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
+)
+
+const timeLayout = "2006-01-02 15:04"
+
+type Report struct {
+	ID        db.ID
+	Started   time.Time
+	Ended     *time.Time
+	Duration  time.Duration
+	People    []string
+	Games     []Game
+	Wagered   int
+	Nets      []Net
+	Transfers []Transfer
+}
+
+// Game is a game session with its ended rounds in the order they were played.
+type Game struct {
+	ID      db.ID
+	Name    string
+	Started time.Time
+	Ended   *time.Time
+	Rounds  []Round
+	Wagered int
+}
+
+type Round struct {
+	Round  int
+	Wager  int
+	Winner string
+}
+
+type Net struct {
+	Name string
+	Net  int
+}
+
+type Transfer struct {
+	From   string
+	To     string
+	Amount int
+}
+
+type nameable interface {
+	ResultID() db.ID
+	ResultName() string
+}
+
+// New is the report of s. The nets of an active session
+// only include the game sessions that have ended.
+func New(s services.SessionWithGames, users []services.User, games []services.Game, now time.Time) Report {
+	r := Report{
+		ID:       s.ID,
+		Started:  s.Started,
+		Ended:    s.Ended,
+		Duration: stats.Elapsed(s.Started, s.Ended, now),
+	}
+	for _, id := range s.Users {
+		name := nameFromID(id, users)
+		r.People = append(r.People, name)
+		r.Nets = append(r.Nets, Net{Name: name, Net: s.Result.Net(id)})
+	}
+	gs := append([]services.GameSession{}, s.GameSessions...)
+	sort.Slice(gs, func(i, j int) bool { return gs[i].ID < gs[j].ID })
+	for _, g := range gs {
+		game := Game{ID: g.ID, Name: nameFromID(g.GameID, games), Started: g.Started, Ended: g.Ended}
+		rounds := append(services.GameSessionRounds{}, g.Rounds...)
+		sort.Slice(rounds, func(i, j int) bool { return rounds[i].Round < rounds[j].Round })
+		for _, gr := range rounds {
+			if gr.Active == 1 {
+				continue
+			}
+			winner := ""
+			if id, ok := gr.Result.Winner(); ok {
+				winner = nameFromID(id, users)
+			}
+			game.Rounds = append(game.Rounds, Round{Round: gr.Round, Wager: gr.Wager, Winner: winner})
+			game.Wagered += gr.Wager
+		}
+		r.Wagered += game.Wagered
+		r.Games = append(r.Games, game)
+	}
+	r.Transfers = Settle(r.Nets)
+	return r
+}
+
+// Settle pays the largest debts to the largest credits until every
+// net is settled, which takes at most one transfer less than the
+// number of people owing or owed.
+func Settle(nets []Net) []Transfer {
+	var owing, owed []Net
+	for _, n := range nets {
+		switch {
+		case n.Net < 0:
+			owing = append(owing, Net{n.Name, -n.Net})
+		case n.Net > 0:
+			owed = append(owed, n)
+		}
+	}
+	largest := func(n []Net) {
+		sort.SliceStable(n, func(i, j int) bool { return n[i].Net > n[j].Net })
+	}
+	largest(owing)
+	largest(owed)
+	transfers := []Transfer{}
+	for i, j := 0, 0; i < len(owing) && j < len(owed); {
+		amount := owing[i].Net
+		if owed[j].Net < amount {
+			amount = owed[j].Net
+		}
+		transfers = append(transfers, Transfer{From: owing[i].Name, To: owed[j].Name, Amount: amount})
+		owing[i].Net -= amount
+		owed[j].Net -= amount
+		if owing[i].Net == 0 {
+			i++
+		}
+		if owed[j].Net == 0 {
+			j++
+		}
+	}
+	return transfers
+}
+
+// Markdown is the report as plain text, for pasting into chat.
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session #%d\n\n", r.ID)
+	fmt.Fprintf(&b, "%s, %s\n\n", r.Span(), r.Duration)
+	fmt.Fprintf(&b, "Participants: %s\n\n", strings.Join(r.People, ", "))
+	for _, g := range r.Games {
+		fmt.Fprintf(&b, "## %s (#%d)\n\n", g.Name, g.ID)
+		if len(g.Rounds) == 0 {
+			b.WriteString("No rounds ended.\n\n")
+			continue
+		}
+		b.WriteString("| Round | Wager | Winner |\n|---:|---:|---|\n")
+		for _, gr := range g.Rounds {
+			fmt.Fprintf(&b, "| %d | %d | %s |\n", gr.Round, gr.Wager, gr.Winner)
+		}
+		fmt.Fprintf(&b, "\nTotal wagered: %d\n\n", g.Wagered)
+	}
+	fmt.Fprintf(&b, "## Result\n\nTotal wagered: %d\n\n", r.Wagered)
+	b.WriteString("| Person | Net |\n|---|---:|\n")
+	for _, n := range r.Nets {
+		fmt.Fprintf(&b, "| %s | %s |\n", n.Name, n.Signed())
+	}
+	b.WriteString("\n## Settlement\n\n")
+	if len(r.Transfers) == 0 {
+		b.WriteString("Nobody owes anything.\n")
+	}
+	for _, t := range r.Transfers {
+		fmt.Fprintf(&b, "- %s pays %s %d\n", t.From, t.To, t.Amount)
+	}
+	return b.String()
+}
+
+// Span is when the session was played, or that it is in progress.
+func (r Report) Span() string {
+	started := r.Started.Local().Format(timeLayout)
+	if r.Ended == nil {
+		return fmt.Sprintf("Started %s, in progress", started)
+	}
+	return fmt.Sprintf("%s to %s", started, r.Ended.Local().Format(timeLayout))
+}
+
+// Signed is the net with its sign, zero has none.
+func (n Net) Signed() string {
+	if n.Net > 0 {
+		return fmt.Sprintf("+%d", n.Net)
+	}
+	return fmt.Sprint(n.Net)
+}
+
+func nameFromID[T nameable](id db.ID, n []T) string {
+	for _, e := range n {
+		if e.ResultID() == id {
+			return e.ResultName()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+var (
+	users = []services.User{{ID: 1, Name: "miles"}, {ID: 2, Name: "bill"}, {ID: 3, Name: "jane"}}
+	games = []services.Game{{ID: 1, Name: "Golf"}, {ID: 2, Name: "Darts"}}
+	start = time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)
+)
+
+func round(n int, wager int, active int, winner db.ID) services.GameSessionRound {
+	gr := services.GameSessionRound{}
+	gr.Round = n
+	gr.Wager = wager
+	gr.Active = active
+	gr.Result = result.New([]db.ID{1, 2, 3})
+	if active == 0 {
+		gr.Result.AddWinner(winner, wager)
+	}
+	return gr
+}
+
+func session() services.SessionWithGames {
+	end := start.Add(90 * time.Minute)
+	golf := services.GameSession{GameID: 1}
+	golf.ID = 1
+	golf.Rounds = services.GameSessionRounds{round(2, 60, 0, 2), round(1, 100, 0, 1)}
+	darts := services.GameSession{GameID: 2}
+	darts.ID = 2
+	darts.Rounds = services.GameSessionRounds{round(1, 20, 1, 0)}
+	s := services.SessionWithGames{
+		Users:        services.Users{1, 2, 3},
+		GameSessions: services.GameSessions{darts, golf},
+	}
+	s.ID = 7
+	s.Started = start
+	s.Ended = &end
+	s.Result = result.ResultMap{1: {2: 0, 3: 0}, 2: {1: 20, 3: 0}, 3: {1: 50, 2: 30}}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	r := New(session(), users, games, start)
+
+	t.Run("lists games and ended rounds in the order played", func(t *testing.T) {
+		if len(r.Games) != 2 || r.Games[0].Name != "Golf" || r.Games[1].Name != "Darts" {
+			t.Fatalf("got games %+v", r.Games)
+		}
+		golf := r.Games[0]
+		if len(golf.Rounds) != 2 || golf.Rounds[0].Winner != "miles" || golf.Rounds[1].Winner != "bill" {
+			t.Errorf("got rounds %+v", golf.Rounds)
+		}
+		if golf.Wagered != 160 || len(r.Games[1].Rounds) != 0 || r.Wagered != 160 {
+			t.Errorf("got wagered %d of %d", golf.Wagered, r.Wagered)
+		}
+	})
+
+	t.Run("nets every participant", func(t *testing.T) {
+		want := []Net{{"miles", 70}, {"bill", 10}, {"jane", -80}}
+		for i, n := range want {
+			if r.Nets[i] != n {
+				t.Errorf("got net %+v want %+v", r.Nets[i], n)
+			}
+		}
+		if r.Duration != 90*time.Minute {
+			t.Errorf("got duration %s", r.Duration)
+		}
+	})
+}
+
+func TestSettle(t *testing.T) {
+	t.Run("pays the largest debts first", func(t *testing.T) {
+		got := Settle([]Net{{"miles", 70}, {"bill", 10}, {"jane", -80}})
+		assertTransfers(t, got, Transfer{"jane", "miles", 70}, Transfer{"jane", "bill", 10})
+	})
+
+	t.Run("takes fewer transfers than people", func(t *testing.T) {
+		got := Settle([]Net{{"a", -50}, {"b", -30}, {"c", 60}, {"d", 20}})
+		assertTransfers(t, got,
+			Transfer{"a", "c", 50}, Transfer{"b", "c", 10}, Transfer{"b", "d", 20})
+	})
+
+	t.Run("has nothing to settle when even", func(t *testing.T) {
+		assertTransfers(t, Settle([]Net{{"a", 0}, {"b", 0}}))
+	})
+}
+
+func TestMarkdown(t *testing.T) {
+	t.Run("has every section", func(t *testing.T) {
+		md := New(session(), users, games, start).Markdown()
+		for _, want := range []string{
+			"# Session #7\n",
+			"2024-01-01 20:00 to 2024-01-01 21:30, 1h30m0s",
+			"Participants: miles, bill, jane",
+			"## Golf (#1)",
+			"| 2 | 60 | bill |",
+			"Total wagered: 160",
+			"## Darts (#2)\n\nNo rounds ended.",
+			"| miles | +70 |",
+			"| jane | -80 |",
+			"- jane pays miles 70\n- jane pays bill 10\n",
+		} {
+			if !strings.Contains(md, want) {
+				t.Errorf("got markdown %q, want it to contain %q", md, want)
+			}
+		}
+	})
+}
+
+func assertTransfers(t testing.TB, got []Transfer, want ...Transfer) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got transfers %+v want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got transfer %+v want %+v", got[i], want[i])
+		}
+	}
+}
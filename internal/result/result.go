@@ -68,6 +68,33 @@ func (r ResultMap) ResolvedOnce() bool {
 	return sum > 0
 }
 
+// Winner returns the participant owed money in a single round result.
+func (r ResultMap) Winner() (db.ID, bool) {
+	for _, owe := range r {
+		for id, v := range owe {
+			if v > 0 {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Net returns what id is owed minus what id owes.
+func (r ResultMap) Net(id db.ID) int {
+	net := 0
+	for owerID, owe := range r {
+		if owerID == id {
+			for _, v := range owe {
+				net -= v
+			}
+			continue
+		}
+		net += owe[id]
+	}
+	return net
+}
+
 func (r ResultMap) Exists(id db.ID) bool {
 	_, ok := r[id]
 	return ok
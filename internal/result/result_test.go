@@ -134,6 +134,51 @@ func TestMerge(t *testing.T) {
 	})
 }
 
+func TestWinner(t *testing.T) {
+	t.Run("can find winner of round", func(t *testing.T) {
+		got := New([]user{
+			{ID: 1},
+			{ID: 2},
+			{ID: 3},
+		})
+		if _, ok := got.Winner(); ok {
+			t.Error("expected no winner in unresolved round")
+		}
+		got.AddWinner(2, 100)
+		id, ok := got.Winner()
+		if !ok || id != 2 {
+			t.Errorf("got winner %d want %d", id, 2)
+		}
+	})
+}
+
+func TestNet(t *testing.T) {
+	t.Run("can calculate net of participants", func(t *testing.T) {
+		got := New([]user{
+			{ID: 1},
+			{ID: 2},
+			{ID: 3},
+		})
+		got.AddWinner(1, 100)
+		got.AddWinner(3, 200)
+		assertCorrectNet(t, got, 1, 100-100)
+		assertCorrectNet(t, got, 2, -150)
+		assertCorrectNet(t, got, 3, 200-50)
+
+		got.Resolve()
+		assertCorrectNet(t, got, 1, 0)
+		assertCorrectNet(t, got, 2, -150)
+		assertCorrectNet(t, got, 3, 150)
+	})
+}
+
+func assertCorrectNet(t testing.TB, got ResultMap, id int, expected int) {
+	t.Helper()
+	if n := got.Net(db.ID(id)); n != expected {
+		t.Errorf("got net %d want %d for id %d", n, expected, id)
+	}
+}
+
 func assertCorrectValue(t testing.TB, got ResultMap, id int, expected ...[2]int) {
 	t.Helper()
 	target, ok := got[db.ID(id)]
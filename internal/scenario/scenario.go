@@ -0,0 +1,159 @@
+// Package scenario is the format of seed files, which describe users,
+// games and the sessions played with them, so that demo and e2e
+// datasets are reproducible and can be reviewed like code. Scenarios
+// are json, yaml would need a dependency the module does not have.
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultPassword is the password of users that have none.
+const DefaultPassword = "test-password"
+
+// Scenario is seeded in order. Sessions refer to users and games by
+// name, ignoring case, which are either listed or already exist.
+type Scenario struct {
+	Users    []User    `json:"users"`
+	Games    []string  `json:"games"`
+	Sessions []Session `json:"sessions"`
+}
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// Session is ended unless Open, only the last session can be open.
+// Started and Ended default to the time of seeding.
+type Session struct {
+	Users   []string      `json:"users"`
+	Started *time.Time    `json:"started"`
+	Ended   *time.Time    `json:"ended"`
+	Open    bool          `json:"open"`
+	Games   []GameSession `json:"games"`
+}
+
+// GameSession is ended unless it is the last of an open session and
+// has no Ended time.
+type GameSession struct {
+	Game    string     `json:"game"`
+	Started *time.Time `json:"started"`
+	Ended   *time.Time `json:"ended"`
+	Rounds  []Round    `json:"rounds"`
+}
+
+// Round without a Winner is active, only the last round of an open
+// game session can be active.
+type Round struct {
+	Wager  int    `json:"wager"`
+	Winner string `json:"winner"`
+}
+
+// Load reads a scenario from json and validates it.
+func Load(r io.Reader) (Scenario, error) {
+	var sc Scenario
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return sc, err
+	}
+	return sc, sc.Validate()
+}
+
+// IsOpen reports if g, the last game session of s, is left open.
+func (s Session) IsOpen(g int) bool {
+	return s.Open && g == len(s.Games)-1 && s.Games[g].Ended == nil
+}
+
+// Validate reports every part of the scenario that cannot be seeded.
+// Names are not resolved, users and games may already exist.
+func (sc Scenario) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	names := map[string]bool{}
+	for i, u := range sc.Users {
+		name := strings.ToLower(u.Name)
+		switch {
+		case name == "" || len(name) > 32:
+			fail("users[%d]: 'name' is required and must be maximum 32 characters", i)
+		case names[name]:
+			fail("users[%d]: name %q is duplicated", i, u.Name)
+		}
+		if u.Password != "" && len(u.Password) < 8 {
+			fail("users[%d]: 'password' must be minimum 8 characters", i)
+		}
+		names[name] = true
+	}
+	names = map[string]bool{}
+	for i, g := range sc.Games {
+		name := strings.ToLower(g)
+		switch {
+		case name == "":
+			fail("games[%d]: name is required", i)
+		case names[name]:
+			fail("games[%d]: name %q is duplicated", i, g)
+		}
+		names[name] = true
+	}
+
+	for i, s := range sc.Sessions {
+		at := fmt.Sprintf("sessions[%d]", i)
+		if s.Open && i < len(sc.Sessions)-1 {
+			fail("%s: only the last session can be open", at)
+		}
+		if s.Open && s.Ended != nil {
+			fail("%s: an open session cannot have 'ended'", at)
+		}
+		if s.Started != nil && s.Ended != nil && s.Ended.Before(*s.Started) {
+			fail("%s: 'ended' is before 'started'", at)
+		}
+		participants := map[string]bool{}
+		for _, u := range s.Users {
+			if participants[strings.ToLower(u)] {
+				fail("%s: user %q is repeated", at, u)
+			}
+			participants[strings.ToLower(u)] = true
+		}
+		if len(participants) < 2 {
+			fail("%s: 'users' must name minimum 2 people", at)
+		}
+		for j, g := range s.Games {
+			at := fmt.Sprintf("%s.games[%d]", at, j)
+			if g.Game == "" {
+				fail("%s: 'game' is required", at)
+			}
+			if g.Started != nil && g.Ended != nil && g.Ended.Before(*g.Started) {
+				fail("%s: 'ended' is before 'started'", at)
+			}
+			if len(g.Rounds) == 0 {
+				fail("%s: 'rounds' must contain minimum 1 round", at)
+			}
+			open := s.IsOpen(j)
+			for k, r := range g.Rounds {
+				at := fmt.Sprintf("%s.rounds[%d]", at, k)
+				if r.Wager <= 0 {
+					fail("%s: 'wager' must be a positive whole number", at)
+				}
+				if r.Winner == "" {
+					if !open || k < len(g.Rounds)-1 {
+						fail("%s: 'winner' is required unless it is the last round of an open game", at)
+					}
+					continue
+				}
+				if !participants[strings.ToLower(r.Winner)] {
+					fail("%s: winner %q is not a participant", at, r.Winner)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+)
+
+const demo = `{
+    "users": [{"name": "miles"}, {"name": "bill", "password": "password1"}],
+    "games": ["Golf"],
+    "sessions": [
+        {
+            "users": ["miles", "bill"],
+            "started": "2024-01-01T20:00:00Z",
+            "ended": "2024-01-01T22:00:00Z",
+            "games": [{"game": "golf", "rounds": [{"wager": 100, "winner": "Miles"}]}]
+        },
+        {
+            "users": ["miles", "bill"],
+            "open": true,
+            "games": [
+                {"game": "Golf", "rounds": [{"wager": 50, "winner": "bill"}]},
+                {"game": "Darts", "rounds": [{"wager": 20, "winner": "bill"}, {"wager": 40}]}
+            ]
+        }
+    ]
+}`
+
+func TestLoad(t *testing.T) {
+	t.Run("reads a valid scenario", func(t *testing.T) {
+		sc, err := Load(strings.NewReader(demo))
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		if len(sc.Users) != 2 || len(sc.Sessions) != 2 || sc.Sessions[0].Started.Hour() != 20 {
+			t.Errorf("got %+v", sc)
+		}
+		open := sc.Sessions[1]
+		if open.IsOpen(0) || !open.IsOpen(1) || sc.Sessions[0].IsOpen(0) {
+			t.Errorf("got the wrong game sessions open")
+		}
+	})
+
+	t.Run("refuses unknown fields", func(t *testing.T) {
+		_, err := Load(strings.NewReader(`{"players": []}`))
+		assertErrContains(t, err, `unknown field "players"`)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("reports duplicates", func(t *testing.T) {
+		sc := Scenario{
+			Users: []User{{Name: "miles"}, {Name: "Miles", Password: "short"}},
+			Games: []string{"Golf", "golf"},
+		}
+		err := sc.Validate()
+		assertErrContains(t, err, `users[1]: name "Miles" is duplicated`)
+		assertErrContains(t, err, "users[1]: 'password' must be minimum 8 characters")
+		assertErrContains(t, err, `games[1]: name "golf" is duplicated`)
+	})
+
+	t.Run("reports sessions that cannot be played", func(t *testing.T) {
+		sc := Scenario{Sessions: []Session{
+			{Users: []string{"miles"}, Open: true, Games: []GameSession{{Game: "Golf"}}},
+			{Users: []string{"miles", "bill"}, Games: []GameSession{{
+				Game: "Golf", Rounds: []Round{{Wager: 10}, {Wager: 0, Winner: "jane"}},
+			}}},
+		}}
+		err := sc.Validate()
+		assertErrContains(t, err, "sessions[0]: only the last session can be open")
+		assertErrContains(t, err, "sessions[0]: 'users' must name minimum 2 people")
+		assertErrContains(t, err, "sessions[0].games[0]: 'rounds' must contain minimum 1 round")
+		assertErrContains(t, err, "sessions[1].games[0].rounds[0]: 'winner' is required")
+		assertErrContains(t, err, "sessions[1].games[0].rounds[1]: 'wager' must be a positive whole number")
+		assertErrContains(t, err, `sessions[1].games[0].rounds[1]: winner "jane" is not a participant`)
+	})
+}
+
+func assertErrContains(t testing.TB, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("got no error, want %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want it to contain %q", err, want)
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/archive"
+	"github.com/lindeneg/wager/internal/importer"
+	"github.com/lindeneg/wager/internal/server/utils"
+)
+
+type ExportReponse archive.Archive
+
+func (ExportReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Export downloads the whole history as an archive,
+// password hashes are included with ?passwords=true.
+func (c Controller) Export(w http.ResponseWriter, r *http.Request) {
+	a, err := c.s.Archive.Export(r.URL.Query().Get("passwords") == "true")
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="wager-%s.json"`, a.Exported.Format("2006-01-02")))
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, ExportReponse(a))
+}
+
+type ImportReportReponse importer.Report
+
+func (ImportReportReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ImportHistory creates ended sessions from a csv of bets tracked before
+// this app, nothing is created with ?dry-run=true.
+func (c Controller) ImportHistory(w http.ResponseWriter, r *http.Request) {
+	rows, err := importer.Parse(r.Body)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry-run") == "true"
+	report, err := c.s.Archive.ImportHistory(rows, dryRun)
+	var lineErr *importer.LineError
+	if errors.As(err, &lineErr) {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+	}
+	render.Status(r, status)
+	render.Render(w, r, ImportReportReponse(report))
+}
@@ -2,10 +2,13 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
 	"github.com/lindeneg/wager/internal/server/utils"
 )
@@ -13,6 +16,7 @@ import (
 type LoginReq struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Code     string `json:"code"`
 }
 
 func (l *LoginReq) Bind(r *http.Request) error {
@@ -27,21 +31,74 @@ func (l *LoginReq) Bind(r *http.Request) error {
 	return err
 }
 
+func loginKeys(username string, ip string) []string {
+	return []string{"user:" + username, "ip:" + ip}
+}
+
+// maxEventUsername bounds the unknown usernames written to events.
+const maxEventUsername = 32
+
+// failedLogin counts the attempt of username and responds as if the user
+// does not exist, usrID is 0 if no such user exists.
+func (c Controller) failedLogin(w http.ResponseWriter, r *http.Request, username string, usrID db.ID, keys []string) {
+	c.l.Fail(keys...)
+	var id *db.ID
+	desc := fmt.Sprintf("failed login attempt from %s (%d consecutive)",
+		utils.ClientIP(r), c.l.Failures(keys[0]))
+	if usrID > 0 {
+		id = &usrID
+	} else {
+		if len(username) > maxEventUsername {
+			username = username[:maxEventUsername]
+		}
+		desc = fmt.Sprintf("failed login attempt for unknown user %q from %s (%d consecutive)",
+			username, utils.ClientIP(r), c.l.Failures(keys[0]))
+	}
+	if _, err := c.s.Event.Create(id, desc); err != nil {
+		fmt.Printf("ERROR [%s] '%s'\n", r.Context().Value(chimw.RequestIDKey), err)
+	}
+	utils.NotFoundErr(w, r)
+}
+
 func (c Controller) Login(w http.ResponseWriter, r *http.Request) {
 	data := &LoginReq{}
 	if err := render.Bind(r, data); err != nil {
 		utils.BadRequestErr(w, r, err)
 		return
 	}
+	keys := loginKeys(data.Username, utils.ClientIP(r))
+	if wait := c.l.Check(keys...); wait > 0 {
+		utils.TooManyRequestsErr(w, r, wait)
+		return
+	}
 	usr, err := c.s.User.ByName(data.Username)
 	if err != nil {
-		utils.NotFoundErr(w, r)
+		c.failedLogin(w, r, data.Username, 0, keys)
 		return
 	}
 	if ok := utils.ComparePassword(usr.Password, data.Password); !ok {
-		utils.NotFoundErr(w, r)
+		c.failedLogin(w, r, data.Username, usr.ID, keys)
+		return
+	}
+	if usr.Deactivated != nil {
+		utils.RenderErrEx(w, r, http.StatusForbidden, errvar.ErrUserDeactivated)
 		return
 	}
+	if c.s.TOTP.IsEnabled(usr.ID) {
+		// The code is only asked for once the password matched,
+		// the first of the two steps of a login is not a failure.
+		if data.Code == "" {
+			utils.RenderErr(w, r, errvar.ErrTOTPRequired)
+			return
+		}
+		if err := c.verifyTOTP(usr.ID, data.Code); err != nil {
+			c.failedLogin(w, r, data.Username, usr.ID, keys)
+			return
+		}
+	}
+	// Only the user is forgiven, a login to an account of their own
+	// must not clear the failures of an address guessing passwords.
+	c.l.Reset(keys[0])
 	t, err := utils.CreateToken(c.e.JWTSecret, usr.ID, usr.Name)
 	if err != nil {
 		utils.InternalErr(w, r)
@@ -59,8 +116,8 @@ type SignupReq struct {
 
 func (l *SignupReq) Bind(r *http.Request) error {
 	var err error
-	if len(l.Username) < 3 || len(l.Username) > 12 {
-		err = errors.Join(err, errors.New("'username' must be more between 3-12 characters"))
+	if e := utils.ValidateUsername(l.Username); e != nil {
+		err = errors.Join(err, e)
 	}
 	if len(l.Password) < 8 || len(l.Username) > 32 {
 		err = errors.Join(err, errors.New("'password' must be more between 8-32 characters"))
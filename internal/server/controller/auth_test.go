@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/totp"
+)
+
+func TestLogin(t *testing.T) {
+	t.Run("asks for the code once the password matched", func(t *testing.T) {
+		c, _, _ := newTOTPController(t)
+		assertInt(t, login(c, "miles", "wrong-password", "").Code, http.StatusNotFound)
+		assertInt(t, c.l.Failures("user:miles"), 1)
+		assertInt(t, login(c, "miles", "password", "").Code, http.StatusUnauthorized)
+		assertInt(t, c.l.Failures("user:miles"), 1)
+	})
+
+	t.Run("refuses bad and reused codes", func(t *testing.T) {
+		c, now, secret := newTOTPController(t)
+		assertInt(t, login(c, "miles", "password", "000000").Code, http.StatusNotFound)
+		assertInt(t, c.l.Failures("user:miles"), 1)
+		code, err := totp.Code(secret, *now)
+		assertNoError(t, err)
+		w := login(c, "miles", "password", code)
+		assertInt(t, w.Code, http.StatusNoContent)
+		if len(w.Result().Cookies()) != 1 {
+			t.Errorf("got %d cookies want 1", len(w.Result().Cookies()))
+		}
+		assertInt(t, login(c, "miles", "password", code).Code, http.StatusNotFound)
+		*now = now.Add(30 * time.Second)
+		code, err = totp.Code(secret, *now)
+		assertNoError(t, err)
+		assertInt(t, login(c, "miles", "password", code).Code, http.StatusNoContent)
+	})
+
+	t.Run("keeps the failures of the address after a login", func(t *testing.T) {
+		c, _, _ := newTOTPController(t)
+		ip := "ip:" + utils.ClientIP(httptest.NewRequest(http.MethodPost, "/", nil))
+		assertInt(t, login(c, "miles", "wrong-password", "").Code, http.StatusNotFound)
+		assertInt(t, login(c, "miles", "password", "recovery").Code, http.StatusNoContent)
+		assertInt(t, c.l.Failures("user:miles"), 0)
+		assertInt(t, c.l.Failures(ip), 1)
+	})
+
+	t.Run("consumes recovery codes", func(t *testing.T) {
+		c, _, _ := newTOTPController(t)
+		assertInt(t, login(c, "miles", "password", "recovery").Code, http.StatusNoContent)
+		assertInt(t, login(c, "miles", "password", "recovery").Code, http.StatusNotFound)
+	})
+}
+
+// newTOTPController has the user miles with two-factor authentication
+// and the recovery code "recovery", at a clock that only moves when set.
+func newTOTPController(t *testing.T) (Controller, *time.Time, string) {
+	t.Helper()
+	store, err := db.Open(filepath.Join(t.TempDir(), "wager.db"))
+	assertNoError(t, err)
+	t.Cleanup(func() { store.DB.Close() })
+	store.Dir = filepath.Join("..", "..", "..", "sql")
+	assertNoError(t, store.Migrate())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newController(env.Env{JWTSecret: "secret", JWTCookie: "wager"},
+		services.InitServices(store), func() time.Time { return now })
+	hash, err := utils.HashPassword("password")
+	assertNoError(t, err)
+	usr, err := c.s.User.Create("miles", hash)
+	assertNoError(t, err)
+	secret, err := totp.NewSecret()
+	assertNoError(t, err)
+	assertNoError(t, c.s.TOTP.SetSecret(usr.ID, secret))
+	recovery, err := utils.HashPassword("recovery")
+	assertNoError(t, err)
+	assertNoError(t, c.s.TOTP.Enable(usr.ID, []string{recovery}))
+	return c, &now, secret
+}
+
+func login(c Controller, username string, password string, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(LoginReq{Username: username, Password: password, Code: code})
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	c.Login(w, r)
+	return w
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertInt(t testing.TB, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/lockout"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
 	"github.com/lindeneg/wager/internal/templates"
@@ -9,19 +12,36 @@ import (
 
 type Controller struct {
 	t struct {
-		home    utils.Template
-		auth    utils.Template
-		session utils.Template
+		home        utils.Template
+		auth        utils.Template
+		session     utils.Template
+		user        utils.Template
+		leaderboard utils.Template
+		headToHead  utils.Template
+		game        utils.Template
+		report      utils.Template
 	}
 	e env.Env
 	s *services.Services
+	l *lockout.Tracker
+	// now is the clock of login attempts and totp codes.
+	now func() time.Time
 }
 
 func New(e env.Env, s *services.Services) Controller {
-	c := Controller{e: e, s: s}
+	return newController(e, s, services.NewTime)
+}
+
+func newController(e env.Env, s *services.Services, now func() time.Time) Controller {
+	c := Controller{e: e, s: s, l: lockout.New(lockout.DefaultConfig, now), now: now}
 	c.t.home = utils.ParseFS(
 		templates.FS, "index.gohtml", "common.gohtml")
 	c.t.session = utils.ParseFS(templates.FS, "session.gohtml", "common.gohtml")
 	c.t.auth = utils.ParseFS(templates.FS, "auth.gohtml", "common.gohtml")
+	c.t.user = utils.ParseFS(templates.FS, "user.gohtml", "common.gohtml")
+	c.t.leaderboard = utils.ParseFS(templates.FS, "leaderboard.gohtml", "common.gohtml")
+	c.t.headToHead = utils.ParseFS(templates.FS, "head-to-head.gohtml", "common.gohtml")
+	c.t.game = utils.ParseFS(templates.FS, "game.gohtml", "common.gohtml")
+	c.t.report = utils.ParseFS(templates.FS, "report.gohtml")
 	return c
 }
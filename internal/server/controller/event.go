@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type EventsReponse []services.Event
+
+func (EventsReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) Events(w http.ResponseWriter, r *http.Request) {
+	evs, err := c.s.Event.All(pagination.FromQuery(r.URL.Query()))
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, EventsReponse(evs))
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/lindeneg/wager/internal/export"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+// ExportSessions downloads the sessions matching the list filters as csv.
+func (c Controller) ExportSessions(w http.ResponseWriter, r *http.Request) {
+	spec, err := exportSpec(services.SessionQuery, r)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	ss, err := c.s.Session.AllWithSessions(spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	writeCSV(w, r, "sessions", export.Sessions(ss, usrs))
+}
+
+// ExportGameSessions downloads the game sessions matching the list filters as csv.
+func (c Controller) ExportGameSessions(w http.ResponseWriter, r *http.Request) {
+	c.exportGameSessions(w, r, "game-sessions", export.GameSessions)
+}
+
+// ExportRounds downloads the ended rounds of the game sessions
+// matching the list filters as csv.
+func (c Controller) ExportRounds(w http.ResponseWriter, r *http.Request) {
+	c.exportGameSessions(w, r, "rounds", export.Rounds)
+}
+
+func (c Controller) exportGameSessions(
+	w http.ResponseWriter, r *http.Request, name string,
+	table func([]services.GameSession, []services.User, []services.Game) [][]string,
+) {
+	spec, err := exportSpec(services.GameSessionQuery, r)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	gs, err := c.s.GSession.All(spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	writeCSV(w, r, name, table(gs, usrs, games))
+}
+
+// ExportBalances downloads the current result as csv.
+func (c Controller) ExportBalances(w http.ResponseWriter, r *http.Request) {
+	rr, err := c.s.Result.Current()
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	writeCSV(w, r, "balances", export.Balances(rr, usrs))
+}
+
+// exportSpec parses the sort and filters of a list, exports are not paginated.
+func exportSpec(s query.Schema, r *http.Request) (query.Spec, error) {
+	return s.Parse(r.URL.Query(), nil)
+}
+
+func writeCSV(w http.ResponseWriter, r *http.Request, name string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="wager-%s-%s.csv"`, name, services.NewTime().Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+	if err := export.Write(w, rows); err != nil {
+		fmt.Printf("ERROR [%s] '%s'\n", r.Context().Value(chimw.RequestIDKey), err)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/go-chi/render"
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
-	"github.com/lindeneg/wager/internal/pagination"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
 )
@@ -33,16 +32,11 @@ func (n *NewGameSessionReq) Bind(r *http.Request) error {
 }
 
 type GameSessionRes services.GameSession
-type GameSessionsRes []services.GameSession
 
 func (GameSessionRes) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (GameSessionsRes) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
-}
-
 func (c Controller) NewGameSession(w http.ResponseWriter, r *http.Request) {
 	data := &NewGameSessionReq{}
 	if err := render.Bind(r, data); err != nil {
@@ -68,6 +62,7 @@ func (c Controller) NewGameSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, gs.Version)
 	render.Status(r, http.StatusCreated)
 	render.Render(w, r, GameSessionRes(gs))
 }
@@ -93,33 +88,60 @@ func (c Controller) NewGameSessionRound(w http.ResponseWriter, r *http.Request)
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
 	data := &NewGameSessionRoundReq{}
 	if err := render.Bind(r, data); err != nil {
 		utils.BadRequestErr(w, r, err)
 		return
 	}
-	gs, err := c.s.GSession.NewRound(id, data.Wager)
+	gs, err := c.s.GSession.NewRound(id, data.Wager, version)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, gs.Version)
 	render.Status(r, http.StatusOK)
 	render.Render(w, r, GameSessionRes(gs))
 }
 
+func gameSessionKey(gs services.GameSession) db.ID {
+	return gs.ID
+}
+
 func (c Controller) GameSessions(w http.ResponseWriter, r *http.Request) {
 	id, err := utils.IDParam(r)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	gs, err := c.s.GSession.FromSession(id, pagination.FromQuery(r.URL.Query()))
+	spec, err := specFromQuery(services.GameSessionQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	gs, err := c.s.GSession.FromSession(id, spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	count, err := c.s.GSession.CountFromSession(id, spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	l := newListReponse(r, gs, count, spec, gameSessionKey, services.GameSessionValues.For(spec))
+	// The active game session is the one changed through this list,
+	// so its version is the ETag to change it with.
+	if active, err := c.s.GSession.ActiveFromSession(id); err == nil {
+		l.Active = &active
+		utils.ETag(w, active.Version)
+	}
 	render.Status(r, http.StatusOK)
-	render.Render(w, r, GameSessionsRes(gs))
+	render.Render(w, r, l)
 }
 
 func (c Controller) HasActiveGameSession(w http.ResponseWriter, r *http.Request) {
@@ -150,16 +172,22 @@ func (c Controller) EndGameSessionRound(w http.ResponseWriter, r *http.Request)
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
 	data := &EndGameSessionRoundReq{}
 	if err := render.Bind(r, data); err != nil {
 		utils.BadRequestErr(w, r, err)
 		return
 	}
-	gs, err := c.s.GSession.EndRound(id, data.WinnerID)
+	gs, err := c.s.GSession.EndRound(id, data.WinnerID, version)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, gs.Version)
 	render.Status(r, http.StatusOK)
 	render.Render(w, r, GameSessionRes(gs))
 }
@@ -170,11 +198,17 @@ func (c Controller) EndGameSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	gs, err := c.s.GSession.End(id)
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
+	gs, err := c.s.GSession.End(id, version)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, gs.Version)
 	render.Status(r, http.StatusOK)
 	render.Render(w, r, GameSessionRes(gs))
 }
@@ -185,7 +219,12 @@ func (c Controller) CancelGameSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	if err := c.s.GSession.Cancel(id); err != nil {
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
+	if err := c.s.GSession.Cancel(id, version); err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
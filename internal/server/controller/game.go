@@ -5,8 +5,10 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
 )
 
 type GamesReponse []services.Game
@@ -59,3 +61,112 @@ func (c Controller) NewGame(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusCreated)
 	render.Render(w, r, GameReponse(gm))
 }
+
+const (
+	topWinners         = 5
+	recentGameSessions = 10
+)
+
+type GameStatsReponse stats.GameStats
+
+func (GameStatsReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) gameStats(id db.ID) (stats.GameStats, error) {
+	gm, err := c.s.Game.ByPK(id)
+	if err != nil {
+		return stats.GameStats{}, err
+	}
+	rounds, err := c.s.History.Rounds(services.HistoryFilter{GameID: id})
+	if err != nil {
+		return stats.GameStats{}, err
+	}
+	sessions, err := c.s.GSession.FromGame(id, nil)
+	if err != nil {
+		return stats.GameStats{}, err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return stats.GameStats{}, err
+	}
+	return stats.ForGame(gm, rounds, sessions, usrs, topWinners, recentGameSessions), nil
+}
+
+func (c Controller) GameStats(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	gs, err := c.gameStats(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, GameStatsReponse(gs))
+}
+
+type RatingsReponse []services.Rating
+
+type RatingHistoryReponse []services.RatingEntry
+
+func (RatingsReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (RatingHistoryReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) GameRatings(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	if _, err := c.s.Game.ByPK(id); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	rs, err := c.s.Rating.Current(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, RatingsReponse(rs))
+}
+
+func (c Controller) GameRatingHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	userID, err := idFromQuery("user", r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	if _, err := c.s.Game.ByPK(id); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	h, err := c.s.Rating.History(id, userID)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, RatingHistoryReponse(h))
+}
+
+func (c Controller) RecomputeRatings(w http.ResponseWriter, r *http.Request) {
+	if err := c.s.Rating.Recompute(); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
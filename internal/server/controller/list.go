@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
+)
+
+// ListReponse is a page of T and the total count of rows matching the query.
+// Next and Prev link to the adjacent pages using opaque cursors, and
+// Active holds the active row, which is never part of a page by default.
+type ListReponse[T any] struct {
+	Data   []T         `json:"data"`
+	Active *T          `json:"active,omitempty"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Sort   string      `json:"sort"`
+	Order  query.Order `json:"order"`
+	Next   string      `json:"next,omitempty"`
+	Prev   string      `json:"prev,omitempty"`
+}
+
+func (ListReponse[T]) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newListReponse[T any](
+	r *http.Request, data []T, total int, spec query.Spec, key func(T) db.ID, value func(T) any,
+) ListReponse[T] {
+	l := ListReponse[T]{
+		Data:   data,
+		Total:  total,
+		Limit:  spec.P.Limit,
+		Offset: spec.P.Offset,
+		Sort:   spec.Sort,
+		Order:  spec.Order,
+	}
+	if len(data) == 0 {
+		return l
+	}
+	full := len(data) == spec.P.Limit
+	first, last := data[0], data[len(data)-1]
+	next := spec.Next(int64(key(last)), value(last))
+	prev := spec.Prev(int64(key(first)), value(first))
+	switch {
+	case spec.Cursor == nil:
+		if spec.P.Offset+len(data) < total {
+			l.Next = pageLink(r, "after", next)
+		}
+		if spec.P.Offset > 0 {
+			l.Prev = pageLink(r, "before", prev)
+		}
+	case spec.Reversed():
+		l.Next = pageLink(r, "after", next)
+		if full {
+			l.Prev = pageLink(r, "before", prev)
+		}
+	default:
+		if full {
+			l.Next = pageLink(r, "after", next)
+		}
+		l.Prev = pageLink(r, "before", prev)
+	}
+	return l
+}
+
+func pageLink(r *http.Request, name string, c query.Cursor) string {
+	q := r.URL.Query()
+	q.Del("offset")
+	q.Del("after")
+	q.Del("before")
+	q.Set(name, c.String())
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+func specFromQuery(s query.Schema, values url.Values) (query.Spec, error) {
+	return s.Parse(values, pagination.FromQuery(values))
+}
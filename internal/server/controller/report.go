@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lindeneg/wager/internal/report"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type reportProps struct {
+	Title  string
+	Report report.Report
+}
+
+// SessionReportPage is the summary of a session as a standalone page for printing.
+func (c Controller) SessionReportPage(w http.ResponseWriter, r *http.Request) {
+	rp, err := c.sessionReport(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	c.t.report.Execute(w, r, reportProps{
+		Title:  fmt.Sprintf("Bankmanden Session #%d", rp.ID),
+		Report: rp,
+	})
+}
+
+// SessionReportMarkdown is the summary of a session as markdown for pasting into chat.
+func (c Controller) SessionReportMarkdown(w http.ResponseWriter, r *http.Request) {
+	rp, err := c.sessionReport(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write([]byte(rp.Markdown()))
+}
+
+func (c Controller) sessionReport(r *http.Request) (report.Report, error) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		return report.Report{}, err
+	}
+	ss, err := c.s.Session.ByPKWithSessions(id)
+	if err != nil {
+		return report.Report{}, err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return report.Report{}, err
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		return report.Report{}, err
+	}
+	return report.New(ss, usrs, games, services.NewTime()), nil
+}
@@ -1,53 +1,90 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
-	"github.com/lindeneg/wager/internal/pagination"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
 )
 
-type SessionsReponse []services.SessionWithGames
-
-type SlimSessionsReponse []services.Session
-
 type SessionReponse services.SessionWithGames
 
-func (SessionsReponse) Render(w http.ResponseWriter, r *http.Request) error {
+func (SessionReponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (SlimSessionsReponse) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
+func sessionKey(s services.Session) db.ID {
+	return s.ID
 }
 
-func (SessionReponse) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
+func sessionWithGamesKey(s services.SessionWithGames) db.ID {
+	return s.ID
 }
 
 func (c Controller) Sessions(w http.ResponseWriter, r *http.Request) {
-	ss, err := c.s.Session.AllWithSessions(pagination.FromQuery(r.URL.Query()))
+	spec, err := specFromQuery(services.SessionQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	ss, err := c.s.Session.AllWithSessions(spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	count, err := c.s.Session.Count(spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	l := newListReponse(r, ss, count, spec, sessionWithGamesKey, services.SessionValues.For(spec))
+	if active, err := c.s.Session.Active(); err == nil {
+		l.Active = &active
+	}
 	render.Status(r, http.StatusOK)
-	render.Render(w, r, SessionsReponse(ss))
+	render.Render(w, r, l)
 }
 
 func (c Controller) SessionsSlim(w http.ResponseWriter, r *http.Request) {
-	ss, err := c.s.Session.All(pagination.FromQuery(r.URL.Query()))
+	spec, err := specFromQuery(services.SessionQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	// The cursors of sorts by money and games need the game sessions.
+	sgs, err := c.s.Session.AllWithSessions(spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	count, err := c.s.Session.Count(spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	ss := make([]services.Session, len(sgs))
+	withGames := make(map[db.ID]services.SessionWithGames, len(sgs))
+	for i, s := range sgs {
+		ss[i] = s.Session
+		withGames[s.ID] = s
+	}
+	value := services.SessionValues.For(spec)
+	l := newListReponse(r, ss, count, spec, sessionKey, func(s services.Session) any {
+		return value(withGames[s.ID])
+	})
+	if active, err := c.s.Session.Active(); err == nil {
+		l.Active = &active.Session
+	}
 	render.Status(r, http.StatusOK)
-	render.Render(w, r, SlimSessionsReponse(ss))
+	render.Render(w, r, l)
 }
 
 func (c Controller) Session(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +98,7 @@ func (c Controller) Session(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, ss.Version)
 	render.Status(r, http.StatusOK)
 	render.Render(w, r, SessionReponse(ss))
 }
@@ -98,11 +136,23 @@ func (c Controller) NewSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErr(w, r, errvar.ErrHasActiveSession)
 		return
 	}
+	for _, id := range data.Users {
+		usr, err := c.s.User.ByPK(id)
+		if err != nil {
+			utils.RenderErrSlim(w, r, err)
+			return
+		}
+		if usr.Deactivated != nil {
+			utils.RenderErr(w, r, errvar.ErrUserDeactivated)
+			return
+		}
+	}
 	ss, err := c.s.Session.Create(data.Users)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, ss.Version)
 	render.Status(r, http.StatusCreated)
 	render.Render(w, r, SessionReponse(ss))
 }
@@ -113,15 +163,21 @@ func (c Controller) EndSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
 	if _, err := c.s.GSession.ActiveFromSession(id); err == nil {
 		utils.RenderErrSlim(w, r, errvar.ErrSessionActive)
 		return
 	}
-	ss, err := c.s.Session.End(id)
+	ss, err := c.s.Session.End(id, version)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	utils.ETag(w, ss.Version)
 	render.Status(r, http.StatusOK)
 	render.Render(w, r, SessionReponse(ss))
 }
@@ -132,13 +188,66 @@ func (c Controller) CancelSession(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
+	version, err := utils.IfMatch(r)
+	if err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
 	if _, err := c.s.GSession.ActiveFromSession(id); err == nil {
 		utils.RenderErrSlim(w, r, errvar.ErrSessionActive)
 		return
 	}
-	if err = c.s.Session.Cancel(id); err != nil {
+	if err = c.s.Session.Cancel(id, version); err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// eventsHeartbeat keeps idle event streams from being closed by proxies.
+const eventsHeartbeat = 25 * time.Second
+
+// SessionEvents streams the game session events of a session
+// as server-sent events until the client disconnects.
+func (c Controller) SessionEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	if _, err := c.s.Session.ByPK(id); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		utils.InternalErr(w, r)
+		return
+	}
+	evs, unsubscribe := c.s.GSessionHub.Subscribe(id)
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	f.Flush()
+	t := time.NewTicker(eventsHeartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case ev := <-evs:
+			b, err := json.Marshal(ev)
+			if err != nil {
+				fmt.Printf("ERROR [%s] '%s'\n", r.Context().Value(chimw.RequestIDKey), err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, b)
+		}
+		f.Flush()
+	}
+}
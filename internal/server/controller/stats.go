@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
+)
+
+func timeFromQuery(name string, values url.Values, endOfDay bool) (*time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := query.ParseTime(name, v, endOfDay)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func idFromQuery(name string, values url.Values) (db.ID, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("'%s' must be an id", name)
+	}
+	return db.ID(id), nil
+}
+
+func historyFilterFromQuery(values url.Values) (services.HistoryFilter, error) {
+	var f services.HistoryFilter
+	var err error
+	if f.From, err = timeFromQuery("from", values, false); err != nil {
+		return f, err
+	}
+	if f.To, err = timeFromQuery("to", values, true); err != nil {
+		return f, err
+	}
+	if f.GameID, err = idFromQuery("game", values); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+type LeaderboardReponse []stats.LeaderboardEntry
+
+func (LeaderboardReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) leaderboard(
+	f services.HistoryFilter, by stats.LeaderboardSort,
+) ([]stats.LeaderboardEntry, error) {
+	rounds, err := c.s.History.Rounds(f)
+	if err != nil {
+		return nil, err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Leaderboard(rounds, usrs, by), nil
+}
+
+func (c Controller) Leaderboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := historyFilterFromQuery(q)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	by, err := stats.ParseLeaderboardSort(q.Get("sort"))
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	lb, err := c.leaderboard(f, by)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, LeaderboardReponse(lb))
+}
+
+type HeadToHeadReponse stats.HeadToHead
+
+func (HeadToHeadReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func rivalsFromQuery(values url.Values) (db.ID, db.ID, error) {
+	a, err := idFromQuery("a", values)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := idFromQuery("b", values)
+	if err != nil {
+		return 0, 0, err
+	}
+	if a == 0 || b == 0 {
+		return 0, 0, errors.New("'a' and 'b' are required")
+	}
+	if a == b {
+		return 0, 0, errors.New("'a' and 'b' must be different users")
+	}
+	return a, b, nil
+}
+
+func (c Controller) headToHead(a db.ID, b db.ID, f services.HistoryFilter) (stats.HeadToHead, error) {
+	ua, err := c.s.User.ByPK(a)
+	if err != nil {
+		return stats.HeadToHead{}, err
+	}
+	ub, err := c.s.User.ByPK(b)
+	if err != nil {
+		return stats.HeadToHead{}, err
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		return stats.HeadToHead{}, err
+	}
+	f.UserID = a
+	rounds, err := c.s.History.Rounds(f)
+	if err != nil {
+		return stats.HeadToHead{}, err
+	}
+	return stats.Rivalry(ua.User, ub.User, rounds, games), nil
+}
+
+func (c Controller) HeadToHead(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	a, b, err := rivalsFromQuery(q)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	f, err := historyFilterFromQuery(q)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	h, err := c.headToHead(a, b, f)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, HeadToHeadReponse(h))
+}
+
+type BalanceHistoryReponse stats.BalanceHistory
+
+func (BalanceHistoryReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) balanceHistory(f services.HistoryFilter, by stats.Granularity) (stats.BalanceHistory, error) {
+	rounds, err := c.s.History.Rounds(f)
+	if err != nil {
+		return stats.BalanceHistory{}, err
+	}
+	sessions, err := c.s.Session.Resolved(nil)
+	if err != nil {
+		return stats.BalanceHistory{}, err
+	}
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		return stats.BalanceHistory{}, err
+	}
+	return stats.Balances(rounds, sessions, usrs, by), nil
+}
+
+func (c Controller) BalanceHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	by, ok := stats.ParseGranularity(q.Get("by"))
+	if !ok {
+		utils.BadRequestErr(w, r, errors.New("'by' must be one of round, game-session or session"))
+		return
+	}
+	f, err := historyFilterFromQuery(q)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	bh, err := c.balanceHistory(f, by)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, BalanceHistoryReponse(bh))
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/totp"
+)
+
+const totpIssuer = "Bankmanden"
+
+const recoveryCodeCount = 10
+
+type TOTPEnrolReponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (TOTPEnrolReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type RecoveryCodesReponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (RecoveryCodesReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type TOTPCodeReq struct {
+	Code string `json:"code"`
+}
+
+func (t *TOTPCodeReq) Bind(r *http.Request) error {
+	if t.Code == "" {
+		return errors.New("'code' is required")
+	}
+	return nil
+}
+
+// verifyTOTP accepts either a current totp code or an unused recovery code.
+func (c Controller) verifyTOTP(userID db.ID, code string) error {
+	ut, err := c.s.TOTP.ByUser(userID)
+	if err != nil {
+		return errvar.ErrTOTPNotEnrolled
+	}
+	if step, ok := totp.Verify(ut.Secret, code, c.now()); ok {
+		return c.s.TOTP.UseStep(userID, step)
+	}
+	if !ut.Enabled {
+		return errvar.ErrTOTPInvalid
+	}
+	rcs, err := c.s.TOTP.RecoveryCodes(userID)
+	if err != nil {
+		return err
+	}
+	for _, rc := range rcs {
+		if utils.ComparePassword(rc.Code, code) {
+			return c.s.TOTP.UseRecoveryCode(rc.ID)
+		}
+	}
+	return errvar.ErrTOTPInvalid
+}
+
+func (c Controller) EnrolTOTP(w http.ResponseWriter, r *http.Request) {
+	authModel, err := utils.GetCtxAuthModel(r)
+	if err != nil {
+		utils.RenderErrEx(w, r, http.StatusUnauthorized, nil)
+		return
+	}
+	if c.s.TOTP.IsEnabled(authModel.ID) {
+		utils.RenderErr(w, r, errvar.ErrTOTPEnabled)
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		utils.InternalErr(w, r)
+		return
+	}
+	if err := c.s.TOTP.SetSecret(authModel.ID, secret); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, TOTPEnrolReponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, authModel.Name, secret),
+	})
+}
+
+func (c Controller) EnableTOTP(w http.ResponseWriter, r *http.Request) {
+	authModel, err := utils.GetCtxAuthModel(r)
+	if err != nil {
+		utils.RenderErrEx(w, r, http.StatusUnauthorized, nil)
+		return
+	}
+	data := &TOTPCodeReq{}
+	if err := render.Bind(r, data); err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	if c.s.TOTP.IsEnabled(authModel.ID) {
+		utils.RenderErr(w, r, errvar.ErrTOTPEnabled)
+		return
+	}
+	if err := c.verifyTOTP(authModel.ID, data.Code); err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
+	codes, err := totp.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		utils.InternalErr(w, r)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i], err = utils.HashPassword(code)
+		if err != nil {
+			utils.InternalErr(w, r)
+			return
+		}
+	}
+	if err := c.s.TOTP.Enable(authModel.ID, hashes); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, RecoveryCodesReponse{codes})
+}
+
+func (c Controller) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	authModel, err := utils.GetCtxAuthModel(r)
+	if err != nil {
+		utils.RenderErrEx(w, r, http.StatusUnauthorized, nil)
+		return
+	}
+	data := &TOTPCodeReq{}
+	if err := render.Bind(r, data); err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	if !c.s.TOTP.IsEnabled(authModel.ID) {
+		utils.RenderErr(w, r, errvar.ErrTOTPNotEnrolled)
+		return
+	}
+	if err := c.verifyTOTP(authModel.ID, data.Code); err != nil {
+		utils.RenderErr(w, r, err)
+		return
+	}
+	if err := c.s.TOTP.Disable(authModel.ID); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,30 +4,40 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
 )
 
-type UsersReponse []services.User
-
 type UserReponse services.User
 
-func (u UsersReponse) Render(w http.ResponseWriter, r *http.Request) error {
+func (u UserReponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (u UserReponse) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
+func userKey(u services.User) db.ID {
+	return u.ID
 }
 
 func (c Controller) Users(w http.ResponseWriter, r *http.Request) {
-	usrs, err := c.s.User.All(nil)
+	spec, err := specFromQuery(services.UserQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	usrs, err := c.s.User.Find(spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	count, err := c.s.User.Count(spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
 	render.Status(r, http.StatusOK)
-	render.Render(w, r, UsersReponse(usrs))
+	render.Render(w, r, newListReponse(r, usrs, count, spec, userKey, services.UserValues.For(spec)))
 }
 
 func (c Controller) User(w http.ResponseWriter, r *http.Request) {
@@ -42,5 +52,52 @@ func (c Controller) User(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	render.Status(r, http.StatusOK)
-	render.Render(w, r, UserReponse{usr.ID, usr.Name})
+	render.Render(w, r, UserReponse(usr.User))
+}
+
+const recentActivity = 10
+
+type UserStatsReponse stats.UserStats
+
+func (UserStatsReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (c Controller) userStats(id db.ID) (stats.UserStats, error) {
+	usr, err := c.s.User.ByPK(id)
+	if err != nil {
+		return stats.UserStats{}, err
+	}
+	ledger, err := c.s.Result.Current()
+	if err != nil {
+		return stats.UserStats{}, err
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		return stats.UserStats{}, err
+	}
+	sessions, err := c.s.Participant.CountByUser(id)
+	if err != nil {
+		return stats.UserStats{}, err
+	}
+	rounds, err := c.s.History.Rounds(services.HistoryFilter{UserID: id})
+	if err != nil {
+		return stats.UserStats{}, err
+	}
+	return stats.ForUser(usr.User, rounds, games, ledger, sessions, recentActivity), nil
+}
+
+func (c Controller) UserStats(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	us, err := c.userStats(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, UserStatsReponse(us))
 }
@@ -1,42 +1,52 @@
 package controller
 
 import (
+	"html/template"
 	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
 	"github.com/lindeneg/wager/internal/result"
 	"github.com/lindeneg/wager/internal/server/utils"
 	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
 	"github.com/lindeneg/wager/internal/templates"
 )
 
 type AuthProps struct {
-	Title    string
-	SharedJS string
-	Name     string
+	Title     string
+	SharedJS  string
+	CSRFToken string
+	Name      string
 }
 
 func (c Controller) LoginPage(w http.ResponseWriter, r *http.Request) {
 	c.t.auth.Execute(w, r, AuthProps{
-		Title:    "Bankmand Login",
-		SharedJS: c.e.SharedJS,
-		Name:     "login",
+		Title:     "Bankmand Login",
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Name:      "login",
 	})
 }
 
 func (c Controller) SignupPage(w http.ResponseWriter, r *http.Request) {
 	c.t.auth.Execute(w, r, AuthProps{
-		Title:    "Bankmand Signup",
-		SharedJS: c.e.SharedJS,
-		Name:     "signup",
+		Title:     "Bankmand Signup",
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Name:      "signup",
 	})
 }
 
 type commonProps struct {
 	Title       string
 	SharedJS    string
+	CSRFToken   string
 	Results     []templates.ResultBox
 	Cols        []string
 	Rows        []templates.SessionRow
@@ -46,6 +56,10 @@ type commonProps struct {
 	Offset      int
 	SizeConfig  []int
 	Count       int
+	Sorts       []string
+	Sort        string
+	// Export is the query of the sort and filters, for the csv exports of the list.
+	Export string
 }
 
 var sizeConfig = []int{10, 20, 50, 100}
@@ -70,6 +84,48 @@ func newCommonProps(
 	}
 }
 
+// separateActive reports if the active row is left out of the page,
+// which it is unless a state filter is requested.
+func separateActive(values url.Values) bool {
+	return values.Get("state") == ""
+}
+
+// exportQuery is the sort and filters of values as a query, including the
+// leading '?', with values of set taking precedence.
+func exportQuery(s query.Schema, values url.Values, set url.Values) string {
+	q := url.Values{}
+	for _, name := range append([]string{"sort", "order"}, filterNames(s)...) {
+		if v := values.Get(name); v != "" {
+			q.Set(name, v)
+		}
+	}
+	for name := range set {
+		q.Set(name, set.Get(name))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+func filterNames(s query.Schema) []string {
+	names := make([]string, 0, len(s.Filters))
+	for name := range s.Filters {
+		names = append(names, name)
+	}
+	return names
+}
+
+// onFirstPage reports if the active row is shown on top of the page.
+func onFirstPage(spec query.Spec) bool {
+	return spec.Cursor == nil && spec.P.Offset == 0
+}
+
+type homeProps struct {
+	commonProps
+	BalanceChart template.HTML
+}
+
 func (c Controller) HomePage(w http.ResponseWriter, r *http.Request) {
 	rs, err := c.s.Result.Current()
 	if err != nil {
@@ -81,19 +137,41 @@ func (c Controller) HomePage(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	p := pagination.FromQuery(r.URL.Query())
-	s, err := c.s.Session.AllWithSessions(p)
+	spec, err := specFromQuery(services.SessionQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	s, err := c.s.Session.AllWithSessions(spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	count, err := c.s.Session.Count()
+	count, err := c.s.Session.Count(spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	props := newCommonProps(templates.SessionCols, rs, p, usrs, count, c.e.SharedJS)
+	bh, err := c.balanceHistory(services.HistoryFilter{}, stats.BySession)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	props := homeProps{
+		commonProps:  newCommonProps(templates.SessionCols, rs, spec.P, usrs, count, c.e.SharedJS),
+		BalanceChart: templates.NewBalanceChart(bh, 720, 260).HTML(),
+	}
 	props.Title += " Sessions"
+	props.CSRFToken = utils.GetCtxCSRFToken(r)
+	props.Sorts = services.SessionQuery.SortNames()
+	props.Sort = spec.Sort
+	props.Export = exportQuery(services.SessionQuery, r.URL.Query(), nil)
+	if active, err := c.s.Session.Active(); err == nil && separateActive(r.URL.Query()) {
+		props.Count++
+		if onFirstPage(spec) {
+			s = append([]services.SessionWithGames{active}, s...)
+		}
+	}
 	props.Rows = templates.NewSessionRows(s, usrs)
 	c.t.home.Execute(w, r, props)
 }
@@ -101,12 +179,16 @@ func (c Controller) HomePage(w http.ResponseWriter, r *http.Request) {
 type sessionProps struct {
 	commonProps
 	ID                db.ID
+	Version           int
 	Games             []services.Game
 	Users             []services.User
 	IsSessionOver     bool
 	ActiveGameSession *services.GameSession
 	ActiveRound       *services.GameSessionRound
 	ActiveResult      []templates.ResultBox
+	Duration          time.Duration
+	LiveSince         string
+	Durations         stats.DurationStats
 	Wager             int
 	EndSession        bool
 	CancelSession     bool
@@ -130,8 +212,17 @@ func (c Controller) SessionPage(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	p := pagination.FromQuery(r.URL.Query())
-	gs, err := c.s.GSession.FromSession(id, p)
+	spec, err := specFromQuery(services.GameSessionQuery, r.URL.Query())
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	gs, err := c.s.GSession.FromSession(id, spec)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	all, err := c.s.GSession.FromSession(id, services.GameSessionQuery.Default())
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
@@ -141,7 +232,7 @@ func (c Controller) SessionPage(w http.ResponseWriter, r *http.Request) {
 		utils.RenderErrSlim(w, r, err)
 		return
 	}
-	count, err := c.s.GSession.CountFromSession(id)
+	count, err := c.s.GSession.CountFromSession(id, spec)
 	if err != nil {
 		utils.RenderErrSlim(w, r, err)
 		return
@@ -152,13 +243,14 @@ func (c Controller) SessionPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	isSessionOver := ss.Ended != nil
+	now := services.NewTime()
 	var activeGameSession *services.GameSession = nil
 	var activeRound *services.GameSessionRound = nil
 	ar := []templates.ResultBox{}
 	wager := 0
 	if isSessionOver {
-	} else if len(gs) > 0 && gs[0].Ended == nil {
-		activeGameSession = &gs[0]
+	} else if ags, err := c.s.GSession.ActiveFromSession(id); err == nil {
+		activeGameSession = &ags
 		a, i := activeGameSession.Rounds.Active()
 		if i > -1 {
 			activeRound = &a
@@ -171,17 +263,21 @@ func (c Controller) SessionPage(w http.ResponseWriter, r *http.Request) {
 	props := sessionProps{
 		commonProps: newCommonProps(
 			templates.GameSessionCols, ss.Result,
-			p, usrs, count, c.e.SharedJS),
+			spec.P, usrs, count, c.e.SharedJS),
 		ID:                ss.ID,
+		Version:           ss.Version,
 		Games:             games,
 		Users:             usrs,
 		IsSessionOver:     isSessionOver,
 		ActiveGameSession: activeGameSession,
 		ActiveRound:       activeRound,
 		ActiveResult:      ar,
+		Duration:          stats.Elapsed(ss.Started, ss.Ended, now),
+		LiveSince:         templates.LiveSince(ss.Started, ss.Ended),
+		Durations:         stats.Durations(all, now),
 		Wager:             wager,
-		EndSession:        !isSessionOver && len(gs) > 0 && activeGameSession == nil,
-		CancelSession:     !isSessionOver && len(gs) == 0,
+		EndSession:        !isSessionOver && len(all) > 0 && activeGameSession == nil,
+		CancelSession:     !isSessionOver && len(all) == 0,
 		NewRound:          !isSessionOver && activeGameSession != nil && wager == 0,
 		EndRound:          !isSessionOver && activeGameSession != nil && wager > 0,
 		StartGame:         !isSessionOver && activeGameSession == nil,
@@ -194,6 +290,180 @@ func (c Controller) SessionPage(w http.ResponseWriter, r *http.Request) {
 		NextRound: activeRound != nil,
 	}
 	props.Title += " Session"
+	props.CSRFToken = utils.GetCtxCSRFToken(r)
+	props.Sorts = services.GameSessionQuery.SortNames()
+	props.Sort = spec.Sort
+	props.Export = exportQuery(services.GameSessionQuery, r.URL.Query(),
+		url.Values{"session": {strconv.FormatUint(uint64(ss.ID), 10)}})
+	if activeGameSession != nil && separateActive(r.URL.Query()) {
+		props.Count++
+		if onFirstPage(spec) {
+			gs = append([]services.GameSession{*activeGameSession}, gs...)
+		}
+	}
 	props.Rows = templates.NewGameSessionRows(gs, games)
 	c.t.session.Execute(w, r, props)
 }
+
+type userProps struct {
+	Title     string
+	SharedJS  string
+	CSRFToken string
+	Stats     stats.UserStats
+}
+
+func (c Controller) UserPage(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.NotFoundErr(w, r)
+		return
+	}
+	us, err := c.userStats(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	c.t.user.Execute(w, r, userProps{
+		Title:     "Bankmanden " + us.Name,
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Stats:     us,
+	})
+}
+
+type gameProps struct {
+	Title     string
+	SharedJS  string
+	CSRFToken string
+	Stats     stats.GameStats
+	Ratings   []services.Rating
+}
+
+func (c Controller) GamePage(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.NotFoundErr(w, r)
+		return
+	}
+	gs, err := c.gameStats(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	rs, err := c.s.Rating.Current(id)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	c.t.game.Execute(w, r, gameProps{
+		Title:     "Bankmanden " + gs.Name,
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Stats:     gs,
+		Ratings:   rs,
+	})
+}
+
+type leaderboardProps struct {
+	Title     string
+	SharedJS  string
+	CSRFToken string
+	Entries   []stats.LeaderboardEntry
+	Games     []services.Game
+	Sorts     []stats.LeaderboardSort
+	From      string
+	To        string
+	Game      string
+	Sort      string
+}
+
+func (c Controller) LeaderboardPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := historyFilterFromQuery(q)
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	sort, err := stats.ParseLeaderboardSort(q.Get("sort"))
+	if err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	lb, err := c.leaderboard(f, sort)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	c.t.leaderboard.Execute(w, r, leaderboardProps{
+		Title:     "Bankmanden Leaderboard",
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Entries:   lb,
+		Games:     games,
+		Sorts:     stats.LeaderboardSorts,
+		From:      q.Get("from"),
+		To:        q.Get("to"),
+		Game:      q.Get("game"),
+		Sort:      string(sort),
+	})
+}
+
+type headToHeadProps struct {
+	Title     string
+	SharedJS  string
+	CSRFToken string
+	Users     []services.User
+	Games     []services.Game
+	Rivalry   *stats.HeadToHead
+	From      string
+	To        string
+	Game      string
+}
+
+func (c Controller) HeadToHeadPage(w http.ResponseWriter, r *http.Request) {
+	usrs, err := c.s.User.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	games, err := c.s.Game.All(nil)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	props := headToHeadProps{
+		Title:     "Bankmanden Head-To-Head",
+		SharedJS:  c.e.SharedJS,
+		CSRFToken: utils.GetCtxCSRFToken(r),
+		Users:     usrs,
+		Games:     games,
+		From:      q.Get("from"),
+		To:        q.Get("to"),
+		Game:      q.Get("game"),
+	}
+	if q.Has("a") || q.Has("b") {
+		a, b, err := rivalsFromQuery(q)
+		if err != nil {
+			utils.BadRequestErr(w, r, err)
+			return
+		}
+		f, err := historyFilterFromQuery(q)
+		if err != nil {
+			utils.BadRequestErr(w, r, err)
+			return
+		}
+		h, err := c.headToHead(a, b, f)
+		if err != nil {
+			utils.RenderErrSlim(w, r, err)
+			return
+		}
+		props.Rivalry = &h
+	}
+	c.t.headToHead.Execute(w, r, props)
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/webhook"
+)
+
+type WebhooksReponse []services.Webhook
+
+func (WebhooksReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type WebhookReponse services.WebhookWithSecret
+
+func (WebhookReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type WebhookDeliveriesReponse []services.WebhookDelivery
+
+func (WebhookDeliveriesReponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type NewWebhookReq struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (n *NewWebhookReq) Bind(r *http.Request) error {
+	var err error
+	if u, e := url.Parse(n.URL); e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		err = errors.Join(err, errors.New("'url' must be an absolute http or https url"))
+	} else if e := webhook.CheckHost(r.Context(), u.Hostname()); errors.Is(e, webhook.ErrForbiddenAddress) {
+		err = errors.Join(err, errors.New("'url' must not be a private, loopback or link-local address"))
+	} else if e != nil {
+		err = errors.Join(err, errors.New("'url' must have a host that resolves"))
+	}
+	if len(n.Events) == 0 {
+		err = errors.Join(err, errors.New("'events' is required"))
+	}
+	for _, ev := range n.Events {
+		if !webhook.IsEvent(ev) {
+			err = errors.Join(err, fmt.Errorf(
+				"'events' must only contain %s", strings.Join(webhook.Events, ", ")))
+			break
+		}
+	}
+	if n.Secret == "" {
+		n.Secret = webhook.NewSecret()
+	}
+	return err
+}
+
+func (c Controller) Webhooks(w http.ResponseWriter, r *http.Request) {
+	whs, err := c.s.Webhook.All()
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, WebhooksReponse(whs))
+}
+
+func (c Controller) NewWebhook(w http.ResponseWriter, r *http.Request) {
+	data := &NewWebhookReq{}
+	if err := render.Bind(r, data); err != nil {
+		utils.BadRequestErr(w, r, err)
+		return
+	}
+	wh, err := c.s.Webhook.Create(data.URL, data.Secret, data.Events)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, WebhookReponse(wh))
+}
+
+func (c Controller) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	if _, err := c.s.Webhook.ByPK(id); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	ds, err := c.s.Webhook.Deliveries(id, pagination.FromQuery(r.URL.Query()))
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.Render(w, r, WebhookDeliveriesReponse(ds))
+}
+
+func (c Controller) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.IDParam(r)
+	if err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	if err := c.s.Webhook.Delete(id); err != nil {
+		utils.RenderErrSlim(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
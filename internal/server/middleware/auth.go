@@ -5,18 +5,19 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/lindeneg/wager/internal/errvar"
 	"github.com/lindeneg/wager/internal/server/utils"
 )
 
 func (m Middleware) SetAuthUser(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		cookie, err := r.Cookie(m.e.JWTCookie)
-		if err != nil {
+		token, ok := m.authToken(r)
+		if !ok {
 			next.ServeHTTP(w, r)
 			return
 		}
-		authModel, err := utils.VerifyToken(m.e.JWTSecret, cookie.Value)
+		authModel, err := utils.VerifyToken(m.e.JWTSecret, token)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
@@ -26,7 +27,7 @@ func (m Middleware) SetAuthUser(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		if usr.Name != authModel.Name {
+		if usr.Name != authModel.Name || usr.Deactivated != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -54,3 +55,28 @@ func (m Middleware) EnsureAuthUser(next http.Handler) http.Handler {
 	}
 	return http.HandlerFunc(fn)
 }
+
+// EnsureAdmin refuses users not listed in ADMINS,
+// it must run after EnsureAuthUser.
+func (m Middleware) EnsureAdmin(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		usr, err := utils.GetCtxAuthModel(r)
+		if err != nil || !m.e.IsAdmin(usr.Name) {
+			utils.RenderErrEx(w, r, http.StatusForbidden, errvar.ErrAdminRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m Middleware) authToken(r *http.Request) (string, bool) {
+	if t, ok := utils.BearerToken(r); ok {
+		return t, true
+	}
+	cookie, err := r.Cookie(m.e.JWTCookie)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/server/utils"
+)
+
+func (m Middleware) SetCSRFToken(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if cookie, err := r.Cookie(utils.CSRFCookie); err == nil && cookie.Value != "" {
+			token = cookie.Value
+		} else {
+			t, err := utils.CreateCSRFToken()
+			if err != nil {
+				utils.InternalErr(w, r)
+				return
+			}
+			token = t
+			utils.SetCSRFCookie(w, m.e, token)
+		}
+		ctx := context.WithValue(r.Context(), utils.CSRFTokenKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// VerifyCSRF rejects state-changing requests that a browser made on behalf of
+// another site. Requests authenticated with a bearer token are exempt, as
+// browsers never attach those automatically.
+func (m Middleware) VerifyCSRF(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := utils.BearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := verifyCSRF(r); err != nil {
+			utils.RenderErrEx(w, r, http.StatusForbidden, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func verifyCSRF(r *http.Request) error {
+	if h := r.Header.Get(utils.CSRFHeader); h != "" {
+		cookie, err := r.Cookie(utils.CSRFCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(h)) != 1 {
+			return errvar.ErrCSRFToken
+		}
+		return nil
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	case "":
+	default:
+		return errvar.ErrCSRFOrigin
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return errvar.ErrCSRFOrigin
+	}
+	return nil
+}
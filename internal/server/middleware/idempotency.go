@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks responses replayed from an earlier request.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+const maxIdempotencyKey = 255
+
+// headers that belong to the connection rather than the stored response
+var unstoredHeaders = []string{"Set-Cookie", "Vary", "Content-Encoding", "Content-Length"}
+
+// Idempotency replays the stored response of POST requests retried with
+// the same Idempotency-Key. Requests without the header are unaffected.
+// Responses that set cookies or failed with a server error are not stored,
+// so retrying them runs the request again.
+func (m Middleware) Idempotency(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			utils.RenderErr(w, r, errvar.ErrIdempotencyKey)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			utils.BadRequestErr(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var userID db.ID
+		if usr, err := utils.GetCtxAuthModel(r); err == nil {
+			userID = usr.ID
+		}
+		fp := fingerprint(r, body)
+		err = m.s.Idempotency.Purge(services.NewTime().Add(-m.e.IdempotencyTTL))
+		if err != nil {
+			utils.RenderErrSlim(w, r, err)
+			return
+		}
+		if err := m.s.Idempotency.Begin(userID, key, fp); err != nil {
+			m.replay(w, r, userID, key, fp, err)
+			return
+		}
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		buf := &bytes.Buffer{}
+		ww.Tee(buf)
+		stored := false
+		defer func() {
+			if !stored {
+				m.s.Idempotency.Release(userID, key)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError ||
+			status == http.StatusTooManyRequests || ww.Header().Get("Set-Cookie") != "" {
+			return
+		}
+		header := ww.Header().Clone()
+		for _, h := range unstoredHeaders {
+			header.Del(h)
+		}
+		err = m.s.Idempotency.Complete(userID, key, status, header, buf.Bytes())
+		if err != nil {
+			fmt.Printf("ERROR [%s] '%s'\n", r.Context().Value(chimw.RequestIDKey), err)
+			return
+		}
+		stored = true
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m Middleware) replay(
+	w http.ResponseWriter, r *http.Request, userID db.ID, key string, fp string, beginErr error,
+) {
+	res, err := m.s.Idempotency.Get(userID, key)
+	switch {
+	case err != nil:
+		utils.RenderErrSlim(w, r, beginErr)
+	case res.Fingerprint != fp:
+		utils.RenderErr(w, r, errvar.ErrIdempotencyKeyReused)
+	case res.Status == 0:
+		utils.RenderErr(w, r, errvar.ErrIdempotencyKeyInFlight)
+	default:
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(res.Status)
+		w.Write(res.Body)
+	}
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
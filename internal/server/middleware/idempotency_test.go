@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func TestIdempotency(t *testing.T) {
+	t.Run("replays the stored response", func(t *testing.T) {
+		h, calls := newIdempotentHandler(t, nil)
+		first := post(h, "/api/game", "key", `{"name":"golf"}`, 1)
+		assertInt(t, first.Code, http.StatusCreated)
+		again := post(h, "/api/game", "key", `{"name":"golf"}`, 1)
+		assertInt(t, again.Code, http.StatusCreated)
+		assertString(t, again.Body.String(), first.Body.String())
+		assertString(t, again.Header().Get(IdempotentReplayedHeader), "true")
+		assertString(t, again.Header().Get("X-Call"), "1")
+		assertInt(t, int(calls.Load()), 1)
+	})
+
+	t.Run("refuses a key reused for another request", func(t *testing.T) {
+		h, calls := newIdempotentHandler(t, nil)
+		assertInt(t, post(h, "/api/game", "key", `{"name":"golf"}`, 1).Code, http.StatusCreated)
+		assertInt(t, post(h, "/api/game", "key", `{"name":"chess"}`, 1).Code, http.StatusUnprocessableEntity)
+		assertInt(t, post(h, "/api/session", "key", `{"name":"golf"}`, 1).Code, http.StatusUnprocessableEntity)
+		assertInt(t, int(calls.Load()), 1)
+	})
+
+	t.Run("refuses a key while its request is in progress", func(t *testing.T) {
+		entered, release := make(chan struct{}), make(chan struct{})
+		h, calls := newIdempotentHandler(t, func() {
+			close(entered)
+			<-release
+		})
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- post(h, "/api/game", "key", `{"name":"golf"}`, 1) }()
+		<-entered
+		assertInt(t, post(h, "/api/game", "key", `{"name":"golf"}`, 1).Code, http.StatusConflict)
+		close(release)
+		assertInt(t, (<-done).Code, http.StatusCreated)
+		assertInt(t, int(calls.Load()), 1)
+	})
+
+	t.Run("runs server errors and responses with cookies again", func(t *testing.T) {
+		h, calls := newIdempotentHandler(t, nil)
+		for _, path := range []string{"/fail", "/cookie"} {
+			for i := 0; i < 2; i++ {
+				w := post(h, path, "key"+path, "{}", 1)
+				assertString(t, w.Header().Get(IdempotentReplayedHeader), "")
+			}
+		}
+		assertInt(t, int(calls.Load()), 4)
+	})
+
+	t.Run("scopes keys to their user", func(t *testing.T) {
+		h, calls := newIdempotentHandler(t, nil)
+		for _, userID := range []db.ID{1, 2, 0} {
+			w := post(h, "/api/game", "key", `{"name":"golf"}`, userID)
+			assertInt(t, w.Code, http.StatusCreated)
+			assertString(t, w.Header().Get(IdempotentReplayedHeader), "")
+		}
+		assertInt(t, int(calls.Load()), 3)
+	})
+}
+
+// newIdempotentHandler counts the requests that reach it and calls block
+// with each of them. It fails on /fail and sets a cookie on /cookie.
+func newIdempotentHandler(t *testing.T, block func()) (http.Handler, *atomic.Int32) {
+	t.Helper()
+	store, err := db.Open(filepath.Join(t.TempDir(), "wager.db"))
+	assertNoError(t, err)
+	t.Cleanup(func() { store.DB.Close() })
+	store.Dir = filepath.Join("..", "..", "..", "sql")
+	assertNoError(t, store.Migrate())
+	m := New(env.Env{IdempotencyTTL: time.Hour}, services.InitServices(store))
+	calls := &atomic.Int32{}
+	return m.Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if block != nil {
+			block()
+		}
+		w.Header().Set("X-Call", fmt.Sprint(n))
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "wager", Value: "token"})
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"call":%d}`, n)
+		}
+	})), calls
+}
+
+func post(h http.Handler, path string, key string, body string, userID db.ID) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	if userID > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), utils.AuthModelKey, utils.AuthModel{ID: userID}))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertInt(t testing.TB, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func assertString(t testing.TB, got string, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/lindeneg/wager/internal/openapi"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/server/controller"
+	"github.com/lindeneg/wager/internal/server/middleware"
+	"github.com/lindeneg/wager/internal/server/utils"
+	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
+)
+
+const description = `Unsafe methods require either a bearer token or the X-CSRF-Token header.
+Admin routes are limited to the users named in the ADMINS environment variable.
+
+Webhook deliveries are signed in the X-Wager-Signature header
+as sha256=<hex encoded HMAC-SHA256 of the body keyed with the webhook secret>.`
+
+type endpoint struct {
+	method  string
+	path    string
+	tag     string
+	summary string
+	public  bool
+	params  []openapi.Parameter
+	body    any
+	// bodyMime is the media type of body, defaults to application/json.
+	bodyMime string
+	status   int
+	res      any
+	// mime is the media type of res, defaults to application/json.
+	mime string
+	errs []int
+	// etag is set if the response has the version of the resource in an ETag,
+	// ifMatch if the request takes the ETag in If-Match.
+	etag    bool
+	ifMatch bool
+}
+
+var (
+	idSchema   = &openapi.Schema{Type: "integer", Minimum: ptr(1)}
+	dateSchema = &openapi.Schema{Type: "string", Description: "a date (YYYY-MM-DD) or RFC3339 timestamp"}
+)
+
+var idempotencyKey = openapi.Parameter{
+	Name: middleware.IdempotencyKeyHeader, In: "header",
+	Description: "replays the stored response of an earlier request with the same key, " +
+		"responses that set cookies or failed with a server error are not stored",
+	Schema: &openapi.Schema{Type: "string"},
+}
+
+var ifMatch = openapi.Parameter{
+	Name: "If-Match", In: "header", Required: true,
+	Description: "the ETag of the resource, the request fails if the resource has changed since, " +
+		"\"*\" changes any version",
+	Schema: &openapi.Schema{Type: "string"},
+}
+
+var etag = openapi.Header{
+	Description: "the version of the resource, as a quoted integer",
+	Schema:      &openapi.Schema{Type: "string"},
+}
+
+// filterSchemas describes the filters of the list queries by name.
+var filterSchemas = map[string]*openapi.Schema{
+	"participant": idSchema,
+	"game":        idSchema,
+	"session":     idSchema,
+	"from":        dateSchema,
+	"to":          dateSchema,
+	"state":       {Type: "string", Enum: []string{"active", "ended", "all"}, Description: "defaults to ended"},
+	"name":        {Type: "string", Description: "case-insensitive substring"},
+}
+
+// endpoints are every route of apiRouter, relative to /api.
+var endpoints = []endpoint{
+	{method: "GET", path: "/openapi.json", tag: "meta", summary: "This document", public: true,
+		status: http.StatusOK, res: map[string]any{}},
+
+	{method: "POST", path: "/login", tag: "auth", summary: "Sign in and set the auth cookie", public: true,
+		body: controller.LoginReq{}, status: http.StatusNoContent,
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnauthorized, http.StatusTooManyRequests}},
+	{method: "POST", path: "/signup", tag: "auth", summary: "Create a user and set the auth cookie", public: true,
+		body: controller.SignupReq{}, status: http.StatusCreated,
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: "GET", path: "/signout", tag: "auth", summary: "Remove the auth cookie", public: true,
+		status: http.StatusNoContent},
+
+	{method: "GET", path: "/user", tag: "user", summary: "List users",
+		params: listParams(services.UserQuery), status: http.StatusOK,
+		res: controller.ListReponse[services.User]{}, errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/user/{id}", tag: "user", summary: "Get a user",
+		status: http.StatusOK, res: controller.UserReponse{}, errs: []int{http.StatusNotFound}},
+	{method: "GET", path: "/user/{id}/stats", tag: "user", summary: "Get the statistics of a user",
+		status: http.StatusOK, res: controller.UserStatsReponse{}, errs: []int{http.StatusNotFound}},
+	{method: "POST", path: "/user/totp", tag: "user", summary: "Start two-factor enrolment",
+		status: http.StatusOK, res: controller.TOTPEnrolReponse{}, errs: []int{http.StatusUnprocessableEntity}},
+	{method: "POST", path: "/user/totp/enable", tag: "user", summary: "Enable two-factor authentication",
+		body: controller.TOTPCodeReq{}, status: http.StatusOK, res: controller.RecoveryCodesReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: "POST", path: "/user/totp/disable", tag: "user", summary: "Disable two-factor authentication",
+		body: controller.TOTPCodeReq{}, status: http.StatusNoContent,
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+
+	{method: "GET", path: "/result", tag: "result", summary: "Get the result of all resolved sessions",
+		status: http.StatusOK, res: controller.ResultReponse{}},
+
+	{method: "GET", path: "/stats/leaderboard", tag: "stats", summary: "Rank users",
+		params: append(historyParams(), enumParam("sort", "defaults to net", stats.LeaderboardSorts)),
+		status: http.StatusOK, res: controller.LeaderboardReponse{}, errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/stats/head-to-head", tag: "stats", summary: "Compare two users",
+		params: append([]openapi.Parameter{
+			{Name: "a", In: "query", Required: true, Schema: idSchema},
+			{Name: "b", In: "query", Required: true, Schema: idSchema},
+		}, historyParams()...),
+		status: http.StatusOK, res: controller.HeadToHeadReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "GET", path: "/stats/balance", tag: "stats", summary: "Get the balance of every user over time",
+		params: append(historyParams(), enumParam("by", "defaults to session",
+			[]stats.Granularity{stats.ByRound, stats.ByGameSession, stats.BySession})),
+		status: http.StatusOK, res: controller.BalanceHistoryReponse{}, errs: []int{http.StatusBadRequest}},
+
+	{method: "GET", path: "/game", tag: "game", summary: "List games",
+		status: http.StatusOK, res: controller.GamesReponse{}},
+	{method: "POST", path: "/game", tag: "game", summary: "Create a game",
+		body: controller.NewGameReq{}, status: http.StatusCreated, res: controller.GameReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusUnprocessableEntity}},
+	{method: "GET", path: "/game/{id}/stats", tag: "game", summary: "Get the statistics of a game",
+		status: http.StatusOK, res: controller.GameStatsReponse{}, errs: []int{http.StatusNotFound}},
+	{method: "GET", path: "/game/{id}/ratings", tag: "game", summary: "Get the current ratings of a game",
+		status: http.StatusOK, res: controller.RatingsReponse{}, errs: []int{http.StatusNotFound}},
+	{method: "GET", path: "/game/{id}/ratings/history", tag: "game", summary: "Get the rating history of a game",
+		params: []openapi.Parameter{{Name: "user", In: "query", Schema: idSchema}},
+		status: http.StatusOK, res: controller.RatingHistoryReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	{method: "GET", path: "/game-session/{id}", tag: "game-session",
+		summary: "List the game sessions of a session, the ETag is that of the active game session",
+		params:  listParams(services.GameSessionQuery), status: http.StatusOK,
+		res: controller.ListReponse[services.GameSession]{}, errs: []int{http.StatusBadRequest},
+		etag: true},
+	{method: "POST", path: "/game-session", tag: "game-session", summary: "Start a game session",
+		body: controller.NewGameSessionReq{}, status: http.StatusCreated, res: controller.GameSessionRes{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		etag: true},
+	{method: "POST", path: "/game-session/{id}/new-round", tag: "game-session", summary: "Start a round",
+		body: controller.NewGameSessionRoundReq{}, status: http.StatusOK, res: controller.GameSessionRes{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		etag: true, ifMatch: true},
+	{method: "POST", path: "/game-session/{id}/end-round", tag: "game-session", summary: "End the active round",
+		body: controller.EndGameSessionRoundReq{}, status: http.StatusOK, res: controller.GameSessionRes{},
+		errs: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		etag: true, ifMatch: true},
+	{method: "POST", path: "/game-session/{id}/end", tag: "game-session", summary: "End a game session",
+		status: http.StatusOK, res: controller.GameSessionRes{},
+		errs: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		etag: true, ifMatch: true},
+	{method: "DELETE", path: "/game-session/{id}", tag: "game-session", summary: "Cancel a game session",
+		status: http.StatusNoContent, errs: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		ifMatch: true},
+
+	{method: "GET", path: "/export/sessions.csv", tag: "export", summary: "Download the sessions as csv",
+		params: filterParams(services.SessionQuery), status: http.StatusOK, res: "", mime: "text/csv",
+		errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/export/game-sessions.csv", tag: "export", summary: "Download the game sessions as csv",
+		params: filterParams(services.GameSessionQuery), status: http.StatusOK, res: "", mime: "text/csv",
+		errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/export/rounds.csv", tag: "export",
+		summary: "Download the ended rounds of the game sessions as csv",
+		params:  filterParams(services.GameSessionQuery), status: http.StatusOK, res: "", mime: "text/csv",
+		errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/export/balances.csv", tag: "export", summary: "Download the current result as csv",
+		status: http.StatusOK, res: "", mime: "text/csv"},
+
+	{method: "GET", path: "/admin/event", tag: "admin", summary: "List events, such as failed logins",
+		params: pageParams(), status: http.StatusOK, res: controller.EventsReponse{}, errs: []int{http.StatusForbidden}},
+	{method: "GET", path: "/admin/export", tag: "admin", summary: "Download a backup of the whole history",
+		params: []openapi.Parameter{{Name: "passwords", In: "query", Description: "include password hashes",
+			Schema: &openapi.Schema{Type: "boolean"}}},
+		status: http.StatusOK, res: controller.ExportReponse{}, errs: []int{http.StatusForbidden}},
+	{method: "POST", path: "/admin/import-history", tag: "admin",
+		summary: "Create ended sessions from a csv of bets tracked before this app",
+		params: []openapi.Parameter{{Name: "dry-run", In: "query",
+			Description: "report what would be created without creating it, responds with 200",
+			Schema:      &openapi.Schema{Type: "boolean"}}},
+		body: "", bodyMime: "text/csv", status: http.StatusCreated, res: controller.ImportReportReponse{},
+		errs: []int{http.StatusBadRequest}},
+	{method: "POST", path: "/admin/ratings/recompute", tag: "admin", summary: "Recompute all ratings",
+		status: http.StatusNoContent, errs: []int{http.StatusForbidden}},
+	{method: "GET", path: "/admin/webhook", tag: "admin", summary: "List webhooks",
+		status: http.StatusOK, res: controller.WebhooksReponse{}, errs: []int{http.StatusForbidden}},
+	{method: "POST", path: "/admin/webhook", tag: "admin", summary: "Subscribe to events of a public url",
+		body: controller.NewWebhookReq{}, status: http.StatusCreated, res: controller.WebhookReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusForbidden}},
+	{method: "GET", path: "/admin/webhook/{id}/deliveries", tag: "admin", summary: "List the delivery log of a webhook",
+		params: pageParams(), status: http.StatusOK, res: controller.WebhookDeliveriesReponse{},
+		errs: []int{http.StatusNotFound, http.StatusForbidden}},
+	{method: "DELETE", path: "/admin/webhook/{id}", tag: "admin", summary: "Delete a webhook",
+		status: http.StatusNoContent, errs: []int{http.StatusNotFound, http.StatusForbidden}},
+
+	{method: "GET", path: "/session", tag: "session", summary: "List sessions with their game sessions",
+		params: listParams(services.SessionQuery), status: http.StatusOK,
+		res: controller.ListReponse[services.SessionWithGames]{}, errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/session/slim", tag: "session", summary: "List sessions",
+		params: listParams(services.SessionQuery), status: http.StatusOK,
+		res: controller.ListReponse[services.Session]{}, errs: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/session/{id}/has-active", tag: "session", summary: "Check for an active game session",
+		status: http.StatusOK, res: controller.BoolResponse(false)},
+	{method: "GET", path: "/session/has-active", tag: "session", summary: "Check for an active session",
+		status: http.StatusOK, res: controller.BoolResponse(false)},
+	{method: "GET", path: "/session/{id}", tag: "session", summary: "Get a session",
+		status: http.StatusOK, res: controller.SessionReponse{}, errs: []int{http.StatusNotFound},
+		etag: true},
+	{method: "GET", path: "/session/{id}/events", tag: "session",
+		summary: "Stream the game session events of a session, named by their kind",
+		status:  http.StatusOK, res: services.GameSessionEvent{}, mime: "text/event-stream",
+		errs: []int{http.StatusNotFound}},
+	{method: "POST", path: "/session", tag: "session", summary: "Start a session",
+		body: controller.NewSessionReq{}, status: http.StatusCreated, res: controller.SessionReponse{},
+		errs: []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		etag: true},
+	{method: "POST", path: "/session/{id}/end", tag: "session", summary: "End a session",
+		status: http.StatusOK, res: controller.SessionReponse{},
+		errs: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		etag: true, ifMatch: true},
+	{method: "DELETE", path: "/session/{id}", tag: "session", summary: "Cancel a session",
+		status: http.StatusNoContent, errs: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		ifMatch: true},
+}
+
+func openAPI(cookie string) *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "Wager",
+		Description: description,
+		Version:     "1.0.0",
+	})
+	d.Servers = []openapi.Server{{URL: "/api"}}
+	d.Security = []openapi.Requirement{{"cookie": {}}, {"bearer": {}}}
+	d.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"cookie": {Type: "apiKey", In: "cookie", Name: cookie},
+		"bearer": {Type: "http", Scheme: "bearer"},
+	}
+	errRes := d.Schema(utils.ErrorResponse{})
+	for _, e := range endpoints {
+		params := e.params
+		errs := append([]int{http.StatusInternalServerError}, e.errs...)
+		if e.method == http.MethodPost {
+			params = append([]openapi.Parameter{idempotencyKey}, params...)
+			errs = append(errs, http.StatusConflict, http.StatusUnprocessableEntity)
+		}
+		if e.ifMatch {
+			params = append(params, ifMatch)
+			errs = append(errs, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+		}
+		res := openapi.Response{
+			Description: http.StatusText(e.status),
+			Content:     content(e.mime, d.Schema(e.res)),
+		}
+		if e.etag {
+			res.Headers = map[string]openapi.Header{"ETag": etag}
+		}
+		op := openapi.Operation{
+			Tags:       []string{e.tag},
+			Summary:    e.summary,
+			Parameters: params,
+			Responses:  map[string]openapi.Response{strconv.Itoa(e.status): res},
+		}
+		if e.body != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: content(e.bodyMime, d.Schema(e.body))}
+		}
+		if e.public {
+			op.Security = &[]openapi.Requirement{}
+		} else {
+			errs = append(errs, http.StatusUnauthorized)
+		}
+		if e.method != http.MethodGet {
+			errs = append(errs, http.StatusForbidden)
+		}
+		for _, code := range errs {
+			op.Responses[strconv.Itoa(code)] = openapi.Response{
+				Description: http.StatusText(code),
+				Content:     openapi.JSON(errRes),
+			}
+		}
+		d.Add(e.method, e.path, op)
+	}
+	return d
+}
+
+func openAPIHandler(d *openapi.Document) http.HandlerFunc {
+	b, err := json.Marshal(d)
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	}
+}
+
+func content(mime string, s *openapi.Schema) map[string]openapi.MediaType {
+	if s == nil {
+		return nil
+	}
+	if mime == "" {
+		return openapi.JSON(s)
+	}
+	return map[string]openapi.MediaType{mime: {Schema: s}}
+}
+
+func listParams(s query.Schema) []openapi.Parameter {
+	params := append(pageParams(),
+		openapi.Parameter{Name: "after", In: "query", Description: "the next cursor of a page",
+			Schema: &openapi.Schema{Type: "string"}},
+		openapi.Parameter{Name: "before", In: "query", Description: "the prev cursor of a page",
+			Schema: &openapi.Schema{Type: "string"}},
+	)
+	return append(params, filterParams(s)...)
+}
+
+// filterParams are the sort and filters of s, without pagination.
+func filterParams(s query.Schema) []openapi.Parameter {
+	sorts := s.SortNames()
+	params := []openapi.Parameter{
+		{Name: "sort", In: "query", Description: "defaults to " + sorts[0],
+			Schema: &openapi.Schema{Type: "string", Enum: sorts}},
+		{Name: "order", In: "query", Description: "defaults to " + string(s.DefaultOrder),
+			Schema: &openapi.Schema{Type: "string", Enum: []string{string(query.Asc), string(query.Desc)}}},
+	}
+	names := make([]string, 0, len(s.Filters))
+	for name := range s.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params = append(params, openapi.Parameter{Name: name, In: "query", Schema: filterSchemas[name]})
+	}
+	return params
+}
+
+func pageParams() []openapi.Parameter {
+	return []openapi.Parameter{
+		{Name: "limit", In: "query", Description: "defaults to 10", Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "offset", In: "query", Description: "defaults to 0", Schema: &openapi.Schema{Type: "integer"}},
+	}
+}
+
+func historyParams() []openapi.Parameter {
+	return []openapi.Parameter{
+		{Name: "from", In: "query", Schema: dateSchema},
+		{Name: "to", In: "query", Schema: dateSchema},
+		{Name: "game", In: "query", Schema: idSchema},
+	}
+}
+
+func enumParam[T ~string](name string, description string, values []T) openapi.Parameter {
+	enum := make([]string, len(values))
+	for i, v := range values {
+		enum[i] = string(v)
+	}
+	return openapi.Parameter{Name: name, In: "query", Description: description,
+		Schema: &openapi.Schema{Type: "string", Enum: enum}}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
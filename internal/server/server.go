@@ -1,15 +1,21 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/lindeneg/wager/internal/env"
+	"github.com/lindeneg/wager/internal/openapi"
 	"github.com/lindeneg/wager/internal/server/controller"
 	"github.com/lindeneg/wager/internal/server/middleware"
 	"github.com/lindeneg/wager/internal/services"
@@ -31,6 +37,7 @@ func New(e env.Env, s *services.Services, p fs.FS) *Server {
 	r.Use(chimw.Recoverer)
 	r.Use(chimw.Compress(5))
 	r.Use(m.SetAuthUser)
+	r.Use(m.SetCSRFToken)
 
 	r.Handle("/favicon.ico", http.FileServer(http.FS(p)))
 	r.Handle("/public/*", http.StripPrefix("/public/", http.FileServer(http.FS(p))))
@@ -39,7 +46,7 @@ func New(e env.Env, s *services.Services, p fs.FS) *Server {
 		w.Write([]byte("pong"))
 	})
 
-	r.Mount("/api", apiRouter(c, m))
+	r.Mount("/api", apiRouter(c, m, openAPI(e.JWTCookie)))
 	r.Mount("/", viewRouter(c, m))
 
 	fmt.Printf("MODE: %q\n", e.Mode)
@@ -47,16 +54,42 @@ func New(e env.Env, s *services.Services, p fs.FS) *Server {
 	return &Server{r, e.Port}
 }
 
-func (s *Server) Start() {
+// Start serves until SIGINT or SIGTERM,
+// then waits for the requests in flight before it returns.
+func (s *Server) Start() error {
 	addr := fmt.Sprintf("localhost:%d", s.port)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: s.r,
+		// Event streams end with the context of their request.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
 	fmt.Printf("Listening on: http://%s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, s.r))
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	fmt.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
 
-func apiRouter(c controller.Controller, m middleware.Middleware) chi.Router {
+func apiRouter(c controller.Controller, m middleware.Middleware, spec *openapi.Document) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(m.JSONContentType)
+	r.Use(m.VerifyCSRF)
+	r.Use(m.Idempotency)
+
+	r.Get("/openapi.json", openAPIHandler(spec))
 
 	r.Post("/login", c.Login)
 	r.Post("/signup", c.Signup)
@@ -67,12 +100,25 @@ func apiRouter(c controller.Controller, m middleware.Middleware) chi.Router {
 
 		r.Get("/user", c.Users)
 		r.Get("/user/{id}", c.User)
+		r.Get("/user/{id}/stats", c.UserStats)
+		r.Post("/user/totp", c.EnrolTOTP)
+		r.Post("/user/totp/enable", c.EnableTOTP)
+		r.Post("/user/totp/disable", c.DisableTOTP)
 
 		r.Get("/result", c.Result)
 
+		r.Route("/stats", func(r chi.Router) {
+			r.Get("/leaderboard", c.Leaderboard)
+			r.Get("/head-to-head", c.HeadToHead)
+			r.Get("/balance", c.BalanceHistory)
+		})
+
 		r.Route("/game", func(r chi.Router) {
 			r.Get("/", c.Games)
 			r.Post("/", c.NewGame)
+			r.Get("/{id}/stats", c.GameStats)
+			r.Get("/{id}/ratings", c.GameRatings)
+			r.Get("/{id}/ratings/history", c.GameRatingHistory)
 		})
 
 		r.Route("/game-session", func(r chi.Router) {
@@ -84,12 +130,34 @@ func apiRouter(c controller.Controller, m middleware.Middleware) chi.Router {
 			r.Delete("/{id}", c.CancelGameSession)
 		})
 
+		r.Route("/export", func(r chi.Router) {
+			r.Get("/sessions.csv", c.ExportSessions)
+			r.Get("/game-sessions.csv", c.ExportGameSessions)
+			r.Get("/rounds.csv", c.ExportRounds)
+			r.Get("/balances.csv", c.ExportBalances)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(m.EnsureAdmin)
+			r.Get("/event", c.Events)
+			r.Get("/export", c.Export)
+			r.Post("/import-history", c.ImportHistory)
+			r.Post("/ratings/recompute", c.RecomputeRatings)
+			r.Route("/webhook", func(r chi.Router) {
+				r.Get("/", c.Webhooks)
+				r.Post("/", c.NewWebhook)
+				r.Get("/{id}/deliveries", c.WebhookDeliveries)
+				r.Delete("/{id}", c.DeleteWebhook)
+			})
+		})
+
 		r.Route("/session", func(r chi.Router) {
 			r.Get("/", c.Sessions)
 			r.Get("/slim", c.SessionsSlim)
 			r.Get("/{id}/has-active", c.HasActiveGameSession)
 			r.Get("/has-active", c.HasActiveSession)
 			r.Get("/{id}", c.Session)
+			r.Get("/{id}/events", c.SessionEvents)
 			r.Post("/", c.NewSession)
 			r.Post("/{id}/end", c.EndSession)
 			r.Delete("/{id}", c.CancelSession)
@@ -109,6 +177,12 @@ func viewRouter(c controller.Controller, m middleware.Middleware) chi.Router {
 		r.Use(m.EnsureAuthUser)
 
 		r.Get("/session/{id}", c.SessionPage)
+		r.Get("/session/{id}/report", c.SessionReportPage)
+		r.Get("/session/{id}/report.md", c.SessionReportMarkdown)
+		r.Get("/user/{id}", c.UserPage)
+		r.Get("/game/{id}", c.GamePage)
+		r.Get("/leaderboard", c.LeaderboardPage)
+		r.Get("/head-to-head", c.HeadToHeadPage)
 		r.Get("/", c.HomePage)
 	})
 	return r
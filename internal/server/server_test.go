@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lindeneg/wager/internal/server/controller"
+	"github.com/lindeneg/wager/internal/server/middleware"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func TestOpenAPI(t *testing.T) {
+	spec := openAPI("auth")
+	r := apiRouter(controller.Controller{}, middleware.Middleware{}, spec)
+
+	t.Run("documents every route", func(t *testing.T) {
+		routes := map[string]bool{}
+		err := chi.Walk(r, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if route != "/" {
+				route = strings.TrimSuffix(route, "/")
+			}
+			routes[method+" "+route] = true
+			if !spec.Has(method, route) {
+				t.Errorf("%s %s has no spec entry", method, route)
+			}
+			return nil
+		})
+		assertNoError(t, err)
+		for _, route := range spec.Routes() {
+			if !routes[route] {
+				t.Errorf("%s has a spec entry but no route", route)
+			}
+		}
+	})
+
+	t.Run("describes every list filter", func(t *testing.T) {
+		for _, schema := range []struct {
+			name    string
+			filters []string
+		}{
+			{"session", filterNames(services.SessionQuery.Filters)},
+			{"game-session", filterNames(services.GameSessionQuery.Filters)},
+			{"user", filterNames(services.UserQuery.Filters)},
+		} {
+			for _, f := range schema.filters {
+				if filterSchemas[f] == nil {
+					t.Errorf("%s filter %q has no schema", schema.name, f)
+				}
+			}
+		}
+	})
+
+	t.Run("documents idempotency keys of every post", func(t *testing.T) {
+		for path, item := range spec.Paths {
+			if item.Post == nil {
+				continue
+			}
+			found := false
+			for _, p := range item.Post.Parameters {
+				found = found || (p.In == "header" && p.Name == middleware.IdempotencyKeyHeader)
+			}
+			if !found {
+				t.Errorf("POST %s has no %s parameter", path, middleware.IdempotencyKeyHeader)
+			}
+		}
+	})
+
+	t.Run("is valid json", func(t *testing.T) {
+		b, err := json.Marshal(spec)
+		assertNoError(t, err)
+		var v map[string]any
+		assertNoError(t, json.Unmarshal(b, &v))
+		if v["openapi"] != "3.0.3" {
+			t.Errorf("got version %v", v["openapi"])
+		}
+	})
+}
+
+func filterNames[T any](filters map[string]T) []string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	return names
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
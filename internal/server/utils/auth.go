@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -21,6 +24,12 @@ const cookieExpire = 7 * 24 * 60 * 60
 
 const AuthModelKey = "auth-model"
 
+const CSRFTokenKey = "csrf-token"
+
+const CSRFCookie = "csrf-token"
+
+const CSRFHeader = "X-CSRF-Token"
+
 func GetCtxAuthModel(r *http.Request) (AuthModel, error) {
 	usr := r.Context().Value(AuthModelKey)
 	authModel, ok := usr.(AuthModel)
@@ -30,6 +39,20 @@ func GetCtxAuthModel(r *http.Request) (AuthModel, error) {
 	return authModel, nil
 }
 
+func GetCtxCSRFToken(r *http.Request) string {
+	t, _ := r.Context().Value(CSRFTokenKey).(string)
+	return t
+}
+
+func BearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	t, ok := strings.CutPrefix(h, "Bearer ")
+	if !ok || t == "" {
+		return "", false
+	}
+	return t, true
+}
+
 func VerifyToken(secret string, value string) (AuthModel, error) {
 	validated, err := jwt.Parse(value, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -68,6 +91,14 @@ func CreateToken(secret string, id db.ID, name string) (string, error) {
 	return s, nil
 }
 
+// ValidateUsername enforces the length of usernames, wherever users are named.
+func ValidateUsername(name string) error {
+	if len(name) < 3 || len(name) > 12 {
+		return errors.New("'username' must be more between 3-12 characters")
+	}
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
 	if err != nil {
@@ -101,3 +132,22 @@ func RemoveAuthCookie(w http.ResponseWriter, e env.Env) {
 		MaxAge: -1,
 	})
 }
+
+func CreateCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func SetCSRFCookie(w http.ResponseWriter, e env.Env, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+		Secure:   e.Mode == env.ModeProd,
+	})
+}
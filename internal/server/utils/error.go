@@ -3,13 +3,16 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/lindeneg/wager/internal/db"
 	e "github.com/lindeneg/wager/internal/errvar"
-	"github.com/mattn/go-sqlite3"
 )
 
 type ErrorResponse struct {
@@ -29,10 +32,18 @@ func message(code int) string {
 		return "The requested action could not be exercised due to malformed syntax."
 	case http.StatusUnauthorized:
 		return "The provided credentials are either invalid or has insufficient privilege to perform the requested action."
+	case http.StatusForbidden:
+		return "The request was refused. Please reload the page and try again."
 	case http.StatusNotFound:
 		return "The requested resource could not be found."
+	case http.StatusConflict:
+		return "The request conflicts with a concurrent request. Please try again shortly."
+	case http.StatusPreconditionFailed:
+		return "The resource has changed since it was fetched. Please reload the page and try again."
 	case http.StatusUnprocessableEntity:
 		return "The request was well-formed but not honored. Perhaps the action trying to be performed has already been done?"
+	case http.StatusTooManyRequests:
+		return "Too many failed attempts. Please wait before trying again."
 	default:
 		return "Something went wrong. Please try again later."
 	}
@@ -40,16 +51,29 @@ func message(code int) string {
 }
 
 func code(err error) int {
-	switch err.(type) {
-	case sqlite3.Error:
-		err = err.(sqlite3.Error).ExtendedCode
-	}
-	switch err {
+	switch db.Classify(err) {
 	case sql.ErrNoRows, e.ErrInviteCodeNotFound, e.ErrIDParam:
 		return http.StatusNotFound
-	case sqlite3.ErrConstraintUnique, e.ErrSessionEnded, e.ErrGameSessionEnded,
+	case db.ErrUnique, e.ErrSessionEnded, e.ErrGameSessionEnded,
 		e.ErrSessionActive, e.ErrGameSessionActive, e.ErrGameSessionWager,
-		e.ErrWinnerIsNotParticipant, e.ErrGameSessionNoActive, e.ErrHasActiveSession:
+		e.ErrWinnerIsNotParticipant, e.ErrGameSessionNoActive, e.ErrHasActiveSession,
+		e.ErrUserDeactivated:
+		return http.StatusUnprocessableEntity
+	case e.ErrTOTPRequired:
+		return http.StatusUnauthorized
+	case e.ErrTOTPInvalid, e.ErrTOTPEnabled, e.ErrTOTPNotEnrolled:
+		return http.StatusUnprocessableEntity
+	case e.ErrTooManyAttempts:
+		return http.StatusTooManyRequests
+	case e.ErrIdempotencyKey:
+		return http.StatusBadRequest
+	case e.ErrIdempotencyKeyInFlight, e.ErrVersionConflict:
+		return http.StatusConflict
+	case e.ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case e.ErrPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case e.ErrIdempotencyKeyReused:
 		return http.StatusUnprocessableEntity
 	default:
 		return http.StatusInternalServerError
@@ -57,11 +81,8 @@ func code(err error) int {
 }
 
 func includeErr(err error) bool {
-	switch err.(type) {
-	case sqlite3.Error:
-		err = err.(sqlite3.Error).ExtendedCode
-	}
-	return err != sql.ErrNoRows && err != sqlite3.ErrConstraintUnique
+	err = db.Classify(err)
+	return err != sql.ErrNoRows && err != db.ErrUnique
 }
 
 func BadRequestErr(w http.ResponseWriter, r *http.Request, err error) {
@@ -80,6 +101,11 @@ func UnprocessableErr(w http.ResponseWriter, r *http.Request) {
 	RenderErrEx(w, r, http.StatusUnprocessableEntity, nil)
 }
 
+func TooManyRequestsErr(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	RenderErrEx(w, r, http.StatusTooManyRequests, e.ErrTooManyAttempts)
+}
+
 func RenderErr(w http.ResponseWriter, r *http.Request, err error) {
 	fmt.Printf("ERROR [%s] '%s'\n", r.Context().Value(middleware.RequestIDKey), err)
 	RenderErrEx(w, r, code(err), err)
@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/services"
 )
 
 func IDParam(r *http.Request) (db.ID, error) {
@@ -20,3 +23,32 @@ func IDParam(r *http.Request) (db.ID, error) {
 	}
 	return db.ID(id), nil
 }
+
+// IfMatch is the version in the If-Match header of r, as set by ETag,
+// or services.AnyVersion if it is "*". The header is required, so
+// clients only change resources regardless of their version on purpose.
+func IfMatch(r *http.Request) (int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" {
+		return 0, errvar.ErrPreconditionRequired
+	}
+	if tag == "*" {
+		return services.AnyVersion, nil
+	}
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errvar.ErrPreconditionFailed
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version <= services.AnyVersion {
+		return 0, errvar.ErrPreconditionFailed
+	}
+	return version, nil
+}
+
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
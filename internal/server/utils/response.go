@@ -8,7 +8,9 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lindeneg/wager/internal/services"
 )
@@ -21,6 +23,12 @@ func JSONContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf8")
 }
 
+// ETag tags the response with the version of the resource it holds,
+// requests send it back in If-Match to only change that version.
+func ETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
 type Template struct {
 	htmlTpl *template.Template
 }
@@ -47,6 +55,24 @@ func ParseFS(fs fs.FS, patterns ...string) Template {
 				}
 				return r.String()
 			},
+			"abs": func(n int) int {
+				if n < 0 {
+					return -n
+				}
+				return n
+			},
+			"decimal": func(f float64) string {
+				return fmt.Sprintf("%.1f", f)
+			},
+			"percent": func(f float64) string {
+				return fmt.Sprintf("%.0f%%", f*100)
+			},
+			"date": func(t time.Time) string {
+				return t.Local().Format("2006-01-02 15:04")
+			},
+			"duration": func(seconds int64) string {
+				return (time.Duration(seconds) * time.Second).String()
+			},
 		})
 	tpl, err := tpl.ParseFS(fs, patterns...)
 	if err != nil {
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func TestIfMatch(t *testing.T) {
+	t.Run("matches any version with a wildcard", func(t *testing.T) {
+		for _, tag := range []string{"*", " * "} {
+			version, err := IfMatch(ifMatchRequest(tag))
+			assertNoError(t, err)
+			assertInt(t, version, services.AnyVersion)
+		}
+	})
+
+	t.Run("requires a tag", func(t *testing.T) {
+		_, err := IfMatch(ifMatchRequest(""))
+		if !errors.Is(err, errvar.ErrPreconditionRequired) {
+			t.Errorf("got error %v want %v", err, errvar.ErrPreconditionRequired)
+		}
+	})
+
+	t.Run("reads the version of an ETag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ETag(w, 7)
+		version, err := IfMatch(ifMatchRequest(w.Header().Get("ETag")))
+		assertNoError(t, err)
+		assertInt(t, version, 7)
+	})
+
+	t.Run("refuses malformed tags", func(t *testing.T) {
+		for _, tag := range []string{`7`, `"7`, `"seven"`, `"0"`, `"-1"`, `W/"7"`, `"`} {
+			_, err := IfMatch(ifMatchRequest(tag))
+			if !errors.Is(err, errvar.ErrPreconditionFailed) {
+				t.Errorf("%s: got error %v want %v", tag, err, errvar.ErrPreconditionFailed)
+			}
+		}
+	})
+}
+
+func TestRenderErr(t *testing.T) {
+	t.Run("responds to version errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			err    error
+			status int
+		}{
+			{errvar.ErrPreconditionFailed, http.StatusPreconditionFailed},
+			{errvar.ErrPreconditionRequired, http.StatusPreconditionRequired},
+			{errvar.ErrVersionConflict, http.StatusConflict},
+		} {
+			w := httptest.NewRecorder()
+			RenderErrSlim(w, httptest.NewRequest(http.MethodPost, "/api/game-session/1/end", nil), tc.err)
+			assertInt(t, w.Code, tc.status)
+			var res ErrorResponse
+			assertNoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assertInt(t, res.Status, tc.status)
+			if res.Error != tc.err.Error() {
+				t.Errorf("got error %q want %q", res.Error, tc.err.Error())
+			}
+		}
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	t.Run("allows 3-12 characters", func(t *testing.T) {
+		for name, valid := range map[string]bool{
+			"ab": false, "abc": true, "abcdefghijkl": true, "abcdefghijklm": false,
+		} {
+			if err := ValidateUsername(name); (err == nil) != valid {
+				t.Errorf("%s: got error %v", name, err)
+			}
+		}
+	})
+}
+
+func ifMatchRequest(tag string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/session/1/end", nil)
+	if tag != "" {
+		r.Header.Set("If-Match", tag)
+	}
+	return r
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertInt(t testing.TB, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
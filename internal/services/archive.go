@@ -0,0 +1,391 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/archive"
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/importer"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+type ArchiveService interface {
+	// Export reads the whole history, with password hashes if passwords is set.
+	Export(passwords bool) (archive.Archive, error)
+	// Import restores a validated archive into an empty database
+	// and recomputes the ratings of its rounds.
+	Import(a archive.Archive) error
+	// ImportHistory creates the ended sessions of rows tracked before this app,
+	// adds their results to the current result and recomputes the ratings.
+	// Rows of rounds already played are skipped and reported as duplicates.
+	// Nothing is created if dryRun is set, the report is the same.
+	ImportHistory(rows []importer.Row, dryRun bool) (importer.Report, error)
+}
+
+type arService struct {
+	store *db.Datastore
+	u     UserService
+	g     GameService
+	r     ResultService
+	rt    RatingService
+	h     HistoryService
+}
+
+func (s *arService) Export(passwords bool) (archive.Archive, error) {
+	a := archive.Archive{Version: archive.Version, Exported: NewTime(), Ledger: result.ResultMap{}}
+	err := s.rows(`SELECT id, name, password, deactivated FROM "user" ORDER BY id`, func(rows *sql.Rows) error {
+		var u archive.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Password, &u.Deactivated); err != nil {
+			return err
+		}
+		if !passwords {
+			u.Password = ""
+		}
+		a.Users = append(a.Users, u)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows("SELECT id, name FROM game ORDER BY id", func(rows *sql.Rows) error {
+		var g archive.Game
+		if err := rows.Scan(&g.ID, &g.Name); err != nil {
+			return err
+		}
+		a.Games = append(a.Games, g)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows("SELECT id, result, started, ended, version FROM session ORDER BY id", func(rows *sql.Rows) error {
+		var ss archive.Session
+		var sResult string
+		if err := rows.Scan(&ss.ID, &sResult, &ss.Started, &ss.Ended, &ss.Version); err != nil {
+			return err
+		}
+		ss.Result = result.FromString(sResult)
+		a.Sessions = append(a.Sessions, ss)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows("SELECT id, user_id, session_id FROM session_participant ORDER BY id", func(rows *sql.Rows) error {
+		var p archive.Participant
+		if err := rows.Scan(&p.ID, &p.UserID, &p.SessionID); err != nil {
+			return err
+		}
+		a.Participants = append(a.Participants, p)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows(`SELECT id, session_id, game_id, result, started, ended, version
+FROM game_session ORDER BY id`, func(rows *sql.Rows) error {
+		var gs archive.GameSession
+		var sResult string
+		err := rows.Scan(&gs.ID, &gs.SessionID, &gs.GameID, &sResult, &gs.Started, &gs.Ended, &gs.Version)
+		if err != nil {
+			return err
+		}
+		gs.Result = result.FromString(sResult)
+		a.GameSessions = append(a.GameSessions, gs)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows(`SELECT id, game_session_id, round, wager, active, result, version
+FROM game_session_round ORDER BY id`, func(rows *sql.Rows) error {
+		var r archive.Round
+		var sResult string
+		err := rows.Scan(&r.ID, &r.GameSessionID, &r.Round, &r.Wager, &r.Active, &sResult, &r.Version)
+		if err != nil {
+			return err
+		}
+		r.Result = result.FromString(sResult)
+		a.Rounds = append(a.Rounds, r)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	err = s.rows("SELECT id, user_id, description, occured FROM event ORDER BY id", func(rows *sql.Rows) error {
+		var e archive.Event
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Description, &e.Occured); err != nil {
+			return err
+		}
+		a.Events = append(a.Events, e)
+		return nil
+	})
+	if err != nil {
+		return a, err
+	}
+	var ledger string
+	err = s.store.QueryRow("SELECT data FROM result WHERE id = 1").Scan(&ledger)
+	if err == nil {
+		a.Ledger = result.FromString(ledger)
+	} else if err != sql.ErrNoRows {
+		return a, err
+	}
+	return a, nil
+}
+
+func (s *arService) rows(q string, scan func(rows *sql.Rows) error) error {
+	rows, err := s.store.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *arService) Import(a archive.Archive) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	tx, err := s.store.Begin()
+	if err != nil {
+		return err
+	}
+	if err = s.insert(tx, a); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return s.rt.Recompute()
+}
+
+func (s *arService) insert(tx *db.Tx, a archive.Archive) error {
+	var rows int
+	err := tx.QueryRow(`SELECT (SELECT COUNT(*) FROM "user")
+    + (SELECT COUNT(*) FROM game)
+    + (SELECT COUNT(*) FROM session)`).Scan(&rows)
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return errvar.ErrDatabaseNotEmpty
+	}
+	for _, u := range a.Users {
+		_, err = tx.Exec(`INSERT INTO "user" (id, name, password, deactivated) VALUES (?, ?, ?, ?)`,
+			u.ID, u.Name, u.Password, formatEnded(u.Deactivated))
+		if err != nil {
+			return err
+		}
+	}
+	for _, g := range a.Games {
+		if _, err = tx.Exec("INSERT INTO game (id, name) VALUES (?, ?)", g.ID, g.Name); err != nil {
+			return err
+		}
+	}
+	for _, ss := range a.Sessions {
+		_, err = tx.Exec(
+			"INSERT INTO session (id, result, started, ended, version) VALUES (?, ?, ?, ?, ?)",
+			ss.ID, ss.Result.String(), FormatTime(ss.Started), formatEnded(ss.Ended), ss.Version)
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range a.Participants {
+		_, err = tx.Exec(
+			"INSERT INTO session_participant (id, user_id, session_id) VALUES (?, ?, ?)",
+			p.ID, p.UserID, p.SessionID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, gs := range a.GameSessions {
+		_, err = tx.Exec(`INSERT
+INTO game_session (id, session_id, game_id, result, started, ended, version)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			gs.ID, gs.SessionID, gs.GameID, gs.Result.String(),
+			FormatTime(gs.Started), formatEnded(gs.Ended), gs.Version)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range a.Rounds {
+		_, err = tx.Exec(`INSERT
+INTO game_session_round (id, game_session_id, round, wager, active, result, version)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.GameSessionID, r.Round, r.Wager, r.Active, r.Result.String(), r.Version)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range a.Events {
+		_, err = tx.Exec(
+			"INSERT INTO event (id, user_id, description, occured) VALUES (?, ?, ?, ?)",
+			e.ID, e.UserID, e.Description, FormatTime(e.Occured))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Resequence(`"user"`, "game", "session", "session_participant",
+		"game_session", "game_session_round", "event")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM result")
+	if err != nil {
+		return err
+	}
+	ledger := a.Ledger
+	if ledger == nil {
+		ledger = result.ResultMap{}
+	}
+	_, err = tx.Exec("INSERT INTO result (id, data) VALUES (1, ?)", ledger.String())
+	return err
+}
+
+func (s *arService) ImportHistory(rows []importer.Row, dryRun bool) (importer.Report, error) {
+	usrs, err := s.u.All(nil)
+	if err != nil {
+		return importer.Report{}, err
+	}
+	games, err := s.g.All(nil)
+	if err != nil {
+		return importer.Report{}, err
+	}
+	imported, err := s.imported()
+	if err != nil {
+		return importer.Report{}, err
+	}
+	p, err := importer.NewPlan(rows, usrs, games, imported)
+	if err != nil {
+		return importer.Report{}, err
+	}
+	report := p.Report()
+	report.DryRun = dryRun
+	if dryRun || len(p.Sessions) == 0 {
+		return report, nil
+	}
+	// Creates the ledger if there is none, so it can be updated below.
+	if _, err = s.r.Current(); err != nil {
+		return report, err
+	}
+	tx, err := s.store.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+	if err = s.insertHistory(tx, p); err != nil {
+		return report, err
+	}
+	if err = addToLedger(tx, usrs, p); err != nil {
+		return report, err
+	}
+	if err = tx.Commit(); err != nil {
+		return report, err
+	}
+	return report, s.rt.Recompute()
+}
+
+// imported are the ended rounds, to find the rows of an import played already.
+func (s *arService) imported() (importer.Imported, error) {
+	rounds, err := s.h.Rounds(HistoryFilter{})
+	if err != nil {
+		return nil, err
+	}
+	imported := importer.Imported{}
+	for _, r := range rounds {
+		participants := make([]db.ID, 0, len(r.Result))
+		for id := range r.Result {
+			participants = append(participants, id)
+		}
+		imported.Add(r.Started, r.GameID, participants, r.Wager)
+	}
+	return imported, nil
+}
+
+func addToLedger(tx *db.Tx, usrs []User, p importer.Plan) error {
+	var data string
+	if err := tx.QueryRow("SELECT data FROM result WHERE id = 1").Scan(&data); err != nil {
+		return err
+	}
+	results := []result.ResultMap{result.FromString(data)}
+	for _, ss := range p.Sessions {
+		results = append(results, ss.Result)
+	}
+	rm := result.Merge(usrs, results...)
+	rm.Resolve()
+	return affected(tx.Exec("UPDATE result SET data = ? WHERE id = 1", rm.String()))
+}
+
+func (s *arService) insertHistory(tx *db.Tx, p importer.Plan) error {
+	gameIDs := map[string]db.ID{}
+	for _, name := range p.NewGames {
+		var id db.ID
+		err := tx.QueryRow("INSERT INTO game (name) VALUES (?) RETURNING id", name).Scan(&id)
+		if err != nil {
+			return err
+		}
+		gameIDs[strings.ToLower(name)] = id
+	}
+	for _, ss := range p.Sessions {
+		var sessionID db.ID
+		err := tx.QueryRow("INSERT INTO session (result, started, ended) VALUES (?, ?, ?) RETURNING id",
+			ss.Result.String(), FormatTime(ss.Started), FormatTime(ss.Ended)).Scan(&sessionID)
+		if err != nil {
+			return err
+		}
+		for _, userID := range ss.Users {
+			_, err = tx.Exec(
+				"INSERT INTO session_participant (session_id, user_id) VALUES (?, ?)", sessionID, userID)
+			if err != nil {
+				return err
+			}
+		}
+		for _, gs := range ss.Games {
+			gameID := gs.GameID
+			if gameID == 0 {
+				gameID = gameIDs[strings.ToLower(gs.Game)]
+			}
+			var gsID db.ID
+			err = tx.QueryRow(`INSERT
+INTO game_session (session_id, game_id, result, started, ended)
+    VALUES (?, ?, ?, ?, ?)
+RETURNING id`,
+				sessionID, gameID, gs.Result.String(), FormatTime(gs.Started), FormatTime(gs.Ended)).Scan(&gsID)
+			if err != nil {
+				return err
+			}
+			for i, r := range gs.Rounds {
+				_, err = tx.Exec(`INSERT
+INTO game_session_round (game_session_id, round, wager, active, result)
+    VALUES (?, ?, ?, 0, ?)`,
+					gsID, i+1, r.Wager, r.Result.String())
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func formatEnded(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	return GetPtr(FormatTime(*t))
+}
+
+func NewArchiveService(
+	store *db.Datastore, u UserService, g GameService, r ResultService, rt RatingService, h HistoryService,
+) ArchiveService {
+	return &arService{store, u, g, r, rt, h}
+}
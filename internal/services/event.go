@@ -0,0 +1,72 @@
+package services
+
+import (
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+)
+
+type Event struct {
+	ID db.ID `json:"id"`
+	// UserID is nil for events of users that do not exist,
+	// such as failed logins with an unknown username.
+	UserID      *db.ID    `json:"userId"`
+	Description string    `json:"description"`
+	Occured     time.Time `json:"occured"`
+}
+
+type EventService interface {
+	Create(userID *db.ID, description string) (Event, error)
+	All(p *pagination.P) ([]Event, error)
+	Count() (int, error)
+}
+
+type eService struct {
+	store *db.Datastore
+}
+
+func (e *eService) Create(userID *db.ID, description string) (Event, error) {
+	ev := Event{UserID: userID, Description: description, Occured: NewTime()}
+	err := e.store.QueryRow(
+		"INSERT INTO event (user_id, description, occured) VALUES (?, ?, ?) RETURNING id",
+		ev.UserID, ev.Description, FormatTime(ev.Occured),
+	).Scan(&ev.ID)
+	return ev, err
+}
+
+func (e *eService) All(p *pagination.P) ([]Event, error) {
+	evs := make([]Event, 0)
+	rows, err := e.store.Query(pagination.MakeQuery(
+		"SELECT id, user_id, description, occured FROM event ORDER BY occured DESC", p))
+	if err != nil {
+		return evs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ev Event
+		err = rows.Scan(&ev.ID, &ev.UserID, &ev.Description, &ev.Occured)
+		if err != nil {
+			return evs, err
+		}
+		evs = append(evs, ev)
+	}
+	err = rows.Err()
+	if err != nil {
+		return evs, err
+	}
+	return evs, nil
+}
+
+func (e *eService) Count() (int, error) {
+	var count int
+	err := e.store.QueryRow("SELECT COUNT(*) FROM event").Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func NewEventService(store *db.Datastore) EventService {
+	return &eService{store}
+}
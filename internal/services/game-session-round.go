@@ -5,16 +5,16 @@ import (
 	"errors"
 
 	"github.com/lindeneg/wager/internal/db"
-	"github.com/lindeneg/wager/internal/errvar"
 	"github.com/lindeneg/wager/internal/result"
 )
 
 type GameSessionRoundShared[T string | result.ResultMap] struct {
-	ID     db.ID `json:"id"`
-	Round  int   `json:"round"`
-	Wager  int   `json:"wager"`
-	Active int   `json:"active"`
-	Result T     `json:"result"`
+	ID      db.ID `json:"id"`
+	Round   int   `json:"round"`
+	Wager   int   `json:"wager"`
+	Active  int   `json:"active"`
+	Result  T     `json:"result"`
+	Version int   `json:"version"`
 }
 
 type GameSessionRound struct {
@@ -52,11 +52,11 @@ func (gs *GameSessionRounds) UnmarshalJSON(s []byte) error {
 
 func (gs *GameSessionRounds) Scan(src any) error {
 	var grs []GameSessionRoundDB
-	s, ok := src.(string)
-	if !ok {
-		return errvar.ErrScanError
+	b, err := jsonOf(src)
+	if err != nil {
+		return err
 	}
-	err := json.Unmarshal([]byte(s), &grs)
+	err = json.Unmarshal(b, &grs)
 	if err != nil {
 		return err
 	}
@@ -67,11 +67,12 @@ func (gs *GameSessionRounds) Scan(src any) error {
 	for _, gr := range grs {
 		*gs = append(*gs, GameSessionRound{
 			GameSessionRoundShared: GameSessionRoundShared[result.ResultMap]{
-				ID:     gr.ID,
-				Round:  gr.Round,
-				Wager:  gr.Wager,
-				Result: result.FromString(gr.Result),
-				Active: gr.Active,
+				ID:      gr.ID,
+				Round:   gr.Round,
+				Wager:   gr.Wager,
+				Result:  result.FromString(gr.Result),
+				Active:  gr.Active,
+				Version: gr.Version,
 			},
 			GameSessionID: gr.GameSessionID,
 		})
@@ -89,62 +90,25 @@ type GameSessionRoundService interface {
 	FromSession(gameSessionID db.ID) ([]GameSessionRound, error)
 
 	Create(gameSessionID db.ID, wager int, p []Participant, r int) (GameSessionRound, error)
-	EndActive(gameSessionID db.ID, winnerID db.ID) (GameSessionRound, error)
+	// DropActive deletes the active round without a winner.
+	DropActive(gameSessionID db.ID) error
 }
 
 type gsrService struct {
-	store *db.Datastore
+	repo RoundRepository
 }
 
 func (g *gsrService) Active(gameSessionId db.ID) (GameSessionRound, error) {
-	var gs GameSessionRound
-	var sResult string
-	err := g.store.DB.QueryRow(
-		"SELECT * FROM game_session_round WHERE game_session_id = ? AND active = 1",
-		gameSessionId).Scan(
-		&gs.ID, &gs.GameSessionID, &sResult, &gs.Round, &gs.Wager, &gs.Active)
-	if err != nil {
-		return gs, err
-	}
-	gs.Result = result.FromString(sResult)
-	return gs, nil
+	return g.repo.Active(gameSessionId)
 }
 
 func (g *gsrService) HasActive(gameSessionId db.ID) bool {
-	var id db.ID
-	err := g.store.DB.QueryRow(
-		"SELECT id FROM game_session_round WHERE game_session_id = ? AND active = 1",
-		gameSessionId).Scan(&id)
-	if err != nil {
-		return false
-	}
-	return id > 0
+	_, err := g.repo.Active(gameSessionId)
+	return err == nil
 }
 
 func (g *gsrService) FromSession(id db.ID) ([]GameSessionRound, error) {
-	rounds := make([]GameSessionRound, 0)
-	rows, err := g.store.DB.Query(
-		"SELECT * from game_session_round WHERE game_session_id = ? ORDER BY round DESC",
-		id)
-	if err != nil {
-		return rounds, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var s GameSessionRound
-		var sResult string
-		err = rows.Scan(&s.ID, &s.Round, &sResult, s.Wager)
-		if err != nil {
-			return rounds, err
-		}
-		s.Result = result.FromString(sResult)
-		rounds = append(rounds, s)
-	}
-	err = rows.Err()
-	if err != nil {
-		return rounds, err
-	}
-	return rounds, nil
+	return g.repo.FromGameSession(id)
 }
 
 func (g *gsrService) Create(gid db.ID, w int, p []Participant, r int) (GameSessionRound, error) {
@@ -152,48 +116,33 @@ func (g *gsrService) Create(gid db.ID, w int, p []Participant, r int) (GameSessi
 	if err == nil {
 		return GameSessionRound{}, errors.New("already have active round")
 	}
-	gr := GameSessionRound{
+	gr := newRound(gid, w, p, r)
+	err = g.repo.Insert(&gr)
+	return gr, err
+}
+
+// newRound is the active round r of the game session gid.
+func newRound(gid db.ID, w int, p []Participant, r int) GameSessionRound {
+	return GameSessionRound{
 		GameSessionRoundShared: GameSessionRoundShared[result.ResultMap]{
-			Round:  r,
-			Wager:  w,
-			Result: result.New(p),
-			Active: 1,
+			Round:   r,
+			Wager:   w,
+			Result:  result.New(p),
+			Active:  1,
+			Version: 1,
 		},
 		GameSessionID: gid,
 	}
-	e, err := g.store.DB.Exec(`INSERT 
-INTO game_session_round (game_session_id, result, wager, round, active)
-    VALUES (?, ?, ?, ?, ?)`,
-		gr.GameSessionID,
-		gr.Result.String(),
-		gr.Wager, gr.Round, gr.Active)
-	if err != nil {
-		return gr, err
-	}
-	id, err := e.LastInsertId()
-	if err != nil {
-		return gr, err
-	}
-	gr.ID = db.ID(id)
-	return gr, nil
 }
 
-func (g *gsrService) EndActive(gid db.ID, w db.ID) (GameSessionRound, error) {
-	gs, err := g.Active(gid)
+func (g *gsrService) DropActive(gid db.ID) error {
+	gr, err := g.Active(gid)
 	if err != nil {
-		return gs, err
-	}
-	gs.Result.AddWinner(w, gs.Wager)
-	gs.Active = 0
-	_, err = g.store.DB.Exec(
-		"UPDATE game_session_round SET result = ?, active = ? WHERE id = ?",
-		gs.Result.String(), gs.Active, gs.ID)
-	if err != nil {
-		return gs, err
+		return err
 	}
-	return gs, nil
+	return g.repo.Delete(gr)
 }
 
-func NewGameSessionRoundService(store *db.Datastore) GameSessionRoundService {
-	return &gsrService{store}
+func NewGameSessionRoundService(repo RoundRepository) GameSessionRoundService {
+	return &gsrService{repo}
 }
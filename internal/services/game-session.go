@@ -3,20 +3,62 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/hub"
 	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
 	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/webhook"
 )
 
+// GameSessionQuery lists ended game sessions unless another state is requested,
+// the active game session is listed separately.
+var GameSessionQuery = query.Schema{
+	Sorts: []query.Field{
+		{Name: "ended", Expr: "s.ended"},
+		{Name: "started", Expr: "s.started"},
+		{Name: "duration", Expr: db.SQLite.Seconds("s.started", "s.ended"), Dialects: map[db.Dialect]string{
+			db.Postgres: db.Postgres.Seconds("s.started", "s.ended"),
+		}},
+		{Name: "money", Expr: `(
+    SELECT COALESCE(SUM(r.wager), 0)
+    FROM game_session_round r
+    WHERE r.game_session_id = s.id AND r.active = 0
+)`},
+		{Name: "rounds", Expr: "(SELECT COUNT(*) FROM game_session_round r WHERE r.game_session_id = s.id)"},
+	},
+	DefaultOrder: query.Desc,
+	Filters: map[string]query.Filter{
+		"game":    query.ID("s.game_id = ?"),
+		"session": query.ID("s.session_id = ?"),
+		"from":    query.Time("s.started >= ?", false),
+		"to":      query.Time("s.started <= ?", true),
+		"state":   sessionState,
+	},
+	Defaults: map[string]string{"state": "ended"},
+	Key:      "s.id",
+}
+
+// GameSessionValues are the values of the sorts of GameSessionQuery.
+var GameSessionValues = query.Values[GameSession]{
+	"ended":    func(gs GameSession) any { return timeValue(gs.Ended) },
+	"started":  func(gs GameSession) any { return timeValue(&gs.Started) },
+	"duration": func(gs GameSession) any { return seconds(gs.Started, gs.Ended) },
+	"money":    func(gs GameSession) any { return wagered(gs.Rounds) },
+	"rounds":   func(gs GameSession) any { return len(gs.Rounds) },
+}
+
 type GameSessionShared[T string | result.ResultMap] struct {
 	ID      db.ID             `json:"id"`
 	Rounds  GameSessionRounds `json:"rounds"`
 	Result  T                 `json:"result"`
 	Started time.Time         `json:"started"`
 	Ended   *time.Time        `json:"ended"`
+	Version int               `json:"version"`
 }
 
 type GameSession struct {
@@ -35,11 +77,11 @@ type GameSessions []GameSession
 
 func (gs *GameSessions) Scan(src any) error {
 	var grs []GameSessionDB
-	s, ok := src.(string)
-	if !ok {
-		return errvar.ErrScanError
+	b, err := jsonOf(src)
+	if err != nil {
+		return err
 	}
-	err := json.Unmarshal([]byte(s), &grs)
+	err = json.Unmarshal(b, &grs)
 	if err != nil {
 		return err
 	}
@@ -55,6 +97,7 @@ func (gs *GameSessions) Scan(src any) error {
 				Result:  result.FromString(gr.Result),
 				Started: gr.Started,
 				Ended:   gr.Ended,
+				Version: gr.Version,
 			},
 			SessionID: gr.SessionID,
 			GameID:    gr.GameID,
@@ -67,120 +110,93 @@ func (g GameSession) ResultMap() result.ResultMap {
 	return g.Result
 }
 
+const (
+	GameSessionCreated   = "create"
+	GameSessionNewRound  = "new-round"
+	GameSessionEndRound  = "end-round"
+	GameSessionDropRound = "drop-round"
+	GameSessionEnded     = "end"
+	GameSessionCancelled = "cancel"
+)
+
+// GameSessionEvent is published to the session of a game session
+// whenever the game session changes, Kind is the change made.
+type GameSessionEvent struct {
+	Kind        string      `json:"kind"`
+	GameSession GameSession `json:"gameSession"`
+}
+
+// GameSessionHub publishes game session events by session id.
+type GameSessionHub = hub.Hub[db.ID, GameSessionEvent]
+
 type GameSessionService interface {
 	HasActive(sessionID db.ID) bool
-	FromSession(sessionID db.ID, p *pagination.P) ([]GameSession, error)
+	All(spec query.Spec) ([]GameSession, error)
+	FromSession(sessionID db.ID, spec query.Spec) ([]GameSession, error)
+	FromGame(gameID db.ID, p *pagination.P) ([]GameSession, error)
 	ActiveFromSession(sessionID db.ID) (GameSession, error)
-	CountFromSession(sessionID db.ID) (int, error)
+	CountFromSession(sessionID db.ID, spec query.Spec) (int, error)
 	ByPK(id db.ID) (GameSession, error)
 	Create(sessionID db.ID, gameID db.ID, wager int) (GameSession, error)
 
-	NewRound(id db.ID, wager int) (GameSession, error)
-	EndRound(id db.ID, winnerID db.ID) (GameSession, error)
+	// The changes below fail unless version is AnyVersion or the current version.
+
+	NewRound(id db.ID, wager int, version int) (GameSession, error)
+	EndRound(id db.ID, winnerID db.ID, version int) (GameSession, error)
+	// DropRound deletes the active round, so a stuck game session can end.
+	DropRound(id db.ID, version int) (GameSession, error)
 
-	End(id db.ID) (GameSession, error)
-	Cancel(id db.ID) error
+	End(id db.ID, version int) (GameSession, error)
+	Cancel(id db.ID, version int) error
 }
 
 type gsService struct {
-	store *db.Datastore
-	s     SessionService
-	r     GameSessionRoundService
-	pt    ParticipantService
+	repo GameSessionRepository
+	s    SessionService
+	r    GameSessionRoundService
+	pt   ParticipantService
+	rt   RatingService
+	h    *GameSessionHub
+	d    *webhook.Dispatcher
+}
+
+func (g *gsService) publish(kind string, gs GameSession) {
+	g.h.Publish(gs.SessionID, GameSessionEvent{Kind: kind, GameSession: gs})
 }
 
 func (g *gsService) HasActive(sessionID db.ID) bool {
-	var id db.ID
-	err := g.store.DB.QueryRow(
-		"SELECT id FROM game_session WHERE session_id = ? AND ended IS NULL",
-		sessionID).Scan(&id)
-	if err != nil {
-		return false
-	}
-	return id > 0
+	_, err := g.repo.Active(sessionID)
+	return err == nil
 }
 
-func (g *gsService) FromSession(id db.ID, p *pagination.P) ([]GameSession, error) {
-	var active GameSession
-	var activeErr error
-	if p != nil {
-		active, activeErr = g.ActiveFromSession(id)
-		if activeErr == nil {
-			p.Limit -= 1
-		}
-	}
-	sessions := make([]GameSession, 0)
-	rows, err := g.store.DB.Query(
-		pagination.MakeQuery(withRounds("WHERE session_id = ? ORDER BY ended DESC"), p), id)
-	if err != nil {
-		return sessions, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var s GameSession
-		var sResult string
-		err = rows.Scan(
-			&s.ID, &s.SessionID, &s.GameID,
-			&sResult, &s.Started, &s.Ended, &s.Rounds)
-		if err != nil {
-			return sessions, err
-		}
-		s.Result = result.FromString(sResult)
-		sessions = append(sessions, s)
-	}
-	err = rows.Err()
-	if err != nil {
-		return sessions, err
-	}
-	if p != nil && activeErr == nil {
-		p.Limit += 1
-		s := sessions
-		if len(sessions) > 0 && sessions[len(sessions)-1].Ended == nil {
-			s = sessions[:len(sessions)-1]
-		}
-		sessions = append([]GameSession{active}, s...)
+func (g *gsService) All(spec query.Spec) ([]GameSession, error) {
+	return g.repo.Find(spec)
+}
+
+func (g *gsService) FromSession(id db.ID, spec query.Spec) ([]GameSession, error) {
+	if err := GameSessionQuery.Filter(&spec, "session", strconv.FormatUint(uint64(id), 10)); err != nil {
+		return nil, err
 	}
-	return sessions, nil
+	return g.repo.Find(spec)
 }
 
-func (g *gsService) CountFromSession(sessionID db.ID) (int, error) {
-	var r int
-	err := g.store.DB.QueryRow(
-		"SELECT COUNT(*) FROM game_session WHERE session_id = ?",
-		sessionID,
-	).Scan(&r)
-	if err != nil {
+func (g *gsService) FromGame(gameID db.ID, p *pagination.P) ([]GameSession, error) {
+	return g.repo.FromGame(gameID, p)
+}
+
+func (g *gsService) CountFromSession(sessionID db.ID, spec query.Spec) (int, error) {
+	if err := GameSessionQuery.Filter(&spec, "session", strconv.FormatUint(uint64(sessionID), 10)); err != nil {
 		return 0, err
 	}
-	return r, nil
+	return g.repo.Count(spec)
 }
 
 func (g *gsService) ActiveFromSession(sessionID db.ID) (GameSession, error) {
-	var gs GameSession
-	var sResult string
-	err := g.store.DB.QueryRow(withRounds("WHERE session_id = ? AND ended IS NULL"),
-		sessionID,
-	).Scan(
-		&gs.ID, &gs.SessionID, &gs.GameID, &sResult,
-		&gs.Started, &gs.Ended, &gs.Rounds)
-	if err != nil {
-		return gs, err
-	}
-	gs.Result = result.FromString(sResult)
-	return gs, nil
+	return g.repo.Active(sessionID)
 }
 
 func (g *gsService) ByPK(id db.ID) (GameSession, error) {
-	var gs GameSession
-	var sResult string
-	err := g.store.DB.QueryRow(withRounds("WHERE id = ?"), id).Scan(
-		&gs.ID, &gs.SessionID, &gs.GameID, &sResult,
-		&gs.Started, &gs.Ended, &gs.Rounds)
-	if err != nil {
-		return gs, err
-	}
-	gs.Result = result.FromString(sResult)
-	return gs, nil
+	return g.repo.ByPK(id)
 }
 
 func (g *gsService) Create(sessionID db.ID, gameID db.ID, wager int) (GameSession, error) {
@@ -194,38 +210,31 @@ func (g *gsService) Create(sessionID db.ID, gameID db.ID, wager int) (GameSessio
 			Result:  result.New(pt),
 			Started: NewTime(),
 			Ended:   nil,
+			Version: 1,
 		},
 		SessionID: sessionID,
 		GameID:    gameID,
 	}
-	e, err := g.store.DB.Exec(`INSERT
-INTO game_session (session_id, game_id, started, result)
-    VALUES (?, ?, ?, ?)`,
-		gs.SessionID,
-		gs.GameID,
-		FormatTime(gs.Started),
-		gs.Result.String())
-	if err != nil {
+	if err = g.repo.Insert(&gs); err != nil {
 		return gs, err
 	}
-	id, err := e.LastInsertId()
-	if err != nil {
-		return gs, err
-	}
-	gs.ID = db.ID(id)
 	gr, err := g.r.Create(gs.ID, wager, pt, 1)
 	if err != nil {
 		return gs, err
 	}
 	gs.Rounds = append(gs.Rounds, gr)
+	g.publish(GameSessionCreated, gs)
 	return gs, nil
 }
 
-func (g *gsService) NewRound(id db.ID, wager int) (GameSession, error) {
+func (g *gsService) NewRound(id db.ID, wager int, version int) (GameSession, error) {
 	gs, err := g.ByPK(id)
 	if err != nil {
 		return gs, err
 	}
+	if err = matchVersion(version, gs.Version); err != nil {
+		return gs, err
+	}
 	if gs.Ended != nil {
 		return gs, errvar.ErrGameSessionEnded
 	}
@@ -233,50 +242,89 @@ func (g *gsService) NewRound(id db.ID, wager int) (GameSession, error) {
 	if err != nil {
 		return gs, err
 	}
-	gr, err := g.r.Create(id, wager, pt, len(gs.Rounds)+1)
-	if err != nil {
+	if _, idx := gs.Rounds.Active(); idx != -1 {
+		return gs, errvar.ErrGameSessionActive
+	}
+	gr := newRound(id, wager, pt, len(gs.Rounds)+1)
+	if err = g.repo.NewRound(&gs, &gr); err != nil {
 		return gs, err
 	}
 	gs.Rounds = append([]GameSessionRound{gr}, gs.Rounds...)
+	g.publish(GameSessionNewRound, gs)
 	return gs, nil
 }
 
-func (g *gsService) EndRound(id db.ID, winnerID db.ID) (GameSession, error) {
+func (g *gsService) EndRound(id db.ID, winnerID db.ID, version int) (GameSession, error) {
 	gs, err := g.ByPK(id)
 	if err != nil {
 		return gs, err
 	}
+	if err = matchVersion(version, gs.Version); err != nil {
+		return gs, err
+	}
 	if gs.Ended != nil {
 		return gs, errvar.ErrGameSessionEnded
 	}
 	if !gs.Result.Exists(winnerID) {
 		return gs, errvar.ErrWinnerIsNotParticipant
 	}
-	_, idx := gs.Rounds.Active()
+	active, idx := gs.Rounds.Active()
 	if idx == -1 {
 		return gs, errvar.ErrGameSessionNoActive
 	}
-	gr, err := g.r.EndActive(id, winnerID)
-	if err != nil {
+	gs.Result.AddWinner(winnerID, active.Wager)
+	gs.Result.Resolve()
+	gr := active
+	gr.Result.AddWinner(winnerID, gr.Wager)
+	gr.Active = 0
+	if err = g.repo.EndRound(&gs, &gr); err != nil {
 		return gs, err
 	}
-	gs.Result.AddWinner(winnerID, gr.Wager)
-	gs.Result.Resolve()
 	gs.Rounds[idx] = gr
-	_, err = g.store.DB.Exec(
-		"UPDATE game_session SET result = ? WHERE id = ?",
-		gs.Result.String(), id)
+	// The round has ended either way and ratings can be recomputed,
+	// so a failure to rate it is not the caller's.
+	if err = g.rt.Record(gs.GameID, gr.ID, gr.Result); err != nil {
+		fmt.Printf("ERROR [rating] '%s'\n", err)
+	}
+	g.publish(GameSessionEndRound, gs)
+	g.d.Dispatch(webhook.RoundEnded, RoundEndedData{GameSession: gs, Round: gr, WinnerID: winnerID})
+	return gs, nil
+}
+
+func (g *gsService) DropRound(id db.ID, version int) (GameSession, error) {
+	gs, err := g.ByPK(id)
 	if err != nil {
 		return gs, err
 	}
+	if err = matchVersion(version, gs.Version); err != nil {
+		return gs, err
+	}
+	if gs.Ended != nil {
+		return gs, errvar.ErrGameSessionEnded
+	}
+	_, idx := gs.Rounds.Active()
+	if idx == -1 {
+		return gs, errvar.ErrGameSessionNoActive
+	}
+	if err = g.repo.Update(&gs); err != nil {
+		return gs, err
+	}
+	if err = g.r.DropActive(id); err != nil {
+		return gs, err
+	}
+	gs.Rounds = append(gs.Rounds[:idx], gs.Rounds[idx+1:]...)
+	g.publish(GameSessionDropRound, gs)
 	return gs, nil
 }
 
-func (g *gsService) End(id db.ID) (GameSession, error) {
+func (g *gsService) End(id db.ID, version int) (GameSession, error) {
 	gs, err := g.ByPK(id)
 	if err != nil {
 		return gs, err
 	}
+	if err = matchVersion(version, gs.Version); err != nil {
+		return gs, err
+	}
 	if gs.Ended != nil {
 		return gs, errvar.ErrGameSessionEnded
 	}
@@ -288,82 +336,94 @@ func (g *gsService) End(id db.ID) (GameSession, error) {
 		return gs, err
 	}
 	gs.Ended = GetPtr(NewTime())
-	_, err = g.store.DB.Exec(
-		"UPDATE game_session SET ended = ? WHERE id = ?",
-		FormatTime(*gs.Ended), id)
-	if err != nil {
+	if err = g.repo.Update(&gs); err != nil {
 		return gs, err
 	}
 	err = g.s.UpdateResult(gs.SessionID, pt, gs.Result)
+	if err != nil {
+		return gs, err
+	}
+	g.publish(GameSessionEnded, gs)
+	g.d.Dispatch(webhook.PaymentRecorded, PaymentData{
+		SessionID: gs.SessionID, GameSessionID: gs.ID, GameID: gs.GameID, Result: gs.Result,
+	})
 	return gs, nil
 }
 
-func (g *gsService) Cancel(id db.ID) error {
+func (g *gsService) Cancel(id db.ID, version int) error {
 	gs, err := g.ByPK(id)
 	if err != nil {
 		return err
 	}
+	if err = matchVersion(version, gs.Version); err != nil {
+		return err
+	}
 	if gs.Ended != nil {
 		return errvar.ErrGameSessionActive
 	}
 	if len(gs.Rounds) > 1 {
 		return errvar.ErrGameSessionWager
 	}
-	_, err = g.store.DB.Exec("DELETE FROM game_session WHERE id = ?", id)
-	if err != nil {
+	if err = g.repo.Delete(gs); err != nil {
 		return err
 	}
+	g.publish(GameSessionCancelled, gs)
 	return nil
 }
 
 func NewGameSessionService(
-	store *db.Datastore,
+	repo GameSessionRepository,
 	s SessionService,
 	r GameSessionRoundService,
 	pt ParticipantService,
+	rt RatingService,
+	h *GameSessionHub,
+	d *webhook.Dispatcher,
 ) GameSessionService {
-	return &gsService{store, s, r, pt}
+	return &gsService{repo, s, r, pt, rt, h, d}
 }
 
-func withRounds(q string) string {
-	return fmt.Sprintf(`WITH ordered_rounds AS (
-    SELECT
-        gr.id,
-        gr.game_session_id,
-        gr.round,
-        gr.wager,
-        gr.active,
-        gr.result
-    FROM
-        game_session_round gr
-    WHERE
-        gr.game_session_id = s.id
-    ORDER BY
-        gr.round DESC
-)
-
-SELECT
+// withRounds selects game sessions with their rounds, latest first, as json.
+func withRounds(d db.Dialect, q string) string {
+	return fmt.Sprintf(`SELECT
     s.id,
     s.session_id,
     s.game_id,
     s.result,
     s.started,
     s.ended,
+    s.version,
     COALESCE(
             (
-                SELECT json_group_array(
-                               json_object(
+                SELECT %[1]s(
+                               %[2]s(
                                        'id', o.id,
                                        'game_session_id', o.game_session_id,
                                        'round', o.round,
                                        'wager', o.wager,
                                        'active', o.active,
-                                       'result', o.result
+                                       'result', o.result,
+                                       'version', o.version
                                )
                        )
-                FROM ordered_rounds o
+                FROM (
+                    SELECT
+                        gr.id,
+                        gr.game_session_id,
+                        gr.round,
+                        gr.wager,
+                        gr.active,
+                        gr.result,
+                        gr.version
+                    FROM
+                        game_session_round gr
+                    WHERE
+                        gr.game_session_id = s.id
+                    ORDER BY
+                        gr.round DESC
+                ) o
             ), '[]'
     ) AS rounds
 FROM
-    game_session s %s`, q)
+    game_session s %[3]s`, d.JSONArray(), d.JSONObject(), q)
 }
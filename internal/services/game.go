@@ -22,64 +22,36 @@ type GameService interface {
 	Create(name string) (Game, error)
 	ByPK(id db.ID) (Game, error)
 	All(pg *pagination.P) ([]Game, error)
+	Rename(id db.ID, name string) error
 }
 
 type gService struct {
-	store *db.Datastore
+	repo GameRepository
 }
 
 func (g *gService) Create(name string) (Game, error) {
 	game := Game{Name: name}
-	r, err := g.store.DB.Exec(
-		"INSERT INTO game (name) VALUES (?)",
-		name,
-	)
-	if err != nil {
-		return game, err
-	}
-	id, err := r.LastInsertId()
-	if err != nil {
-		return game, err
-	}
-	game.ID = db.ID(id)
-	return game, nil
+	err := g.repo.Insert(&game)
+	return game, err
 }
 
 func (g *gService) ByPK(id db.ID) (Game, error) {
-	var game Game
-	err := g.store.DB.QueryRow(
-		"SELECT * from game WHERE id = ?",
-		id,
-	).Scan(&game.ID, &game.Name)
+	return g.repo.ByPK(id)
+}
+
+func (g *gService) Rename(id db.ID, name string) error {
+	game, err := g.repo.ByPK(id)
 	if err != nil {
-		return Game{}, err
+		return err
 	}
-	return game, nil
+	game.Name = name
+	return g.repo.Update(game)
 }
 
 func (g *gService) All(p *pagination.P) ([]Game, error) {
-	games := make([]Game, 0)
-	rows, err := g.store.DB.Query(
-		pagination.MakeQuery("SELECT id, name from game ORDER BY id", p))
-	if err != nil {
-		return games, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var game Game
-		err = rows.Scan(&game.ID, &game.Name)
-		if err != nil {
-			return games, err
-		}
-		games = append(games, game)
-	}
-	err = rows.Err()
-	if err != nil {
-		return games, err
-	}
-	return games, nil
+	return g.repo.All(p)
 }
 
-func NewGameService(store *db.Datastore) GameService {
-	return &gService{store}
+func NewGameService(repo GameRepository) GameService {
+	return &gService{repo}
 }
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// HistoryRound is an ended round along with the game session it was played in.
+type HistoryRound struct {
+	ID            db.ID            `json:"id"`
+	GameSessionID db.ID            `json:"gameSessionId"`
+	SessionID     db.ID            `json:"sessionId"`
+	GameID        db.ID            `json:"gameId"`
+	Round         int              `json:"round"`
+	Wager         int              `json:"wager"`
+	Result        result.ResultMap `json:"result"`
+	Started       time.Time        `json:"started"`
+	Ended         *time.Time       `json:"ended"`
+}
+
+func (h HistoryRound) ResultMap() result.ResultMap {
+	return h.Result
+}
+
+type HistoryFilter struct {
+	From   *time.Time
+	To     *time.Time
+	GameID db.ID
+	UserID db.ID
+}
+
+type HistoryService interface {
+	Rounds(f HistoryFilter) ([]HistoryRound, error)
+}
+
+type hService struct {
+	store *db.Datastore
+}
+
+func (h *hService) Rounds(f HistoryFilter) ([]HistoryRound, error) {
+	rounds := make([]HistoryRound, 0)
+	where := []string{"r.active = 0"}
+	args := []any{}
+	if f.From != nil {
+		where = append(where, "gs.started >= ?")
+		args = append(args, FormatTime(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "gs.started <= ?")
+		args = append(args, FormatTime(*f.To))
+	}
+	if f.GameID > 0 {
+		where = append(where, "gs.game_id = ?")
+		args = append(args, f.GameID)
+	}
+	if f.UserID > 0 {
+		where = append(where, `EXISTS (SELECT 1
+FROM session_participant p
+WHERE p.session_id = gs.session_id AND p.user_id = ?)`)
+		args = append(args, f.UserID)
+	}
+	rows, err := h.store.Query(`SELECT r.id,
+       r.game_session_id,
+       gs.session_id,
+       gs.game_id,
+       r.round,
+       r.wager,
+       r.result,
+       gs.started,
+       gs.ended
+FROM game_session_round r
+         JOIN game_session gs ON r.game_session_id = gs.id
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY gs.started, gs.id, r.round`, args...)
+	if err != nil {
+		return rounds, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hr HistoryRound
+		var sResult string
+		err = rows.Scan(&hr.ID, &hr.GameSessionID, &hr.SessionID, &hr.GameID,
+			&hr.Round, &hr.Wager, &sResult, &hr.Started, &hr.Ended)
+		if err != nil {
+			return rounds, err
+		}
+		hr.Result = result.FromString(sResult)
+		rounds = append(rounds, hr)
+	}
+	err = rows.Err()
+	if err != nil {
+		return rounds, err
+	}
+	return rounds, nil
+}
+
+func NewHistoryService(store *db.Datastore) HistoryService {
+	return &hService{store}
+}
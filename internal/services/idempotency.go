@@ -0,0 +1,85 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+// IdempotentResponse is a response stored under the idempotency key of a user.
+// Status is 0 while the request is still in progress.
+type IdempotentResponse struct {
+	UserID      db.ID
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+	Created     time.Time
+}
+
+type IdempotencyService interface {
+	Get(userID db.ID, key string) (IdempotentResponse, error)
+
+	// Begin claims key for a request, it fails if key is already claimed.
+	Begin(userID db.ID, key string, fingerprint string) error
+	Complete(userID db.ID, key string, status int, header map[string][]string, body []byte) error
+	Release(userID db.ID, key string) error
+	// Purge removes every key created before t.
+	Purge(t time.Time) error
+}
+
+type idService struct {
+	store *db.Datastore
+}
+
+func (i *idService) Get(userID db.ID, key string) (IdempotentResponse, error) {
+	res := IdempotentResponse{UserID: userID, Key: key}
+	var header string
+	err := i.store.QueryRow(`SELECT fingerprint, status, header, body, created
+FROM idempotency_key WHERE user_id = ? AND key = ?`, userID, key,
+	).Scan(&res.Fingerprint, &res.Status, &header, &res.Body, &res.Created)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal([]byte(header), &res.Header)
+	return res, err
+}
+
+func (i *idService) Begin(userID db.ID, key string, fingerprint string) error {
+	_, err := i.store.Exec(`INSERT
+INTO idempotency_key (user_id, key, fingerprint, created)
+    VALUES (?, ?, ?, ?)`,
+		userID, key, fingerprint, FormatTime(NewTime()))
+	return err
+}
+
+func (i *idService) Complete(
+	userID db.ID, key string, status int, header map[string][]string, body []byte,
+) error {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	_, err = i.store.Exec(
+		"UPDATE idempotency_key SET status = ?, header = ?, body = ? WHERE user_id = ? AND key = ?",
+		status, string(h), body, userID, key)
+	return err
+}
+
+func (i *idService) Release(userID db.ID, key string) error {
+	_, err := i.store.Exec(
+		"DELETE FROM idempotency_key WHERE user_id = ? AND key = ?", userID, key)
+	return err
+}
+
+func (i *idService) Purge(t time.Time) error {
+	_, err := i.store.Exec(
+		"DELETE FROM idempotency_key WHERE created < ?", FormatTime(t))
+	return err
+}
+
+func NewIdempotencyService(store *db.Datastore) IdempotencyService {
+	return &idService{store}
+}
@@ -17,38 +17,21 @@ func (p Participant) ResultID() db.ID {
 
 type ParticipantService interface {
 	FromSession(sessionID db.ID, pg *pagination.P) ([]Participant, error)
+	CountByUser(userID db.ID) (int, error)
 }
 
 type pService struct {
-	store *db.Datastore
+	repo SessionRepository
 }
 
 func (p *pService) FromSession(sessionID db.ID, pg *pagination.P) ([]Participant, error) {
-	pts := make([]Participant, 0)
-	rows, err := p.store.DB.Query(
-		pagination.MakeQuery(
-			"SELECT id, user_id, session_id FROM session_participant WHERE session_id = ?",
-			pg),
-		sessionID)
-	if err != nil {
-		return pts, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var pt Participant
-		err = rows.Scan(&pt.ID, &pt.UserID, &pt.SessionID)
-		if err != nil {
-			return pts, err
-		}
-		pts = append(pts, pt)
-	}
-	err = rows.Err()
-	if err != nil {
-		return pts, err
-	}
-	return pts, nil
+	return p.repo.Participants(sessionID, pg)
 }
 
-func NewParticipantService(store *db.Datastore) ParticipantService {
-	return &pService{store}
+func (p *pService) CountByUser(userID db.ID) (int, error) {
+	return p.repo.CountByUser(userID)
+}
+
+func NewParticipantService(repo SessionRepository) ParticipantService {
+	return &pService{repo}
 }
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/rating"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+type Rating struct {
+	UserID db.ID   `json:"userId"`
+	Name   string  `json:"name"`
+	GameID db.ID   `json:"gameId"`
+	Rating float64 `json:"rating"`
+	Rounds int     `json:"rounds"`
+}
+
+type RatingEntry struct {
+	ID      db.ID     `json:"id"`
+	UserID  db.ID     `json:"userId"`
+	GameID  db.ID     `json:"gameId"`
+	RoundID db.ID     `json:"roundId"`
+	Rating  float64   `json:"rating"`
+	Delta   float64   `json:"delta"`
+	Created time.Time `json:"created"`
+}
+
+type RatingService interface {
+	Current(gameID db.ID) ([]Rating, error)
+	History(gameID db.ID, userID db.ID) ([]RatingEntry, error)
+
+	Record(gameID db.ID, roundID db.ID, r result.ResultMap) error
+	Recompute() error
+}
+
+type rtService struct {
+	store *db.Datastore
+	h     HistoryService
+}
+
+func (rt *rtService) Current(gameID db.ID) ([]Rating, error) {
+	ratings := make([]Rating, 0)
+	rows, err := rt.store.Query(`SELECT r.user_id,
+       u.name,
+       r.game_id,
+       r.rating,
+       (SELECT COUNT(*) FROM rating c WHERE c.user_id = r.user_id AND c.game_id = r.game_id)
+FROM rating r
+         JOIN "user" u ON r.user_id = u.id
+WHERE r.game_id = ?
+  AND r.id = (SELECT MAX(m.id) FROM rating m WHERE m.user_id = r.user_id AND m.game_id = r.game_id)
+ORDER BY r.rating DESC`, gameID)
+	if err != nil {
+		return ratings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Rating
+		err = rows.Scan(&r.UserID, &r.Name, &r.GameID, &r.Rating, &r.Rounds)
+		if err != nil {
+			return ratings, err
+		}
+		ratings = append(ratings, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		return ratings, err
+	}
+	return ratings, nil
+}
+
+func (rt *rtService) History(gameID db.ID, userID db.ID) ([]RatingEntry, error) {
+	entries := make([]RatingEntry, 0)
+	q := `SELECT id, user_id, game_id, game_session_round_id, rating, delta, created
+FROM rating
+WHERE game_id = ?`
+	args := []any{gameID}
+	if userID > 0 {
+		q += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := rt.store.Query(q+" ORDER BY id", args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e RatingEntry
+		err = rows.Scan(&e.ID, &e.UserID, &e.GameID, &e.RoundID, &e.Rating, &e.Delta, &e.Created)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+func (rt *rtService) current(gameID db.ID) (map[db.ID]float64, error) {
+	rs, err := rt.Current(gameID)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[db.ID]float64, len(rs))
+	for _, r := range rs {
+		m[r.UserID] = r.Rating
+	}
+	return m, nil
+}
+
+func (rt *rtService) Record(gameID db.ID, roundID db.ID, r result.ResultMap) error {
+	winner, ok := r.Winner()
+	if !ok {
+		return nil
+	}
+	ratings, err := rt.current(gameID)
+	if err != nil {
+		return err
+	}
+	tx, err := rt.store.Begin()
+	if err != nil {
+		return err
+	}
+	err = insertRatings(tx, ratings, gameID, roundID, r, winner, NewTime())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recompute replays every ended round in the order it was played.
+func (rt *rtService) Recompute() error {
+	rounds, err := rt.h.Rounds(HistoryFilter{})
+	if err != nil {
+		return err
+	}
+	tx, err := rt.store.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM rating")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	games := map[db.ID]map[db.ID]float64{}
+	for _, hr := range rounds {
+		winner, ok := hr.Result.Winner()
+		if !ok {
+			continue
+		}
+		ratings, ok := games[hr.GameID]
+		if !ok {
+			ratings = map[db.ID]float64{}
+			games[hr.GameID] = ratings
+		}
+		created := hr.Started
+		if hr.Ended != nil {
+			created = *hr.Ended
+		}
+		err = insertRatings(tx, ratings, hr.GameID, hr.ID, hr.Result, winner, created)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertRatings updates ratings in place and stores an entry per participant.
+func insertRatings(
+	tx *db.Tx, ratings map[db.ID]float64, gameID db.ID, roundID db.ID,
+	r result.ResultMap, winner db.ID, created time.Time,
+) error {
+	participants := make([]db.ID, 0, len(r))
+	for id := range r {
+		participants = append(participants, id)
+	}
+	updated := rating.Update(ratings, rating.Placements(participants, winner))
+	stmt, err := tx.Prepare(`INSERT
+INTO rating (user_id, game_id, game_session_round_id, rating, delta, created)
+    VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for id, nr := range updated {
+		prev, ok := ratings[id]
+		if !ok {
+			prev = rating.Initial
+		}
+		_, err = stmt.Exec(id, gameID, roundID, nr, nr-prev, FormatTime(created))
+		if err != nil {
+			return err
+		}
+		ratings[id] = nr
+	}
+	return nil
+}
+
+func NewRatingService(store *db.Datastore, h HistoryService) RatingService {
+	return &rtService{store, h}
+}
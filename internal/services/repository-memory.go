@@ -0,0 +1,826 @@
+package services
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// NewMemoryRepositories are repositories kept in memory, for tests of
+// the services that do not need a database. Rows are copied in and out,
+// so changes are only seen once written. Lists by a query.Spec match
+// its filters in Go, conditions added with query.Spec.Where fail with
+// errvar.ErrQuerySpec.
+func NewMemoryRepositories() Repositories {
+	m := &memory{
+		ids:          map[string]db.ID{},
+		users:        map[db.ID]UserWithPassword{},
+		games:        map[db.ID]Game{},
+		sessions:     map[db.ID]Session{},
+		participants: map[db.ID][]Participant{},
+		gameSessions: map[db.ID]GameSession{},
+		rounds:       map[db.ID]GameSessionRound{},
+	}
+	return Repositories{
+		Users:        &memUsers{m},
+		Games:        &memGames{m},
+		Sessions:     &memSessions{m},
+		GameSessions: &memGameSessions{m},
+		Rounds:       &memRounds{m},
+		Ledger:       &memLedger{m},
+	}
+}
+
+type memory struct {
+	mu           sync.Mutex
+	ids          map[string]db.ID
+	users        map[db.ID]UserWithPassword
+	games        map[db.ID]Game
+	sessions     map[db.ID]Session
+	participants map[db.ID][]Participant
+	gameSessions map[db.ID]GameSession
+	rounds       map[db.ID]GameSessionRound
+	ledger       result.ResultMap
+}
+
+// next is the next id of table, ids start at 1 like those of SQLite.
+func (m *memory) next(table string) db.ID {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+func (m *memory) participates(sessionID db.ID, userID db.ID) bool {
+	for _, pt := range m.participants[sessionID] {
+		if pt.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memory) roundsOf(gameSessionID db.ID) GameSessionRounds {
+	rounds := GameSessionRounds{}
+	for _, gr := range m.rounds {
+		if gr.GameSessionID == gameSessionID {
+			rounds = append(rounds, copyRound(gr))
+		}
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i].Round > rounds[j].Round })
+	return rounds
+}
+
+func (m *memory) gameSession(gs GameSession) GameSession {
+	gs = copyGameSession(gs)
+	gs.Rounds = m.roundsOf(gs.ID)
+	return gs
+}
+
+func (m *memory) deleteGameSession(id db.ID) {
+	for rid, gr := range m.rounds {
+		if gr.GameSessionID == id {
+			delete(m.rounds, rid)
+		}
+	}
+	delete(m.gameSessions, id)
+}
+
+func copyResult(rm result.ResultMap) result.ResultMap {
+	if rm == nil {
+		return nil
+	}
+	return result.FromString(rm.String())
+}
+
+func copyTime[T any](t *T) *T {
+	if t == nil {
+		return nil
+	}
+	return GetPtr(*t)
+}
+
+func copySession(s Session) Session {
+	s.Result = copyResult(s.Result)
+	s.Ended = copyTime(s.Ended)
+	return s
+}
+
+func copyGameSession(gs GameSession) GameSession {
+	gs.Result = copyResult(gs.Result)
+	gs.Ended = copyTime(gs.Ended)
+	gs.Rounds = nil
+	return gs
+}
+
+func copyRound(gr GameSessionRound) GameSessionRound {
+	gr.Result = copyResult(gr.Result)
+	return gr
+}
+
+// matches reports if match holds for every value of the filters of spec.
+func matches(filters url.Values, match func(name string, value string) (bool, error)) (bool, error) {
+	for name, values := range filters {
+		for _, v := range values {
+			ok, err := match(name, v)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// matchSpan matches the filters of the state and time span shared by
+// sessions and game sessions.
+func matchSpan(name string, value string, started time.Time, ended *time.Time) (bool, error) {
+	switch name {
+	case "state":
+		switch value {
+		case "active":
+			return ended == nil, nil
+		case "ended":
+			return ended != nil, nil
+		}
+		return true, nil
+	case "from", "to":
+		t, err := query.ParseTime(name, value, name == "to")
+		if err != nil {
+			return false, err
+		}
+		started = started.Truncate(time.Second)
+		if name == "from" {
+			return !started.Before(t), nil
+		}
+		return !started.After(t), nil
+	}
+	return false, errvar.ErrQuerySpec
+}
+
+func filterID(value string) db.ID {
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return db.ID(id)
+}
+
+// page is the part of items in p.
+func page[T any](items []T, p *pagination.P) []T {
+	if p == nil {
+		return items
+	}
+	if p.Offset >= len(items) {
+		return items[:0]
+	}
+	items = items[p.Offset:]
+	if p.Limit >= 0 && p.Limit < len(items) {
+		items = items[:p.Limit]
+	}
+	return items
+}
+
+type memUsers struct {
+	*memory
+}
+
+func (m *memUsers) ByPK(id db.ID) (UserWithPassword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return UserWithPassword{}, sql.ErrNoRows
+	}
+	u.Deactivated = copyTime(u.Deactivated)
+	return u, nil
+}
+
+func (m *memUsers) ByName(name string) (UserWithPassword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Name == name {
+			u.Deactivated = copyTime(u.Deactivated)
+			return u, nil
+		}
+	}
+	return UserWithPassword{}, sql.ErrNoRows
+}
+
+func (m *memUsers) All(p *pagination.P) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usrs := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		usr := u.User
+		usr.Deactivated = copyTime(usr.Deactivated)
+		usrs = append(usrs, usr)
+	}
+	sort.Slice(usrs, func(i, j int) bool { return usrs[i].ID < usrs[j].ID })
+	return page(usrs, p), nil
+}
+
+func (m *memUsers) BySession(sessionID db.ID) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usrs := make([]User, 0)
+	for _, pt := range m.participants[sessionID] {
+		usr := m.users[pt.UserID].User
+		usr.Deactivated = copyTime(usr.Deactivated)
+		usrs = append(usrs, usr)
+	}
+	sort.Slice(usrs, func(i, j int) bool { return usrs[i].ID < usrs[j].ID })
+	return usrs, nil
+}
+
+func (m *memUsers) Find(spec query.Spec) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usrs, err := m.find(spec)
+	if err != nil {
+		return usrs, err
+	}
+	return query.Sort(spec, usrs, func(u User) int64 { return int64(u.ID) }, UserValues.For(spec)), nil
+}
+
+func (m *memUsers) Count(spec query.Spec) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usrs, err := m.find(spec)
+	return len(usrs), err
+}
+
+// find are the users matching the filters of spec.
+func (m *memUsers) find(spec query.Spec) ([]User, error) {
+	usrs := make([]User, 0)
+	if spec.Raw() {
+		return usrs, errvar.ErrQuerySpec
+	}
+	filters := spec.Filters()
+	for _, u := range m.users {
+		ok, err := matches(filters, func(name string, value string) (bool, error) {
+			switch name {
+			case "name":
+				return strings.Contains(strings.ToLower(u.Name), strings.ToLower(value)), nil
+			case "session":
+				return m.participates(filterID(value), u.ID), nil
+			}
+			return false, errvar.ErrQuerySpec
+		})
+		if err != nil {
+			return usrs, err
+		}
+		if ok {
+			usr := u.User
+			usr.Deactivated = copyTime(usr.Deactivated)
+			usrs = append(usrs, usr)
+		}
+	}
+	return usrs, nil
+}
+
+func (m *memUsers) taken(u UserWithPassword) bool {
+	for _, o := range m.users {
+		if o.ID != u.ID && o.Name == u.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memUsers) Insert(u *UserWithPassword) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.taken(*u) {
+		return db.ErrUnique
+	}
+	u.ID = m.next("user")
+	m.users[u.ID] = *u
+	return nil
+}
+
+func (m *memUsers) Update(u UserWithPassword) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	if m.taken(u) {
+		return db.ErrUnique
+	}
+	u.Deactivated = copyTime(u.Deactivated)
+	m.users[u.ID] = u
+	return nil
+}
+
+type memGames struct {
+	*memory
+}
+
+func (m *memGames) ByPK(id db.ID) (Game, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.games[id]
+	if !ok {
+		return Game{}, sql.ErrNoRows
+	}
+	return g, nil
+}
+
+func (m *memGames) All(p *pagination.P) ([]Game, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	games := make([]Game, 0, len(m.games))
+	for _, g := range m.games {
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].ID < games[j].ID })
+	return page(games, p), nil
+}
+
+func (m *memGames) taken(g Game) bool {
+	for _, o := range m.games {
+		if o.ID != g.ID && o.Name == g.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memGames) Insert(g *Game) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.taken(*g) {
+		return db.ErrUnique
+	}
+	g.ID = m.next("game")
+	m.games[g.ID] = *g
+	return nil
+}
+
+func (m *memGames) Update(g Game) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.games[g.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	if m.taken(g) {
+		return db.ErrUnique
+	}
+	m.games[g.ID] = g
+	return nil
+}
+
+type memSessions struct {
+	*memory
+}
+
+func (m *memSessions) ByPK(id db.ID) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Session{}, sql.ErrNoRows
+	}
+	return copySession(s), nil
+}
+
+func (m *memSessions) WithGames(id db.ID) (SessionWithGames, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return SessionWithGames{}, sql.ErrNoRows
+	}
+	return m.withGames(s), nil
+}
+
+func (m *memSessions) Active() (SessionWithGames, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.Ended == nil {
+			return m.withGames(s), nil
+		}
+	}
+	return SessionWithGames{}, sql.ErrNoRows
+}
+
+// withGames has the game sessions of s ended last first, then the active one.
+func (m *memSessions) withGames(s Session) SessionWithGames {
+	ss := SessionWithGames{Session: copySession(s), Users: Users{}, GameSessions: GameSessions{}}
+	for _, pt := range m.participants[s.ID] {
+		ss.Users = append(ss.Users, pt.UserID)
+	}
+	for _, gs := range m.gameSessions {
+		if gs.SessionID == s.ID {
+			ss.GameSessions = append(ss.GameSessions, m.gameSession(gs))
+		}
+	}
+	sort.Slice(ss.GameSessions, func(i, j int) bool {
+		a, b := ss.GameSessions[i], ss.GameSessions[j]
+		if a.Ended == nil || b.Ended == nil {
+			return b.Ended == nil && a.Ended != nil
+		}
+		if !a.Ended.Equal(*b.Ended) {
+			return a.Ended.After(*b.Ended)
+		}
+		return a.ID > b.ID
+	})
+	return ss
+}
+
+func (m *memSessions) Ended() ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ss := make([]Session, 0)
+	for _, s := range m.sessions {
+		if s.Ended != nil {
+			ss = append(ss, copySession(s))
+		}
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].ID < ss[j].ID })
+	return ss, nil
+}
+
+func (m *memSessions) Find(spec query.Spec) ([]Session, error) {
+	sgs, err := m.FindWithGames(spec)
+	ss := make([]Session, len(sgs))
+	for i, s := range sgs {
+		ss[i] = s.Session
+	}
+	return ss, err
+}
+
+func (m *memSessions) FindWithGames(spec query.Spec) ([]SessionWithGames, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ss, err := m.find(spec)
+	if err != nil {
+		return ss, err
+	}
+	return query.Sort(spec, ss,
+		func(s SessionWithGames) int64 { return int64(s.ID) }, SessionValues.For(spec)), nil
+}
+
+func (m *memSessions) Count(spec query.Spec) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ss, err := m.find(spec)
+	return len(ss), err
+}
+
+// find are the sessions matching the filters of spec.
+func (m *memSessions) find(spec query.Spec) ([]SessionWithGames, error) {
+	ss := make([]SessionWithGames, 0)
+	if spec.Raw() {
+		return ss, errvar.ErrQuerySpec
+	}
+	filters := spec.Filters()
+	for _, s := range m.sessions {
+		ses := m.withGames(s)
+		ok, err := matches(filters, func(name string, value string) (bool, error) {
+			switch name {
+			case "participant":
+				return m.participates(s.ID, filterID(value)), nil
+			case "game":
+				for _, gs := range ses.GameSessions {
+					if gs.GameID == filterID(value) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			return matchSpan(name, value, s.Started, s.Ended)
+		})
+		if err != nil {
+			return ss, err
+		}
+		if ok {
+			ss = append(ss, ses)
+		}
+	}
+	return ss, nil
+}
+
+func (m *memSessions) Participants(sessionID db.ID, p *pagination.P) ([]Participant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return page(append([]Participant{}, m.participants[sessionID]...), p), nil
+}
+
+func (m *memSessions) CountByUser(userID db.ID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, pts := range m.participants {
+		for _, pt := range pts {
+			if pt.UserID == userID {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func (m *memSessions) Insert(s *SessionWithGames) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range s.Users {
+		if _, ok := m.users[id]; !ok {
+			return db.ErrForeignKey
+		}
+	}
+	s.ID = m.next("session")
+	m.sessions[s.ID] = copySession(s.Session)
+	for _, id := range s.Users {
+		m.participants[s.ID] = append(m.participants[s.ID],
+			Participant{ID: m.next("session_participant"), UserID: id, SessionID: s.ID})
+	}
+	return nil
+}
+
+func (m *memSessions) Update(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.sessions[s.ID]
+	if !ok || current.Version != s.Version {
+		return errvar.ErrVersionConflict
+	}
+	current.Ended = copyTime(s.Ended)
+	current.Version++
+	m.sessions[s.ID] = current
+	s.Result = copyResult(current.Result)
+	s.Version = current.Version
+	return nil
+}
+
+func (m *memSessions) UpdateResult(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.sessions[s.ID]
+	if !ok || current.Version != s.Version {
+		return errvar.ErrVersionConflict
+	}
+	current.Result = copyResult(s.Result)
+	m.sessions[s.ID] = current
+	return nil
+}
+
+func (m *memSessions) Delete(s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.sessions[s.ID]
+	if !ok || current.Version != s.Version {
+		return errvar.ErrVersionConflict
+	}
+	for id, gs := range m.gameSessions {
+		if gs.SessionID == s.ID {
+			m.deleteGameSession(id)
+		}
+	}
+	delete(m.participants, s.ID)
+	delete(m.sessions, s.ID)
+	return nil
+}
+
+type memGameSessions struct {
+	*memory
+}
+
+func (m *memGameSessions) ByPK(id db.ID) (GameSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gs, ok := m.gameSessions[id]
+	if !ok {
+		return GameSession{}, sql.ErrNoRows
+	}
+	return m.gameSession(gs), nil
+}
+
+func (m *memGameSessions) Active(sessionID db.ID) (GameSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, gs := range m.gameSessions {
+		if gs.SessionID == sessionID && gs.Ended == nil {
+			return m.gameSession(gs), nil
+		}
+	}
+	return GameSession{}, sql.ErrNoRows
+}
+
+func (m *memGameSessions) Find(spec query.Spec) ([]GameSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gss, err := m.find(spec)
+	if err != nil {
+		return gss, err
+	}
+	return query.Sort(spec, gss,
+		func(gs GameSession) int64 { return int64(gs.ID) }, GameSessionValues.For(spec)), nil
+}
+
+func (m *memGameSessions) Count(spec query.Spec) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gss, err := m.find(spec)
+	return len(gss), err
+}
+
+// find are the game sessions matching the filters of spec.
+func (m *memGameSessions) find(spec query.Spec) ([]GameSession, error) {
+	gss := make([]GameSession, 0)
+	if spec.Raw() {
+		return gss, errvar.ErrQuerySpec
+	}
+	filters := spec.Filters()
+	for _, gs := range m.gameSessions {
+		ok, err := matches(filters, func(name string, value string) (bool, error) {
+			switch name {
+			case "game":
+				return gs.GameID == filterID(value), nil
+			case "session":
+				return gs.SessionID == filterID(value), nil
+			}
+			return matchSpan(name, value, gs.Started, gs.Ended)
+		})
+		if err != nil {
+			return gss, err
+		}
+		if ok {
+			gss = append(gss, m.gameSession(gs))
+		}
+	}
+	return gss, nil
+}
+
+func (m *memGameSessions) FromGame(gameID db.ID, p *pagination.P) ([]GameSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gss := make([]GameSession, 0)
+	for _, gs := range m.gameSessions {
+		if gs.GameID == gameID {
+			gss = append(gss, m.gameSession(gs))
+		}
+	}
+	sort.Slice(gss, func(i, j int) bool {
+		if !gss[i].Started.Equal(gss[j].Started) {
+			return gss[i].Started.After(gss[j].Started)
+		}
+		return gss[i].ID > gss[j].ID
+	})
+	return page(gss, p), nil
+}
+
+func (m *memGameSessions) Insert(gs *GameSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[gs.SessionID]; !ok {
+		return db.ErrForeignKey
+	}
+	if _, ok := m.games[gs.GameID]; !ok {
+		return db.ErrForeignKey
+	}
+	gs.ID = m.next("game_session")
+	m.gameSessions[gs.ID] = copyGameSession(*gs)
+	return nil
+}
+
+func (m *memGameSessions) Update(gs *GameSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.gameSessions[gs.ID]
+	if !ok || current.Version != gs.Version {
+		return errvar.ErrVersionConflict
+	}
+	gs.Version++
+	m.gameSessions[gs.ID] = copyGameSession(*gs)
+	return nil
+}
+
+func (m *memGameSessions) NewRound(gs *GameSession, gr *GameSessionRound) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.gameSessions[gs.ID]
+	if !ok || current.Version != gs.Version {
+		return errvar.ErrVersionConflict
+	}
+	current.Version++
+	gs.Version = current.Version
+	gr.ID = m.next("game_session_round")
+	m.gameSessions[gs.ID] = current
+	m.rounds[gr.ID] = copyRound(*gr)
+	return nil
+}
+
+func (m *memGameSessions) EndRound(gs *GameSession, gr *GameSessionRound) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.gameSessions[gs.ID]
+	if !ok || current.Version != gs.Version {
+		return errvar.ErrVersionConflict
+	}
+	round, ok := m.rounds[gr.ID]
+	if !ok || round.Version != gr.Version {
+		return errvar.ErrVersionConflict
+	}
+	gs.Version++
+	gr.Version++
+	m.gameSessions[gs.ID] = copyGameSession(*gs)
+	m.rounds[gr.ID] = copyRound(*gr)
+	return nil
+}
+
+func (m *memGameSessions) Delete(gs GameSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.gameSessions[gs.ID]
+	if !ok || current.Version != gs.Version {
+		return errvar.ErrVersionConflict
+	}
+	m.deleteGameSession(gs.ID)
+	return nil
+}
+
+type memRounds struct {
+	*memory
+}
+
+func (m *memRounds) FromGameSession(gameSessionID db.ID) ([]GameSessionRound, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.roundsOf(gameSessionID), nil
+}
+
+func (m *memRounds) Active(gameSessionID db.ID) (GameSessionRound, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, gr := range m.rounds {
+		if gr.GameSessionID == gameSessionID && gr.Active == 1 {
+			return copyRound(gr), nil
+		}
+	}
+	return GameSessionRound{}, sql.ErrNoRows
+}
+
+func (m *memRounds) Insert(gr *GameSessionRound) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.gameSessions[gr.GameSessionID]; !ok {
+		return db.ErrForeignKey
+	}
+	gr.ID = m.next("game_session_round")
+	m.rounds[gr.ID] = copyRound(*gr)
+	return nil
+}
+
+func (m *memRounds) Update(gr *GameSessionRound) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.rounds[gr.ID]
+	if !ok || current.Version != gr.Version {
+		return errvar.ErrVersionConflict
+	}
+	gr.Version++
+	m.rounds[gr.ID] = copyRound(*gr)
+	return nil
+}
+
+func (m *memRounds) Delete(gr GameSessionRound) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.rounds[gr.ID]
+	if !ok || current.Version != gr.Version {
+		return errvar.ErrVersionConflict
+	}
+	delete(m.rounds, gr.ID)
+	return nil
+}
+
+type memLedger struct {
+	*memory
+}
+
+func (m *memLedger) Load() (result.ResultMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ledger == nil {
+		return result.ResultMap{}, sql.ErrNoRows
+	}
+	return copyResult(m.ledger), nil
+}
+
+func (m *memLedger) Save(rm result.ResultMap) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ledger = copyResult(rm)
+	if m.ledger == nil {
+		m.ledger = result.ResultMap{}
+	}
+	return nil
+}
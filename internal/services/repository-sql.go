@@ -0,0 +1,594 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// NewSQLRepositories are the repositories of store.
+func NewSQLRepositories(store *db.Datastore) Repositories {
+	return Repositories{
+		Users:        &sqlUsers{store},
+		Games:        &sqlGames{store},
+		Sessions:     &sqlSessions{store},
+		GameSessions: &sqlGameSessions{store},
+		Rounds:       &sqlRounds{store},
+		Ledger:       &sqlLedger{store},
+	}
+}
+
+type sqlUsers struct {
+	store *db.Datastore
+}
+
+func (u *sqlUsers) ByPK(id db.ID) (UserWithPassword, error) {
+	var usr UserWithPassword
+	err := u.store.QueryRow(
+		`SELECT id, name, password, deactivated from "user" WHERE id = ?`,
+		id,
+	).Scan(&usr.ID, &usr.Name, &usr.Password, &usr.Deactivated)
+	if err != nil {
+		return usr, err
+	}
+	return usr, nil
+}
+
+func (u *sqlUsers) ByName(name string) (UserWithPassword, error) {
+	var usr UserWithPassword
+	err := u.store.QueryRow(
+		`SELECT id, name, password, deactivated from "user" WHERE name = ?`,
+		name,
+	).Scan(&usr.ID, &usr.Name, &usr.Password, &usr.Deactivated)
+	if err != nil {
+		return usr, err
+	}
+	return usr, nil
+}
+
+func (u *sqlUsers) All(p *pagination.P) ([]User, error) {
+	return u.all(pagination.MakeQuery(`SELECT id, name, deactivated from "user" ORDER BY id`, p))
+}
+
+func (u *sqlUsers) BySession(sessionID db.ID) ([]User, error) {
+	return u.all(`SELECT u.id, u.name, u.deactivated
+FROM session_participant p
+         JOIN "user" u ON p.user_id = u.id
+WHERE p.session_id = ?
+ORDER BY u.id`, sessionID)
+}
+
+func (u *sqlUsers) Find(spec query.Spec) ([]User, error) {
+	q, args := spec.In(u.store.Dialect).Select(`SELECT u.id, u.name, u.deactivated FROM "user" u`)
+	usrs, err := u.all(q, args...)
+	return query.Ordered(spec, usrs), err
+}
+
+func (u *sqlUsers) Count(spec query.Spec) (int, error) {
+	var count int
+	q, args := spec.Count(`SELECT COUNT(*) FROM "user" u`)
+	err := u.store.QueryRow(q, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (u *sqlUsers) all(q string, args ...any) ([]User, error) {
+	usrs := make([]User, 0)
+	rows, err := u.store.Query(q, args...)
+	if err != nil {
+		return usrs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var usr User
+		err = rows.Scan(&usr.ID, &usr.Name, &usr.Deactivated)
+		if err != nil {
+			return usrs, err
+		}
+		usrs = append(usrs, usr)
+	}
+	return usrs, rows.Err()
+}
+
+func (u *sqlUsers) Insert(usr *UserWithPassword) error {
+	return u.store.QueryRow(
+		`INSERT INTO "user" (name, password, deactivated) VALUES (?, ?, ?) RETURNING id`,
+		usr.Name, usr.Password, formatEnded(usr.Deactivated),
+	).Scan(&usr.ID)
+}
+
+func (u *sqlUsers) Update(usr UserWithPassword) error {
+	return affected(u.store.Exec(
+		`UPDATE "user" SET name = ?, password = ?, deactivated = ? WHERE id = ?`,
+		usr.Name, usr.Password, formatEnded(usr.Deactivated), usr.ID))
+}
+
+type sqlGames struct {
+	store *db.Datastore
+}
+
+func (g *sqlGames) ByPK(id db.ID) (Game, error) {
+	var game Game
+	err := g.store.QueryRow(
+		"SELECT id, name from game WHERE id = ?",
+		id,
+	).Scan(&game.ID, &game.Name)
+	if err != nil {
+		return Game{}, err
+	}
+	return game, nil
+}
+
+func (g *sqlGames) All(p *pagination.P) ([]Game, error) {
+	games := make([]Game, 0)
+	rows, err := g.store.Query(
+		pagination.MakeQuery("SELECT id, name from game ORDER BY id", p))
+	if err != nil {
+		return games, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var game Game
+		err = rows.Scan(&game.ID, &game.Name)
+		if err != nil {
+			return games, err
+		}
+		games = append(games, game)
+	}
+	return games, rows.Err()
+}
+
+func (g *sqlGames) Insert(game *Game) error {
+	return g.store.QueryRow(
+		"INSERT INTO game (name) VALUES (?) RETURNING id", game.Name).Scan(&game.ID)
+}
+
+func (g *sqlGames) Update(game Game) error {
+	return affected(g.store.Exec("UPDATE game SET name = ? WHERE id = ?", game.Name, game.ID))
+}
+
+type sqlSessions struct {
+	store *db.Datastore
+}
+
+func (s *sqlSessions) ByPK(id db.ID) (Session, error) {
+	var ss Session
+	var sResult *string
+	err := s.store.QueryRow(
+		"SELECT id, result, started, ended, version FROM session WHERE id = ?",
+		id,
+	).Scan(&ss.ID, &sResult, &ss.Started, &ss.Ended, &ss.Version)
+	if err != nil {
+		return ss, err
+	}
+	if sResult != nil {
+		ss.Result = result.FromString(*sResult)
+	}
+	return ss, nil
+}
+
+func (s *sqlSessions) WithGames(id db.ID) (SessionWithGames, error) {
+	return s.withGames("WHERE s.id = ?", id)
+}
+
+func (s *sqlSessions) Active() (SessionWithGames, error) {
+	return s.withGames("WHERE s.ended IS NULL")
+}
+
+func (s *sqlSessions) withGames(where string, args ...any) (SessionWithGames, error) {
+	var ss SessionWithGames
+	var sResult *string
+	err := s.store.QueryRow(withSessions(s.store.Dialect, where), args...).Scan(
+		&ss.ID, &sResult, &ss.Started, &ss.Ended, &ss.Version, &ss.GameSessions, &ss.Users)
+	if err != nil {
+		return ss, err
+	}
+	if sResult != nil {
+		ss.Result = result.FromString(*sResult)
+	}
+	return ss, nil
+}
+
+func (s *sqlSessions) Ended() ([]Session, error) {
+	return s.all(
+		"SELECT id, result, started, ended, version FROM session WHERE ended IS NOT NULL ORDER BY id")
+}
+
+func (s *sqlSessions) Find(spec query.Spec) ([]Session, error) {
+	q, args := spec.In(s.store.Dialect).Select("SELECT s.id, s.result, s.started, s.ended, s.version FROM session s")
+	ss, err := s.all(q, args...)
+	return query.Ordered(spec, ss), err
+}
+
+func (s *sqlSessions) FindWithGames(spec query.Spec) ([]SessionWithGames, error) {
+	ss := make([]SessionWithGames, 0)
+	q, args := spec.In(s.store.Dialect).Select(withSessions(s.store.Dialect, ""))
+	rows, err := s.store.Query(q, args...)
+	if err != nil {
+		return ss, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ses SessionWithGames
+		var sResult *string
+		err = rows.Scan(
+			&ses.ID, &sResult, &ses.Started, &ses.Ended, &ses.Version, &ses.GameSessions, &ses.Users)
+		if err != nil {
+			return ss, err
+		}
+		if sResult != nil {
+			ses.Result = result.FromString(*sResult)
+		}
+		ss = append(ss, ses)
+	}
+	return query.Ordered(spec, ss), rows.Err()
+}
+
+func (s *sqlSessions) Count(spec query.Spec) (int, error) {
+	var count int
+	q, args := spec.Count("SELECT COUNT(*) FROM session s")
+	err := s.store.QueryRow(q, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *sqlSessions) all(q string, args ...any) ([]Session, error) {
+	ss := make([]Session, 0)
+	rows, err := s.store.Query(q, args...)
+	if err != nil {
+		return ss, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ses Session
+		var sResult *string
+		err = rows.Scan(&ses.ID, &sResult, &ses.Started, &ses.Ended, &ses.Version)
+		if err != nil {
+			return ss, err
+		}
+		if sResult != nil {
+			ses.Result = result.FromString(*sResult)
+		}
+		ss = append(ss, ses)
+	}
+	return ss, rows.Err()
+}
+
+func (s *sqlSessions) Participants(sessionID db.ID, pg *pagination.P) ([]Participant, error) {
+	pts := make([]Participant, 0)
+	rows, err := s.store.Query(
+		pagination.MakeQuery(
+			"SELECT id, user_id, session_id FROM session_participant WHERE session_id = ?",
+			pg),
+		sessionID)
+	if err != nil {
+		return pts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pt Participant
+		err = rows.Scan(&pt.ID, &pt.UserID, &pt.SessionID)
+		if err != nil {
+			return pts, err
+		}
+		pts = append(pts, pt)
+	}
+	return pts, rows.Err()
+}
+
+func (s *sqlSessions) CountByUser(userID db.ID) (int, error) {
+	var count int
+	err := s.store.QueryRow(
+		"SELECT COUNT(*) FROM session_participant WHERE user_id = ?",
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *sqlSessions) Insert(ss *SessionWithGames) error {
+	tx, err := s.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id db.ID
+	err = tx.QueryRow(
+		"INSERT INTO session (started, result) VALUES (?, ?) RETURNING id",
+		FormatTime(ss.Started), ss.Result.String()).Scan(&id)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(
+		"INSERT INTO session_participant (session_id, user_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, userID := range ss.Users {
+		if _, err = stmt.Exec(id, userID); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	ss.ID = id
+	return nil
+}
+
+func (s *sqlSessions) Update(ss *Session) error {
+	var sResult string
+	err := s.store.QueryRow(
+		"UPDATE session SET ended = ?, version = version + 1 WHERE id = ? AND version = ? RETURNING result",
+		formatEnded(ss.Ended), ss.ID, ss.Version).Scan(&sResult)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errvar.ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+	ss.Result = result.FromString(sResult)
+	ss.Version++
+	return nil
+}
+
+func (s *sqlSessions) UpdateResult(ss *Session) error {
+	return swapped(s.store.Exec(
+		"UPDATE session SET result = ? WHERE id = ? AND version = ?",
+		ss.Result.String(), ss.ID, ss.Version))
+}
+
+func (s *sqlSessions) Delete(ss Session) error {
+	return swapped(s.store.Exec(
+		"DELETE FROM session WHERE id = ? AND version = ?", ss.ID, ss.Version))
+}
+
+type sqlGameSessions struct {
+	store *db.Datastore
+}
+
+func (g *sqlGameSessions) ByPK(id db.ID) (GameSession, error) {
+	return g.one("WHERE id = ?", id)
+}
+
+func (g *sqlGameSessions) Active(sessionID db.ID) (GameSession, error) {
+	return g.one("WHERE session_id = ? AND ended IS NULL", sessionID)
+}
+
+func (g *sqlGameSessions) one(where string, args ...any) (GameSession, error) {
+	var gs GameSession
+	var sResult string
+	err := g.store.QueryRow(withRounds(g.store.Dialect, where), args...).Scan(
+		&gs.ID, &gs.SessionID, &gs.GameID, &sResult,
+		&gs.Started, &gs.Ended, &gs.Version, &gs.Rounds)
+	if err != nil {
+		return gs, err
+	}
+	gs.Result = result.FromString(sResult)
+	return gs, nil
+}
+
+func (g *sqlGameSessions) Find(spec query.Spec) ([]GameSession, error) {
+	q, args := spec.In(g.store.Dialect).Select(withRounds(g.store.Dialect, ""))
+	gs, err := g.all(q, args...)
+	return query.Ordered(spec, gs), err
+}
+
+func (g *sqlGameSessions) Count(spec query.Spec) (int, error) {
+	var count int
+	q, args := spec.Count("SELECT COUNT(*) FROM game_session s")
+	err := g.store.QueryRow(q, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (g *sqlGameSessions) FromGame(gameID db.ID, p *pagination.P) ([]GameSession, error) {
+	return g.all(pagination.MakeQuery(
+		withRounds(g.store.Dialect, "WHERE game_id = ? ORDER BY started DESC, id DESC"), p), gameID)
+}
+
+func (g *sqlGameSessions) all(q string, args ...any) ([]GameSession, error) {
+	sessions := make([]GameSession, 0)
+	rows, err := g.store.Query(q, args...)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s GameSession
+		var sResult string
+		err = rows.Scan(
+			&s.ID, &s.SessionID, &s.GameID,
+			&sResult, &s.Started, &s.Ended, &s.Version, &s.Rounds)
+		if err != nil {
+			return sessions, err
+		}
+		s.Result = result.FromString(sResult)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (g *sqlGameSessions) Insert(gs *GameSession) error {
+	return g.store.QueryRow(`INSERT
+INTO game_session (session_id, game_id, started, result)
+    VALUES (?, ?, ?, ?)
+RETURNING id`,
+		gs.SessionID,
+		gs.GameID,
+		FormatTime(gs.Started),
+		gs.Result.String()).Scan(&gs.ID)
+}
+
+func (g *sqlGameSessions) Update(gs *GameSession) error {
+	err := swapped(g.store.Exec(`UPDATE game_session
+SET result = ?, ended = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		gs.Result.String(), formatEnded(gs.Ended), gs.ID, gs.Version))
+	if err != nil {
+		return err
+	}
+	gs.Version++
+	return nil
+}
+
+func (g *sqlGameSessions) NewRound(gs *GameSession, gr *GameSessionRound) error {
+	tx, err := g.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = swapped(tx.Exec(`UPDATE game_session
+SET version = version + 1 WHERE id = ? AND version = ?`, gs.ID, gs.Version))
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`INSERT
+INTO game_session_round (game_session_id, result, wager, round, active)
+    VALUES (?, ?, ?, ?, ?)
+RETURNING id`,
+		gr.GameSessionID,
+		gr.Result.String(),
+		gr.Wager, gr.Round, gr.Active).Scan(&gr.ID)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	gs.Version++
+	return nil
+}
+
+func (g *sqlGameSessions) EndRound(gs *GameSession, gr *GameSessionRound) error {
+	tx, err := g.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = swapped(tx.Exec(`UPDATE game_session
+SET result = ?, ended = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		gs.Result.String(), formatEnded(gs.Ended), gs.ID, gs.Version))
+	if err != nil {
+		return err
+	}
+	err = swapped(tx.Exec(`UPDATE game_session_round
+SET result = ?, active = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		gr.Result.String(), gr.Active, gr.ID, gr.Version))
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	gs.Version++
+	gr.Version++
+	return nil
+}
+
+func (g *sqlGameSessions) Delete(gs GameSession) error {
+	return swapped(g.store.Exec(
+		"DELETE FROM game_session WHERE id = ? AND version = ?", gs.ID, gs.Version))
+}
+
+type sqlRounds struct {
+	store *db.Datastore
+}
+
+func (g *sqlRounds) FromGameSession(id db.ID) ([]GameSessionRound, error) {
+	rounds := make([]GameSessionRound, 0)
+	rows, err := g.store.Query(`SELECT id, game_session_id, result, round, wager, active, version
+FROM game_session_round WHERE game_session_id = ? ORDER BY round DESC`, id)
+	if err != nil {
+		return rounds, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gr GameSessionRound
+		var sResult string
+		err = rows.Scan(&gr.ID, &gr.GameSessionID, &sResult, &gr.Round, &gr.Wager, &gr.Active, &gr.Version)
+		if err != nil {
+			return rounds, err
+		}
+		gr.Result = result.FromString(sResult)
+		rounds = append(rounds, gr)
+	}
+	return rounds, rows.Err()
+}
+
+func (g *sqlRounds) Active(gameSessionID db.ID) (GameSessionRound, error) {
+	var gr GameSessionRound
+	var sResult string
+	err := g.store.QueryRow(`SELECT id, game_session_id, result, round, wager, active, version
+FROM game_session_round WHERE game_session_id = ? AND active = 1`, gameSessionID).Scan(
+		&gr.ID, &gr.GameSessionID, &sResult, &gr.Round, &gr.Wager, &gr.Active, &gr.Version)
+	if err != nil {
+		return gr, err
+	}
+	gr.Result = result.FromString(sResult)
+	return gr, nil
+}
+
+func (g *sqlRounds) Insert(gr *GameSessionRound) error {
+	return g.store.QueryRow(`INSERT
+INTO game_session_round (game_session_id, result, wager, round, active)
+    VALUES (?, ?, ?, ?, ?)
+RETURNING id`,
+		gr.GameSessionID,
+		gr.Result.String(),
+		gr.Wager, gr.Round, gr.Active).Scan(&gr.ID)
+}
+
+func (g *sqlRounds) Update(gr *GameSessionRound) error {
+	err := swapped(g.store.Exec(`UPDATE game_session_round
+SET result = ?, active = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		gr.Result.String(), gr.Active, gr.ID, gr.Version))
+	if err != nil {
+		return err
+	}
+	gr.Version++
+	return nil
+}
+
+func (g *sqlRounds) Delete(gr GameSessionRound) error {
+	return swapped(g.store.Exec(
+		"DELETE FROM game_session_round WHERE id = ? AND version = ?", gr.ID, gr.Version))
+}
+
+type sqlLedger struct {
+	store *db.Datastore
+}
+
+func (l *sqlLedger) Load() (result.ResultMap, error) {
+	var sResult *string
+	err := l.store.QueryRow("SELECT data FROM result WHERE id = 1").Scan(&sResult)
+	if err != nil {
+		return result.ResultMap{}, err
+	}
+	if sResult == nil {
+		return result.ResultMap{}, errors.New("failed to parse result.data")
+	}
+	return result.FromString(*sResult), nil
+}
+
+func (l *sqlLedger) Save(rm result.ResultMap) error {
+	r, err := l.store.Exec("UPDATE result SET data = ? WHERE id = 1", rm.String())
+	if err = affected(r, err); err != sql.ErrNoRows {
+		return err
+	}
+	_, err = l.store.Exec("INSERT INTO result (id, data) VALUES (1, ?)", rm.String())
+	return err
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+// Repositories persist the aggregates the services change. Missing rows
+// are sql.ErrNoRows, names taken are db.ErrUnique and changes to a row
+// changed since it was read are errvar.ErrVersionConflict.
+type Repositories struct {
+	Users        UserRepository
+	Games        GameRepository
+	Sessions     SessionRepository
+	GameSessions GameSessionRepository
+	Rounds       RoundRepository
+	Ledger       LedgerRepository
+}
+
+type UserRepository interface {
+	ByPK(id db.ID) (UserWithPassword, error)
+	ByName(name string) (UserWithPassword, error)
+	// All is ordered by id.
+	All(p *pagination.P) ([]User, error)
+	// BySession are the participants of a session ordered by id.
+	BySession(sessionID db.ID) ([]User, error)
+	Find(spec query.Spec) ([]User, error)
+	Count(spec query.Spec) (int, error)
+	Insert(u *UserWithPassword) error
+	Update(u UserWithPassword) error
+}
+
+type GameRepository interface {
+	ByPK(id db.ID) (Game, error)
+	// All is ordered by id.
+	All(p *pagination.P) ([]Game, error)
+	Insert(g *Game) error
+	Update(g Game) error
+}
+
+type SessionRepository interface {
+	ByPK(id db.ID) (Session, error)
+	WithGames(id db.ID) (SessionWithGames, error)
+	Active() (SessionWithGames, error)
+	// Ended is ordered by id.
+	Ended() ([]Session, error)
+	Find(spec query.Spec) ([]Session, error)
+	FindWithGames(spec query.Spec) ([]SessionWithGames, error)
+	Count(spec query.Spec) (int, error)
+	Participants(sessionID db.ID, p *pagination.P) ([]Participant, error)
+	// CountByUser is the number of sessions a user took part in.
+	CountByUser(userID db.ID) (int, error)
+
+	// Insert adds s with its users as participants.
+	Insert(s *SessionWithGames) error
+	// Update writes the end of s, increments its version and reads back
+	// its result, as ending game sessions change it concurrently.
+	Update(s *Session) error
+	// UpdateResult writes the result of s unless s changed since it was
+	// read. It keeps the version, a result changes as game sessions end
+	// and not by a request to the session.
+	UpdateResult(s *Session) error
+	// Delete removes s with its participants and game sessions.
+	Delete(s Session) error
+}
+
+type GameSessionRepository interface {
+	// ByPK and Active have the rounds of the game session, latest first.
+	ByPK(id db.ID) (GameSession, error)
+	Active(sessionID db.ID) (GameSession, error)
+	Find(spec query.Spec) ([]GameSession, error)
+	Count(spec query.Spec) (int, error)
+	// FromGame is ordered by start, latest first.
+	FromGame(gameID db.ID, p *pagination.P) ([]GameSession, error)
+
+	Insert(gs *GameSession) error
+	// Update writes the result and end of gs and increments its version.
+	Update(gs *GameSession) error
+	// NewRound increments the version of gs and inserts its round gr
+	// together, or neither of them.
+	NewRound(gs *GameSession, gr *GameSessionRound) error
+	// EndRound updates gs and its round gr together, or neither of them.
+	EndRound(gs *GameSession, gr *GameSessionRound) error
+	// Delete removes gs with its rounds.
+	Delete(gs GameSession) error
+}
+
+type RoundRepository interface {
+	// FromGameSession is ordered by round, latest first.
+	FromGameSession(gameSessionID db.ID) ([]GameSessionRound, error)
+	Active(gameSessionID db.ID) (GameSessionRound, error)
+
+	Insert(gr *GameSessionRound) error
+	// Update writes the result and state of gr and increments its version.
+	Update(gr *GameSessionRound) error
+	Delete(gr GameSessionRound) error
+}
+
+// LedgerRepository keeps what every user owes every other user
+// across all ended sessions.
+type LedgerRepository interface {
+	Load() (result.ResultMap, error)
+	Save(rm result.ResultMap) error
+}
@@ -2,9 +2,7 @@ package services
 
 import (
 	"database/sql"
-	"errors"
 
-	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/result"
 )
 
@@ -12,11 +10,14 @@ type ResultService interface {
 	Current() (result.ResultMap, error)
 	Update(rm result.ResultMap) error
 	UpdateUsers() error
+	// Recompute rebuilds the ledger from the results of the ended sessions.
+	Recompute() (result.ResultMap, error)
 }
 
 type rService struct {
-	store *db.Datastore
-	u     UserService
+	repo LedgerRepository
+	s    SessionRepository
+	u    UserService
 }
 
 func (r *rService) create() (result.ResultMap, error) {
@@ -25,27 +26,15 @@ func (r *rService) create() (result.ResultMap, error) {
 		return result.ResultMap{}, err
 	}
 	rm := result.New(u)
-	_, err = r.store.DB.Exec("INSERT INTO result (data) VALUES (?)",
-		rm.String())
-	if err != nil {
-		return rm, err
-	}
-	return rm, nil
+	return rm, r.repo.Save(rm)
 }
 
 func (r *rService) Current() (result.ResultMap, error) {
-	var sResult *string
-	err := r.store.DB.QueryRow("SELECT data FROM result WHERE id = 1").Scan(&sResult)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return r.create()
-		}
-		return result.ResultMap{}, err
+	rm, err := r.repo.Load()
+	if err == sql.ErrNoRows {
+		return r.create()
 	}
-	if sResult == nil {
-		return result.ResultMap{}, errors.New("failed to parse result.data")
-	}
-	return result.FromString(*sResult), nil
+	return rm, err
 }
 
 func (r *rService) Update(rm result.ResultMap) error {
@@ -59,8 +48,7 @@ func (r *rService) Update(rm result.ResultMap) error {
 	}
 	rmn := result.Merge(u, c, rm)
 	rmn.Resolve()
-	_, err = r.store.DB.Exec("UPDATE result SET data = ? WHERE id = 1", rmn.String())
-	return nil
+	return r.repo.Save(rmn)
 }
 
 func (r *rService) UpdateUsers() error {
@@ -72,14 +60,23 @@ func (r *rService) UpdateUsers() error {
 	if err != nil {
 		return err
 	}
-	_, err = r.store.DB.Exec("UPDATE result SET data = ? WHERE id = 1",
-		result.Merge(u, c).String())
+	return r.repo.Save(result.Merge(u, c))
+}
+
+func (r *rService) Recompute() (result.ResultMap, error) {
+	u, err := r.u.All(nil)
 	if err != nil {
-		return err
+		return result.ResultMap{}, err
+	}
+	ended, err := r.s.Ended()
+	if err != nil {
+		return result.ResultMap{}, err
 	}
-	return nil
+	rm := result.Merge(u, ended...)
+	rm.Resolve()
+	return rm, r.repo.Save(rm)
 }
 
-func NewResultService(s *db.Datastore, u UserService) ResultService {
-	return &rService{s, u}
+func NewResultService(repo LedgerRepository, s SessionRepository, u UserService) ResultService {
+	return &rService{repo, s, u}
 }
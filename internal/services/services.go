@@ -2,6 +2,8 @@ package services
 
 import (
 	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/hub"
+	"github.com/lindeneg/wager/internal/webhook"
 )
 
 type Services struct {
@@ -10,21 +12,46 @@ type Services struct {
 	Game        GameService
 	Participant ParticipantService
 	GSession    GameSessionService
+	GSessionHub *GameSessionHub
 	Session     SessionService
+	Event       EventService
+	TOTP        TOTPService
+	History     HistoryService
+	Rating      RatingService
+	Webhook     WebhookService
+	Idempotency IdempotencyService
+	Archive     ArchiveService
+	Dispatcher  *webhook.Dispatcher
 }
 
 func InitServices(store *db.Datastore) *Services {
-	u := NewUserService(store)
-	rs := NewResultService(store, u)
-	pt := NewParticipantService(store)
-	r := NewGameSessionRoundService(store)
-	s := NewSessionService(store, u, rs)
+	repos := NewSQLRepositories(store)
+	u := NewUserService(repos.Users)
+	g := NewGameService(repos.Games)
+	rs := NewResultService(repos.Ledger, repos.Sessions, u)
+	pt := NewParticipantService(repos.Sessions)
+	r := NewGameSessionRoundService(repos.Rounds)
+	wh := NewWebhookService(store)
+	d := webhook.New(wh)
+	s := NewSessionService(repos.Sessions, u, rs, d)
+	h := NewHistoryService(store)
+	rt := NewRatingService(store, h)
+	gh := hub.New[db.ID, GameSessionEvent]()
 	return &Services{
 		User:        u,
 		Result:      rs,
-		Game:        NewGameService(store),
+		Game:        g,
 		Participant: pt,
-		GSession:    NewGameSessionService(store, s, r, pt),
+		GSession:    NewGameSessionService(repos.GameSessions, s, r, pt, rt, gh, d),
+		GSessionHub: gh,
 		Session:     s,
+		Event:       NewEventService(store),
+		TOTP:        NewTOTPService(store),
+		History:     h,
+		Rating:      rt,
+		Webhook:     wh,
+		Idempotency: NewIdempotencyService(store),
+		Archive:     NewArchiveService(store, u, g, rs, rt, h),
+		Dispatcher:  d,
 	}
 }
@@ -0,0 +1,830 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+	"github.com/lindeneg/wager/internal/hub"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/webhook"
+)
+
+type recordedRating struct {
+	gameID  db.ID
+	roundID db.ID
+	winner  db.ID
+}
+
+type fakeRatings struct {
+	RatingService
+	recorded []recordedRating
+	err      error
+}
+
+func (f *fakeRatings) Record(gameID db.ID, roundID db.ID, r result.ResultMap) error {
+	if f.err != nil {
+		return f.err
+	}
+	winner, _ := r.Winner()
+	f.recorded = append(f.recorded, recordedRating{gameID, roundID, winner})
+	return nil
+}
+
+type fixture struct {
+	repos Repositories
+	u     UserService
+	rs    ResultService
+	s     SessionService
+	gs    GameSessionService
+	rt    *fakeRatings
+	game  Game
+	users []db.ID
+}
+
+// newFixture has two users, a game and an active session of both users.
+func newFixture(t *testing.T) (*fixture, SessionWithGames) {
+	t.Helper()
+	return newFixtureOf(t, NewMemoryRepositories())
+}
+
+// newSQLFixture is newFixture on the repositories of a new SQLite database.
+func newSQLFixture(t *testing.T) (*fixture, SessionWithGames) {
+	t.Helper()
+	return newFixtureOf(t, NewSQLRepositories(newStore(t)))
+}
+
+func newStore(t *testing.T) *db.Datastore {
+	t.Helper()
+	store, err := db.Open(filepath.Join(t.TempDir(), "wager.db"))
+	assertNoError(t, err)
+	t.Cleanup(func() { store.DB.Close() })
+	store.Dir = filepath.Join("..", "..", "sql")
+	assertNoError(t, store.Migrate())
+	return store
+}
+
+// newPostgresFixture is newFixture on the emptied database of
+// WAGER_TEST_POSTGRES, tests using it are skipped unless it is set.
+func newPostgresFixture(t *testing.T) (*fixture, SessionWithGames) {
+	t.Helper()
+	conn := os.Getenv("WAGER_TEST_POSTGRES")
+	if conn == "" {
+		t.Skip("WAGER_TEST_POSTGRES is not set")
+	}
+	store, err := db.Open(conn)
+	assertNoError(t, err)
+	t.Cleanup(func() { store.DB.Close() })
+	store.Dir = filepath.Join("..", "..", "sql")
+	assertNoError(t, store.RunFile("drop"))
+	assertNoError(t, store.Migrate())
+	return newFixtureOf(t, NewSQLRepositories(store))
+}
+
+func newFixtureOf(t *testing.T, repos Repositories) (*fixture, SessionWithGames) {
+	t.Helper()
+	d := webhook.New(nil)
+	f := &fixture{repos: repos, rt: &fakeRatings{}}
+	f.u = NewUserService(repos.Users)
+	f.rs = NewResultService(repos.Ledger, repos.Sessions, f.u)
+	f.s = NewSessionService(repos.Sessions, f.u, f.rs, d)
+	f.gs = NewGameSessionService(
+		repos.GameSessions, f.s,
+		NewGameSessionRoundService(repos.Rounds),
+		NewParticipantService(repos.Sessions),
+		f.rt, hub.New[db.ID, GameSessionEvent](), d)
+	for _, name := range []string{"miles", "bill"} {
+		usr, err := f.u.Create(name, "hash")
+		assertNoError(t, err)
+		f.users = append(f.users, usr.ID)
+	}
+	f.game = Game{Name: "Golf"}
+	assertNoError(t, repos.Games.Insert(&f.game))
+	ss, err := f.s.Create(f.users)
+	assertNoError(t, err)
+	return f, ss
+}
+
+func TestGameSessionRounds(t *testing.T) {
+	t.Run("starts with an active round", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		assertInt(t, len(gs.Rounds), 1)
+		assertInt(t, gs.Rounds[0].Active, 1)
+		assertInt(t, gs.Rounds[0].Wager, 100)
+		if !f.gs.HasActive(ss.ID) {
+			t.Error("got no active game session")
+		}
+	})
+
+	t.Run("ends the active round with a participant as winner", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, 99, AnyVersion)
+		assertError(t, err, errvar.ErrWinnerIsNotParticipant)
+		gs, err = f.gs.EndRound(gs.ID, f.users[0], gs.Version)
+		assertNoError(t, err)
+		assertInt(t, gs.Rounds[0].Active, 0)
+		assertInt(t, gs.Result.Net(f.users[0]), 100)
+		assertInt(t, gs.Version, 2)
+		assertInt(t, len(f.rt.recorded), 1)
+		if got := f.rt.recorded[0]; got != (recordedRating{f.game.ID, gs.Rounds[0].ID, f.users[0]}) {
+			t.Errorf("got rating %+v", got)
+		}
+		_, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+		assertError(t, err, errvar.ErrGameSessionNoActive)
+	})
+
+	t.Run("ends the round when rating it fails", func(t *testing.T) {
+		f, ss := newFixture(t)
+		f.rt.err = errors.New("rating failed")
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		gs, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+		assertNoError(t, err)
+		assertInt(t, gs.Rounds[0].Active, 0)
+		gs, err = f.gs.ByPK(gs.ID)
+		assertNoError(t, err)
+		assertInt(t, gs.Rounds[0].Active, 0)
+	})
+
+	t.Run("starts rounds after the last one ended", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.NewRound(gs.ID, 50, AnyVersion)
+		assertError(t, err, errvar.ErrGameSessionActive)
+		_, err = f.gs.EndRound(gs.ID, f.users[1], AnyVersion)
+		assertNoError(t, err)
+		gs, err = f.gs.NewRound(gs.ID, 50, AnyVersion)
+		assertNoError(t, err)
+		assertInt(t, len(gs.Rounds), 2)
+		assertInt(t, gs.Rounds[0].Round, 2)
+		assertInt(t, gs.Rounds[0].Active, 1)
+		gs, err = f.gs.ByPK(gs.ID)
+		assertNoError(t, err)
+		assertInt(t, gs.Rounds[0].Round, 2)
+	})
+
+	t.Run("drops the active round", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		gs, err = f.gs.DropRound(gs.ID, AnyVersion)
+		assertNoError(t, err)
+		assertInt(t, len(gs.Rounds), 0)
+		_, err = f.gs.DropRound(gs.ID, AnyVersion)
+		assertError(t, err, errvar.ErrGameSessionNoActive)
+	})
+
+	t.Run("ends the round and the game session together", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, ss := newFixture(t)
+				gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+				assertNoError(t, err)
+				// The round changes between reading and ending it.
+				round := gs.Rounds[0]
+				changed := round
+				assertNoError(t, f.repos.Rounds.Update(&changed))
+				stale := gs
+				stale.Result = result.New([]User{{ID: f.users[0]}, {ID: f.users[1]}})
+				stale.Result.AddWinner(f.users[0], 100)
+				round.Active = 0
+				err = f.repos.GameSessions.EndRound(&stale, &round)
+				assertError(t, err, errvar.ErrVersionConflict)
+				gs, err = f.gs.ByPK(gs.ID)
+				assertNoError(t, err)
+				assertInt(t, gs.Version, 1)
+				assertInt(t, gs.Result.Net(f.users[0]), 0)
+				assertInt(t, gs.Rounds[0].Active, 1)
+				gs, err = f.gs.EndRound(gs.ID, f.users[0], gs.Version)
+				assertNoError(t, err)
+				assertInt(t, gs.Version, 2)
+				assertInt(t, gs.Rounds[0].Version, changed.Version+1)
+				gs, err = f.gs.ByPK(gs.ID)
+				assertNoError(t, err)
+				assertInt(t, gs.Result.Net(f.users[0]), 100)
+				assertInt(t, gs.Rounds[0].Active, 0)
+			})
+		}
+	})
+
+	t.Run("starts the round and changes the game session together", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, ss := newFixture(t)
+				gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+				assertNoError(t, err)
+				gs, err = f.gs.EndRound(gs.ID, f.users[0], gs.Version)
+				assertNoError(t, err)
+				// The game session changes between reading it and starting the round.
+				stale := gs
+				changed := gs
+				assertNoError(t, f.repos.GameSessions.Update(&changed))
+				round := newRound(gs.ID, 50, nil, 2)
+				err = f.repos.GameSessions.NewRound(&stale, &round)
+				assertError(t, err, errvar.ErrVersionConflict)
+				gs, err = f.gs.ByPK(gs.ID)
+				assertNoError(t, err)
+				assertInt(t, gs.Version, changed.Version)
+				assertInt(t, len(gs.Rounds), 1)
+				gs, err = f.gs.NewRound(gs.ID, 50, gs.Version)
+				assertNoError(t, err)
+				assertInt(t, gs.Version, changed.Version+1)
+				gs, err = f.gs.ByPK(gs.ID)
+				assertNoError(t, err)
+				assertInt(t, gs.Version, changed.Version+1)
+				assertInt(t, len(gs.Rounds), 2)
+				assertInt(t, gs.Rounds[0].Active, 1)
+			})
+		}
+	})
+
+	t.Run("refuses stale versions", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[0], gs.Version)
+		assertNoError(t, err)
+		_, err = f.gs.NewRound(gs.ID, 50, gs.Version)
+		assertError(t, err, errvar.ErrPreconditionFailed)
+	})
+}
+
+func TestGameSessionEnd(t *testing.T) {
+	t.Run("refuses to end with an active round", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertError(t, err, errvar.ErrGameSessionActive)
+	})
+
+	t.Run("adds the result to the session", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[1], AnyVersion)
+		assertNoError(t, err)
+		gs, err = f.gs.End(gs.ID, AnyVersion)
+		assertNoError(t, err)
+		if gs.Ended == nil {
+			t.Error("got no end")
+		}
+		if f.gs.HasActive(ss.ID) {
+			t.Error("got active game session")
+		}
+		s, err := f.s.ByPK(ss.ID)
+		assertNoError(t, err)
+		assertInt(t, s.Result.Net(f.users[1]), 100)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertError(t, err, errvar.ErrGameSessionEnded)
+	})
+}
+
+func TestGameSessionCancel(t *testing.T) {
+	t.Run("deletes a game session with one round", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		assertNoError(t, f.gs.Cancel(gs.ID, gs.Version))
+		_, err = f.gs.ByPK(gs.ID)
+		assertError(t, err, sql.ErrNoRows)
+		rounds, err := f.repos.Rounds.FromGameSession(gs.ID)
+		assertNoError(t, err)
+		assertInt(t, len(rounds), 0)
+	})
+
+	t.Run("refuses once a wager is resolved", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+		assertNoError(t, err)
+		_, err = f.gs.NewRound(gs.ID, 50, AnyVersion)
+		assertNoError(t, err)
+		assertError(t, f.gs.Cancel(gs.ID, AnyVersion), errvar.ErrGameSessionWager)
+	})
+}
+
+func TestSession(t *testing.T) {
+	t.Run("ending adds the result to the ledger", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+		assertNoError(t, err)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertNoError(t, err)
+		ended, err := f.s.End(ss.ID, AnyVersion)
+		assertNoError(t, err)
+		assertInt(t, len(ended.GameSessions), 1)
+		rm, err := f.rs.Current()
+		assertNoError(t, err)
+		assertInt(t, rm.Net(f.users[0]), 100)
+		_, err = f.s.End(ss.ID, AnyVersion)
+		assertError(t, err, errvar.ErrSessionEnded)
+		assertError(t, f.s.Cancel(ss.ID, AnyVersion), errvar.ErrSessionEnded)
+	})
+
+	t.Run("keeps the version as game sessions end", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, ss := newFixture(t)
+				// The session is read before its game session ends.
+				stale, err := f.repos.Sessions.ByPK(ss.ID)
+				assertNoError(t, err)
+				gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+				assertNoError(t, err)
+				_, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+				assertNoError(t, err)
+				_, err = f.gs.End(gs.ID, AnyVersion)
+				assertNoError(t, err)
+				current, err := f.s.ByPK(ss.ID)
+				assertNoError(t, err)
+				assertInt(t, current.Version, ss.Version)
+				stale.Ended = GetPtr(NewTime())
+				assertNoError(t, f.repos.Sessions.Update(&stale))
+				assertInt(t, stale.Version, ss.Version+1)
+				assertInt(t, stale.Result.Net(f.users[0]), 100)
+				current, err = f.s.ByPK(ss.ID)
+				assertNoError(t, err)
+				assertInt(t, current.Result.Net(f.users[0]), 100)
+				current.Result = result.New([]User{{ID: f.users[0]}, {ID: f.users[1]}})
+				current.Version = ss.Version
+				assertError(t, f.repos.Sessions.UpdateResult(&current), errvar.ErrVersionConflict)
+			})
+		}
+	})
+
+	t.Run("ends with the version read before game sessions ended", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[0], AnyVersion)
+		assertNoError(t, err)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertNoError(t, err)
+		ended, err := f.s.End(ss.ID, ss.Version)
+		assertNoError(t, err)
+		assertInt(t, ended.Result.Net(f.users[0]), 100)
+	})
+
+	t.Run("cancelling deletes the game sessions", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		assertNoError(t, f.s.Cancel(ss.ID, AnyVersion))
+		if f.s.HasActive() {
+			t.Error("got active session")
+		}
+		_, err = f.gs.ByPK(gs.ID)
+		assertError(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("recomputes the ledger from ended sessions", func(t *testing.T) {
+		f, ss := newFixture(t)
+		gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+		assertNoError(t, err)
+		_, err = f.gs.EndRound(gs.ID, f.users[1], AnyVersion)
+		assertNoError(t, err)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertNoError(t, err)
+		_, err = f.s.End(ss.ID, AnyVersion)
+		assertNoError(t, err)
+		assertNoError(t, f.repos.Ledger.Save(result.New([]User{})))
+		rm, err := f.rs.Recompute()
+		assertNoError(t, err)
+		assertInt(t, rm.Net(f.users[1]), 100)
+		assertInt(t, rm.Net(f.users[0]), -100)
+	})
+}
+
+func TestUser(t *testing.T) {
+	t.Run("deactivating keeps the first time", func(t *testing.T) {
+		f, _ := newFixture(t)
+		assertNoError(t, f.u.Deactivate(f.users[0]))
+		first, err := f.u.ByPK(f.users[0])
+		assertNoError(t, err)
+		assertNoError(t, f.u.Deactivate(f.users[0]))
+		again, err := f.u.ByPK(f.users[0])
+		assertNoError(t, err)
+		if first.Deactivated == nil || !first.Deactivated.Equal(*again.Deactivated) {
+			t.Errorf("got deactivated %v want %v", again.Deactivated, first.Deactivated)
+		}
+		assertNoError(t, f.u.Reactivate(f.users[0]))
+		usr, err := f.u.ByPK(f.users[0])
+		assertNoError(t, err)
+		if usr.Deactivated != nil {
+			t.Errorf("got deactivated %v", usr.Deactivated)
+		}
+	})
+
+	t.Run("refuses names taken", func(t *testing.T) {
+		f, _ := newFixture(t)
+		assertError(t, f.u.Rename(f.users[0], "bill"), db.ErrUnique)
+		_, err := f.u.Create("miles", "hash")
+		assertError(t, err, db.ErrUnique)
+		assertNoError(t, f.u.Rename(f.users[0], "miles"))
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	t.Run("uses every step and recovery code once", func(t *testing.T) {
+		store := newStore(t)
+		f, _ := newFixtureOf(t, NewSQLRepositories(store))
+		tp := NewTOTPService(store)
+		assertNoError(t, tp.SetSecret(f.users[0], "secret"))
+		assertNoError(t, tp.Enable(f.users[0], []string{"hash"}))
+		assertNoError(t, tp.UseStep(f.users[0], 5))
+		assertError(t, tp.UseStep(f.users[0], 5), errvar.ErrTOTPInvalid)
+		assertError(t, tp.UseStep(f.users[0], 4), errvar.ErrTOTPInvalid)
+		assertNoError(t, tp.UseStep(f.users[0], 6))
+		rcs, err := tp.RecoveryCodes(f.users[0])
+		assertNoError(t, err)
+		assertInt(t, len(rcs), 1)
+		assertNoError(t, tp.UseRecoveryCode(rcs[0].ID))
+		assertError(t, tp.UseRecoveryCode(rcs[0].ID), errvar.ErrTOTPInvalid)
+	})
+}
+
+func TestLists(t *testing.T) {
+	t.Run("lists without query specs", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, ss := newFixture(t)
+				gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+				assertNoError(t, err)
+				gss, err := f.gs.FromGame(f.game.ID, nil)
+				assertNoError(t, err)
+				assertInt(t, len(gss), 1)
+				assertInt(t, int(gss[0].ID), int(gs.ID))
+				assertInt(t, len(gss[0].Rounds), 1)
+				usrs, err := f.u.BySession(ss.ID)
+				assertNoError(t, err)
+				assertInt(t, len(usrs), 2)
+				assertInt(t, int(usrs[0].ID), int(f.users[0]))
+				count, err := NewParticipantService(f.repos.Sessions).CountByUser(f.users[1])
+				assertNoError(t, err)
+				assertInt(t, count, 1)
+			})
+		}
+	})
+
+	t.Run("lists by query spec", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, ss := newFixture(t)
+				gs, err := f.gs.Create(ss.ID, f.game.ID, 100)
+				assertNoError(t, err)
+				_, err = f.gs.EndRound(gs.ID, f.users[0], gs.Version)
+				assertNoError(t, err)
+				_, err = f.gs.End(gs.ID, AnyVersion)
+				assertNoError(t, err)
+				_, err = f.s.End(ss.ID, AnyVersion)
+				assertNoError(t, err)
+				duration, err := GameSessionQuery.Parse(url.Values{"sort": {"duration"}}, nil)
+				assertNoError(t, err)
+				gss, err := f.gs.FromSession(ss.ID, duration)
+				assertNoError(t, err)
+				assertInt(t, len(gss), 1)
+				assertInt(t, len(gss[0].Rounds), 1)
+				count, err := f.gs.CountFromSession(ss.ID, duration)
+				assertNoError(t, err)
+				assertInt(t, count, 1)
+				sss, err := f.s.AllWithSessions(SessionQuery.Default())
+				assertNoError(t, err)
+				assertInt(t, len(sss), 1)
+				assertInt(t, len(sss[0].GameSessions), 1)
+				assertInt(t, len(sss[0].Users), 2)
+				count, err = f.s.Count(SessionQuery.Default())
+				assertNoError(t, err)
+				assertInt(t, count, 1)
+				named, err := UserQuery.Parse(url.Values{"name": {"ILL"}}, nil)
+				assertNoError(t, err)
+				usrs, err := f.u.Find(named)
+				assertNoError(t, err)
+				assertInt(t, len(usrs), 1)
+				assertInt(t, int(usrs[0].ID), int(f.users[1]))
+			})
+		}
+	})
+
+	t.Run("pages by cursor past deleted and active rows", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, first := newFixture(t)
+				_, err := f.s.End(first.ID, AnyVersion)
+				assertNoError(t, err)
+				second, err := f.s.Create(f.users)
+				assertNoError(t, err)
+				second, err = f.s.End(second.ID, AnyVersion)
+				assertNoError(t, err)
+				active, err := f.s.Create(f.users)
+				assertNoError(t, err)
+				page := func(c *query.Cursor) []SessionWithGames {
+					t.Helper()
+					values := url.Values{"state": {"all"}}
+					if c != nil && c.Before {
+						values.Set("before", c.String())
+					} else if c != nil {
+						values.Set("after", c.String())
+					}
+					spec, err := SessionQuery.Parse(values, pagination.New(1, 0))
+					assertNoError(t, err)
+					ss, err := f.s.AllWithSessions(spec)
+					assertNoError(t, err)
+					return ss
+				}
+				spec := SessionQuery.Default()
+				value := SessionValues.For(spec)
+				ss := page(nil)
+				assertInt(t, len(ss), 1)
+				assertInt(t, int(ss[0].ID), int(second.ID))
+				next := spec.Next(int64(ss[0].ID), value(ss[0]))
+				assertNoError(t, f.repos.Sessions.Delete(second.Session))
+				ss = page(&next)
+				assertInt(t, len(ss), 1)
+				assertInt(t, int(ss[0].ID), int(first.ID))
+				next = spec.Next(int64(ss[0].ID), value(ss[0]))
+				ss = page(&next)
+				assertInt(t, len(ss), 1)
+				assertInt(t, int(ss[0].ID), int(active.ID))
+				next = spec.Next(int64(ss[0].ID), value(ss[0]))
+				assertInt(t, len(page(&next)), 0)
+				prev := spec.Prev(int64(ss[0].ID), value(ss[0]))
+				ss = page(&prev)
+				assertInt(t, len(ss), 1)
+				assertInt(t, int(ss[0].ID), int(first.ID))
+			})
+		}
+	})
+
+	t.Run("has the value of every sort", func(t *testing.T) {
+		assertValues(t, SessionQuery, SessionValues)
+		assertValues(t, GameSessionQuery, GameSessionValues)
+		assertValues(t, UserQuery, UserValues)
+	})
+
+	t.Run("memory repositories list like sql", func(t *testing.T) {
+		memory, err := listings(t, newFixture)
+		assertNoError(t, err)
+		sqlite, err := listings(t, newSQLFixture)
+		assertNoError(t, err)
+		for name, ids := range sqlite {
+			if fmt.Sprint(memory[name]) != fmt.Sprint(ids) {
+				t.Errorf("%s: got %v want %v", name, memory[name], ids)
+			}
+		}
+	})
+
+	t.Run("memory repositories refuse raw conditions", func(t *testing.T) {
+		f, _ := newFixture(t)
+		spec := UserQuery.Default()
+		spec.Where("u.id > ?", 1)
+		_, err := f.u.Find(spec)
+		assertError(t, err, errvar.ErrQuerySpec)
+		_, err = f.u.Count(spec)
+		assertError(t, err, errvar.ErrQuerySpec)
+	})
+}
+
+// listings are the ids and counts of lists of the users, sessions and game
+// sessions of a fixture with three sessions, by the query they were listed with.
+func listings(t *testing.T, newFixture func(*testing.T) (*fixture, SessionWithGames)) (map[string][]db.ID, error) {
+	t.Helper()
+	f, first := newFixture(t)
+	joe, err := f.u.Create("joe", "hash")
+	assertNoError(t, err)
+	chess := Game{Name: "Chess"}
+	assertNoError(t, f.repos.Games.Insert(&chess))
+	play := func(sessionID db.ID, gameID db.ID, wager int, winner db.ID, end bool) {
+		t.Helper()
+		gs, err := f.gs.Create(sessionID, gameID, wager)
+		assertNoError(t, err)
+		if !end {
+			return
+		}
+		_, err = f.gs.EndRound(gs.ID, winner, AnyVersion)
+		assertNoError(t, err)
+		_, err = f.gs.End(gs.ID, AnyVersion)
+		assertNoError(t, err)
+	}
+	play(first.ID, f.game.ID, 100, f.users[0], true)
+	play(first.ID, chess.ID, 30, f.users[1], true)
+	_, err = f.s.End(first.ID, AnyVersion)
+	assertNoError(t, err)
+	second, err := f.s.Create([]db.ID{f.users[0], joe.ID})
+	assertNoError(t, err)
+	play(second.ID, f.game.ID, 200, joe.ID, true)
+	_, err = f.s.End(second.ID, AnyVersion)
+	assertNoError(t, err)
+	third, err := f.s.Create([]db.ID{f.users[1], joe.ID})
+	assertNoError(t, err)
+	play(third.ID, chess.ID, 10, joe.ID, false)
+
+	found := map[string][]db.ID{}
+	for _, q := range []string{
+		"", "state=all", "state=active", "sort=money", "sort=games&order=asc&state=all",
+		"sort=duration&state=all", "sort=started&order=asc", "participant=3&state=all",
+		"game=2&state=all", "from=2000-01-01", "to=2000-01-01", "state=all&limit=2",
+	} {
+		ss, spec, err := listPage(q, SessionQuery, f.s.AllWithSessions)
+		if err != nil {
+			return found, err
+		}
+		found["sessions?"+q], err = idsOf(ss, spec, SessionValues, f.s.AllWithSessions, f.s.Count,
+			func(s SessionWithGames) db.ID { return s.ID })
+		if err != nil {
+			return found, err
+		}
+	}
+	for _, q := range []string{
+		"", "state=all", "sort=money", "sort=rounds&order=asc&state=all", "game=2&state=all",
+		"session=2", "sort=duration&state=all&limit=2", "to=2000-01-01",
+	} {
+		gss, spec, err := listPage(q, GameSessionQuery, f.gs.All)
+		if err != nil {
+			return found, err
+		}
+		found["game-sessions?"+q], err = idsOf(gss, spec, GameSessionValues, f.gs.All, f.repos.GameSessions.Count,
+			func(gs GameSession) db.ID { return gs.ID })
+		if err != nil {
+			return found, err
+		}
+	}
+	for _, q := range []string{"", "name=O", "session=3", "sort=name&order=desc&limit=2"} {
+		usrs, spec, err := listPage(q, UserQuery, f.u.Find)
+		if err != nil {
+			return found, err
+		}
+		found["users?"+q], err = idsOf(usrs, spec, UserValues, f.u.Find, f.u.Count,
+			func(u User) db.ID { return u.ID })
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+func listPage[T any](q string, s query.Schema, find func(query.Spec) ([]T, error)) ([]T, query.Spec, error) {
+	values, err := url.ParseQuery(q)
+	if err != nil {
+		return nil, query.Spec{}, err
+	}
+	spec, err := s.Parse(values, pagination.FromQuery(values))
+	if err != nil {
+		return nil, spec, err
+	}
+	rows, err := find(spec)
+	return rows, spec, err
+}
+
+// idsOf are the ids of rows, those of the page after them and the count of
+// the rows matching spec.
+func idsOf[T any](
+	rows []T, spec query.Spec, values query.Values[T],
+	find func(query.Spec) ([]T, error), count func(query.Spec) (int, error), key func(T) db.ID,
+) ([]db.ID, error) {
+	ids := []db.ID{}
+	for _, row := range rows {
+		ids = append(ids, key(row))
+	}
+	if len(rows) > 0 {
+		last := rows[len(rows)-1]
+		next := spec
+		c := spec.Next(int64(key(last)), values.For(spec)(last))
+		next.Cursor = &c
+		after, err := find(next)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, 0)
+		for _, row := range after {
+			ids = append(ids, key(row))
+		}
+	}
+	n, err := count(spec)
+	return append(ids, db.ID(n)), err
+}
+
+func TestIDs(t *testing.T) {
+	t.Run("numbers the rows of every table from 1", func(t *testing.T) {
+		for name, newFixture := range map[string]func(*testing.T) (*fixture, SessionWithGames){
+			"memory": newFixture, "sql": newSQLFixture, "postgres": newPostgresFixture,
+		} {
+			t.Run(name, func(t *testing.T) {
+				f, first := newFixture(t)
+				_, err := f.s.End(first.ID, AnyVersion)
+				assertNoError(t, err)
+				second, err := f.s.Create(f.users)
+				assertNoError(t, err)
+				assertInt(t, int(first.ID), 1)
+				assertInt(t, int(second.ID), 2)
+				for i, ss := range []SessionWithGames{first, second} {
+					gs := GameSession{SessionID: ss.ID, GameID: f.game.ID}
+					gs.Started = NewTime()
+					gs.Result = result.New(f.users)
+					assertNoError(t, f.repos.GameSessions.Insert(&gs))
+					assertInt(t, int(gs.ID), i+1)
+				}
+			})
+		}
+	})
+}
+
+func TestWebhookEvents(t *testing.T) {
+	t.Run("scans text and bytes", func(t *testing.T) {
+		for _, src := range []any{`["session.started"]`, []byte(`["session.started"]`)} {
+			var evs WebhookEvents
+			assertNoError(t, evs.Scan(src))
+			assertInt(t, len(evs), 1)
+		}
+		var evs WebhookEvents
+		assertError(t, evs.Scan(1), errvar.ErrScanError)
+	})
+}
+
+func TestVersion(t *testing.T) {
+	t.Run("matches any or the current version", func(t *testing.T) {
+		assertNoError(t, matchVersion(AnyVersion, 3))
+		assertNoError(t, matchVersion(3, 3))
+		assertError(t, matchVersion(2, 3), errvar.ErrPreconditionFailed)
+		assertError(t, matchVersion(4, 3), errvar.ErrPreconditionFailed)
+	})
+
+	t.Run("swaps only when a row changed", func(t *testing.T) {
+		assertNoError(t, swapped(rowsAffected(1), nil))
+		assertError(t, swapped(rowsAffected(0), nil), errvar.ErrVersionConflict)
+		failed := errors.New("failed")
+		assertError(t, swapped(nil, failed), failed)
+		assertError(t, affected(rowsAffected(0), nil), sql.ErrNoRows)
+	})
+}
+
+type rowsAffected int64
+
+func (n rowsAffected) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (n rowsAffected) RowsAffected() (int64, error) {
+	return int64(n), nil
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func assertError(t testing.TB, got error, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("got error %v want %v", got, want)
+	}
+}
+
+func assertValues[T any](t testing.TB, s query.Schema, values query.Values[T]) {
+	t.Helper()
+	names := s.SortNames()
+	if len(values) != len(names) {
+		t.Errorf("got %d values want %d", len(values), len(names))
+	}
+	for _, name := range names {
+		if values[name] == nil {
+			t.Errorf("%s has no value", name)
+		}
+	}
+}
+
+func assertInt(t testing.TB, got int, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
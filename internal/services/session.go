@@ -8,14 +8,69 @@ import (
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/errvar"
 	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
 	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/webhook"
 )
 
+var sessionState = query.OneOf(map[string]string{
+	"active": "s.ended IS NULL",
+	"ended":  "s.ended IS NOT NULL",
+	"all":    "",
+})
+
+// SessionQuery lists ended sessions unless another state is requested,
+// the active session is listed separately.
+var SessionQuery = query.Schema{
+	Sorts: []query.Field{
+		{Name: "ended", Expr: "s.ended"},
+		{Name: "started", Expr: "s.started"},
+		{Name: "duration", Expr: db.SQLite.Seconds("s.started", "s.ended"), Dialects: map[db.Dialect]string{
+			db.Postgres: db.Postgres.Seconds("s.started", "s.ended"),
+		}},
+		{Name: "money", Expr: `(
+    SELECT COALESCE(SUM(r.wager), 0)
+    FROM game_session_round r
+        JOIN game_session g ON g.id = r.game_session_id
+    WHERE g.session_id = s.id AND r.active = 0
+)`},
+		{Name: "games", Expr: "(SELECT COUNT(*) FROM game_session g WHERE g.session_id = s.id)"},
+	},
+	DefaultOrder: query.Desc,
+	Filters: map[string]query.Filter{
+		"participant": query.ID(
+			"EXISTS (SELECT 1 FROM session_participant p WHERE p.session_id = s.id AND p.user_id = ?)"),
+		"game": query.ID(
+			"EXISTS (SELECT 1 FROM game_session g WHERE g.session_id = s.id AND g.game_id = ?)"),
+		"from":  query.Time("s.started >= ?", false),
+		"to":    query.Time("s.started <= ?", true),
+		"state": sessionState,
+	},
+	Defaults: map[string]string{"state": "ended"},
+	Key:      "s.id",
+}
+
+// SessionValues are the values of the sorts of SessionQuery.
+var SessionValues = query.Values[SessionWithGames]{
+	"ended":    func(s SessionWithGames) any { return timeValue(s.Ended) },
+	"started":  func(s SessionWithGames) any { return timeValue(&s.Started) },
+	"duration": func(s SessionWithGames) any { return seconds(s.Started, s.Ended) },
+	"money": func(s SessionWithGames) any {
+		money := 0
+		for _, gs := range s.GameSessions {
+			money += wagered(gs.Rounds)
+		}
+		return money
+	},
+	"games": func(s SessionWithGames) any { return len(s.GameSessions) },
+}
+
 type Session struct {
 	ID      db.ID            `json:"id"`
 	Result  result.ResultMap `json:"result"`
 	Started time.Time        `json:"started"`
 	Ended   *time.Time       `json:"ended"`
+	Version int              `json:"version"`
 }
 
 func (s Session) ResultMap() result.ResultMap {
@@ -26,11 +81,11 @@ type Users []db.ID
 
 func (u *Users) Scan(src any) error {
 	var usrs Users
-	s, ok := src.(string)
-	if !ok {
-		return errvar.ErrScanError
+	b, err := jsonOf(src)
+	if err != nil {
+		return err
 	}
-	err := json.Unmarshal([]byte(s), &usrs)
+	err = json.Unmarshal(b, &usrs)
 	if err != nil {
 		return err
 	}
@@ -52,225 +107,96 @@ type SessionService interface {
 	ByPK(id db.ID) (Session, error)
 	ByPKWithSessions(id db.ID) (SessionWithGames, error)
 	Resolved(pg *pagination.P) ([]Session, error)
-	All(pg *pagination.P) ([]Session, error)
-	AllWithSessions(pg *pagination.P) ([]SessionWithGames, error)
+	All(spec query.Spec) ([]Session, error)
+	AllWithSessions(spec query.Spec) ([]SessionWithGames, error)
+	Active() (SessionWithGames, error)
 
-	Count() (int, error)
+	Count(spec query.Spec) (int, error)
 	HasActive() bool
 
 	Create(userIDs []db.ID) (SessionWithGames, error)
 
 	UpdateResult(id db.ID, p []Participant, r result.ResultMap) error
-	End(id db.ID) (SessionWithGames, error)
-	Cancel(id db.ID) error
+	// End and Cancel fail unless version is AnyVersion or the current version.
+	End(id db.ID, version int) (SessionWithGames, error)
+	Cancel(id db.ID, version int) error
 }
 
 type sService struct {
-	store *db.Datastore
-	u     UserService
-	r     ResultService
+	repo SessionRepository
+	u    UserService
+	r    ResultService
+	d    *webhook.Dispatcher
 }
 
-func (s *sService) Count() (int, error) {
-	var count int
-	err := s.store.DB.QueryRow("SELECT COUNT(*) FROM session").Scan(&count)
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
+func (s *sService) Count(spec query.Spec) (int, error) {
+	return s.repo.Count(spec)
 }
 
 func (s *sService) ByPK(id db.ID) (Session, error) {
-	var gs Session
-	var sResult *string
-	err := s.store.DB.QueryRow(
-		"SELECT * FROM session WHERE id = ?",
-		id,
-	).Scan(&gs.ID, &sResult, &gs.Started, &gs.Ended)
-	if err != nil {
-		return gs, err
-	}
-	if sResult != nil {
-		gs.Result = result.FromString(*sResult)
-	}
-	return gs, nil
+	return s.repo.ByPK(id)
 }
 
 func (s *sService) HasActive() bool {
-	var id db.ID
-	err := s.store.DB.QueryRow("SELECT id FROM session WHERE ended IS NULL").Scan(&id)
-	if err != nil {
-		return false
-	}
-	return id > 0
+	_, err := s.repo.Active()
+	return err == nil
 }
 
 func (s *sService) ByPKWithSessions(id db.ID) (SessionWithGames, error) {
-	var gs SessionWithGames
-	var sResult *string
-	err := s.store.DB.QueryRow(withSessions("WHERE s.id = ?"), id).Scan(
-		&gs.ID, &sResult, &gs.Started, &gs.Ended, &gs.GameSessions, &gs.Users)
-	if err != nil {
-		return gs, err
-	}
-	if sResult != nil {
-		gs.Result = result.FromString(*sResult)
-	}
-	return gs, nil
+	return s.repo.WithGames(id)
 }
 
-func (s *sService) all(q string, p *pagination.P) ([]Session, error) {
-	ss := make([]Session, 0)
-	rows, err := s.store.DB.Query(
-		pagination.MakeQuery(q, p))
-	if err != nil {
-		return ss, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var ses Session
-		var sResult *string
-		err = rows.Scan(&ses.ID, &sResult, &ses.Started, &ses.Ended)
-		if err != nil {
-			return ss, err
-		}
-		if sResult != nil {
-			ses.Result = result.FromString(*sResult)
-		}
-		ss = append(ss, ses)
-	}
-	err = rows.Err()
-	if err != nil {
-		return ss, err
-	}
-	return ss, nil
-}
-
-func (s *sService) All(p *pagination.P) ([]Session, error) {
-	return s.all("SELECT * FROM session ORDER BY ended DESC", p)
+func (s *sService) All(spec query.Spec) ([]Session, error) {
+	return s.repo.Find(spec)
 }
 
 func (s *sService) Resolved(p *pagination.P) ([]Session, error) {
-	return s.all("SELECT * FROM session WHERE ended IS NOT NULL", p)
+	ss, err := s.repo.Ended()
+	return page(ss, p), err
 }
 
-func (s *sService) getActive() (SessionWithGames, error) {
-	var sResult *string
-	active := SessionWithGames{}
-	err := s.store.DB.QueryRow(withSessions("WHERE s.ended IS NULL")).Scan(&active.ID, &sResult, &active.Started, &active.Ended, &active.GameSessions, &active.Users)
-	if err != nil {
-		return active, err
-	}
-	if sResult != nil {
-		active.Result = result.FromString(*sResult)
-	}
-	return active, nil
+func (s *sService) Active() (SessionWithGames, error) {
+	return s.repo.Active()
 }
 
-func (s *sService) AllWithSessions(p *pagination.P) ([]SessionWithGames, error) {
-	var active SessionWithGames
-	var activeErr error
-	if p != nil {
-		active, activeErr = s.getActive()
-		if activeErr == nil {
-			p.Limit -= 1
-		}
-	}
-	ss := make([]SessionWithGames, 0)
-	rows, err := s.store.DB.Query(
-		pagination.MakeQuery(withSessions("WHERE s.id != ? ORDER BY s.ended DESC"), p), active.ID)
-	if err != nil {
-		return ss, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var ses SessionWithGames
-		var sResult *string
-		err = rows.Scan(
-			&ses.ID, &sResult, &ses.Started, &ses.Ended, &ses.GameSessions, &ses.Users)
-		if err != nil {
-			return ss, err
-		}
-		if sResult != nil {
-			ses.Result = result.FromString(*sResult)
-		}
-		ss = append(ss, ses)
-	}
-	err = rows.Err()
-	if err != nil {
-		return ss, err
-	}
-	if p != nil && activeErr == nil {
-		p.Limit += 1
-		sss := ss
-		if len(ss) > 0 && ss[len(ss)-1].Ended == nil {
-			sss = ss[:len(ss)-1]
-		}
-		ss = append([]SessionWithGames{active}, sss...)
-	}
-	return ss, nil
+func (s *sService) AllWithSessions(spec query.Spec) ([]SessionWithGames, error) {
+	return s.repo.FindWithGames(spec)
 }
 
 func (s *sService) Create(userIDs []db.ID) (SessionWithGames, error) {
 	ss := SessionWithGames{}
 	ss.Started = NewTime()
+	ss.Version = 1
 	ss.GameSessions = []GameSession{}
 	ss.Users = userIDs
 	ss.Result = result.New(userIDs)
-	tx, err := s.store.DB.Begin()
-	if err != nil {
-		return ss, err
-	}
-	e, err := tx.Exec(
-		"INSERT INTO session (started, result) VALUES (?, ?)",
-		FormatTime(ss.Started), ss.Result.String())
-	if err != nil {
-		return ss, err
-	}
-	id, err := e.LastInsertId()
-	if err != nil {
-		return ss, err
-	}
-	ss.ID = db.ID(id)
-	stmt, err := tx.Prepare(
-		"INSERT INTO session_participant (session_id, user_id) VALUES (?, ?)")
-	if err != nil {
-		return ss, err
-	}
-	defer stmt.Close()
-	for _, userID := range userIDs {
-		_, err := stmt.Exec(ss.ID, userID)
-		if err != nil {
-			tx.Rollback()
-			return ss, err
-		}
-	}
-	err = tx.Commit()
-	if err != nil {
+	if err := s.repo.Insert(&ss); err != nil {
 		return ss, err
 	}
+	s.d.Dispatch(webhook.SessionStarted, ss)
 	return ss, nil
 }
 
-func (s *sService) End(id db.ID) (SessionWithGames, error) {
+func (s *sService) End(id db.ID, version int) (SessionWithGames, error) {
 	ss, err := s.ByPKWithSessions(id)
 	if err != nil {
 		return ss, err
 	}
+	if err = matchVersion(version, ss.Version); err != nil {
+		return ss, err
+	}
 	if ss.Ended != nil {
 		return ss, errvar.ErrSessionEnded
 	}
-	err = s.r.Update(ss.Result)
-	if err != nil {
+	ss.Ended = GetPtr(NewTime())
+	if err = s.repo.Update(&ss.Session); err != nil {
 		return ss, err
 	}
-	ss.Ended = GetPtr(NewTime())
-	_, err = s.store.DB.Exec(
-		"UPDATE session SET ended = ? WHERE id = ?",
-		FormatTime(*ss.Ended), id)
+	err = s.r.Update(ss.Result)
 	if err != nil {
 		return ss, err
 	}
+	s.d.Dispatch(webhook.SessionEnded, ss)
 	return ss, nil
 }
 
@@ -281,68 +207,58 @@ func (s *sService) UpdateResult(id db.ID, p []Participant, r result.ResultMap) e
 	}
 	ss.Result = result.Merge(p, ss.Result, r)
 	ss.Result.Resolve()
-	_, err = s.store.DB.Exec(
-		"UPDATE session SET result = ? WHERE id = ?",
-		ss.Result.String(), id)
-	return nil
+	return s.repo.UpdateResult(&ss)
 }
 
-func (s *sService) Cancel(id db.ID) error {
+func (s *sService) Cancel(id db.ID, version int) error {
 	ss, err := s.ByPK(id)
 	if err != nil {
 		return err
 	}
+	if err = matchVersion(version, ss.Version); err != nil {
+		return err
+	}
 	if ss.Ended != nil {
 		return errvar.ErrSessionEnded
 	}
-	_, err = s.store.DB.Exec("DELETE FROM session WHERE id = ?", id)
-	if err != nil {
-		return err
-	}
-	return nil
+	return s.repo.Delete(ss)
 }
 
-func NewSessionService(s *db.Datastore, u UserService, r ResultService) SessionService {
-	return &sService{s, u, r}
+func NewSessionService(
+	repo SessionRepository, u UserService, r ResultService, d *webhook.Dispatcher,
+) SessionService {
+	return &sService{repo, u, r, d}
 }
 
-func withSessions(q string) string {
-	return fmt.Sprintf(`WITH ordered_games AS (
-    SELECT
-        gs.id,
-        gs.session_id,
-        gs.game_id,
-        gs.result,
-        gs.started,
-        gs.ended
-    FROM game_session gs
-    WHERE gs.session_id = s.id
-    ORDER BY gs.ended DESC
-)
-
-SELECT
+// withSessions selects sessions with their game sessions, ended last first,
+// and the ids of their participants as json.
+func withSessions(d db.Dialect, q string) string {
+	return fmt.Sprintf(`SELECT
     s.id,
     s.result,
     s.started,
     s.ended,
+    s.version,
     COALESCE(
-            (SELECT json_group_array(
-                            json_object(
+            (SELECT %[1]s(
+                            %[2]s(
                                     'id', g.id,
                                     'session_id', g.session_id,
                                     'game_id', g.game_id,
                                     'result', g.result,
                                     'started', g.started,
                                     'ended', g.ended,
+                                    'version', g.version,
                                     'rounds', COALESCE(
-                                            (SELECT json_group_array(
-                                                            json_object(
+                                            (SELECT %[1]s(
+                                                            %[2]s(
                                                                     'id', o.id,
                                                                     'game_session_id', o.game_session_id,
                                                                     'round', o.round,
                                                                     'wager', o.wager,
                                                                     'active', o.active,
-                                                                    'result', o.result
+                                                                    'result', o.result,
+                                                                    'version', o.version
                                                             )
                                                     )
                                              FROM game_session_round o
@@ -351,15 +267,27 @@ SELECT
                                         )
                             )
                     )
-             FROM ordered_games g
+             FROM (
+                 SELECT
+                     gs.id,
+                     gs.session_id,
+                     gs.game_id,
+                     gs.result,
+                     gs.started,
+                     gs.ended,
+                     gs.version
+                 FROM game_session gs
+                 WHERE gs.session_id = s.id
+                 ORDER BY gs.ended DESC NULLS LAST
+             ) g
             ), '[]'
     ) AS gameSessions,
     COALESCE(
-            (SELECT json_group_array(p.user_id)
+            (SELECT %[1]s(p.user_id)
              FROM session_participant p
              WHERE p.session_id = s.id
             ), '[]'
     ) AS users
 FROM
-    session s %s`, q)
+    session s %[3]s`, d.JSONArray(), d.JSONObject(), q)
 }
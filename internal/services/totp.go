@@ -0,0 +1,171 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/errvar"
+)
+
+type UserTOTP struct {
+	UserID   db.ID
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type RecoveryCode struct {
+	ID     db.ID
+	UserID db.ID
+	Code   string
+}
+
+type TOTPService interface {
+	ByUser(userID db.ID) (UserTOTP, error)
+	IsEnabled(userID db.ID) bool
+	RecoveryCodes(userID db.ID) ([]RecoveryCode, error)
+
+	SetSecret(userID db.ID, secret string) error
+	Enable(userID db.ID, codeHashes []string) error
+	Disable(userID db.ID) error
+	// UseStep and UseRecoveryCode fail with errvar.ErrTOTPInvalid
+	// if the step or the recovery code was used already.
+	UseStep(userID db.ID, step int64) error
+	UseRecoveryCode(id db.ID) error
+}
+
+type totpService struct {
+	store *db.Datastore
+}
+
+func (t *totpService) ByUser(userID db.ID) (UserTOTP, error) {
+	var ut UserTOTP
+	err := t.store.QueryRow(
+		"SELECT user_id, secret, enabled, last_step FROM user_totp WHERE user_id = ?",
+		userID,
+	).Scan(&ut.UserID, &ut.Secret, &ut.Enabled, &ut.LastStep)
+	if err != nil {
+		return ut, err
+	}
+	return ut, nil
+}
+
+func (t *totpService) IsEnabled(userID db.ID) bool {
+	ut, err := t.ByUser(userID)
+	if err != nil {
+		return false
+	}
+	return ut.Enabled
+}
+
+func (t *totpService) RecoveryCodes(userID db.ID) ([]RecoveryCode, error) {
+	codes := make([]RecoveryCode, 0)
+	rows, err := t.store.Query(
+		"SELECT id, user_id, code FROM recovery_code WHERE user_id = ? AND used = 0",
+		userID)
+	if err != nil {
+		return codes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rc RecoveryCode
+		err = rows.Scan(&rc.ID, &rc.UserID, &rc.Code)
+		if err != nil {
+			return codes, err
+		}
+		codes = append(codes, rc)
+	}
+	err = rows.Err()
+	if err != nil {
+		return codes, err
+	}
+	return codes, nil
+}
+
+func (t *totpService) SetSecret(userID db.ID, secret string) error {
+	_, err := t.store.Exec(`INSERT
+INTO user_totp (user_id, secret, enabled, last_step)
+    VALUES (?, ?, 0, 0)
+ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = 0, last_step = 0`,
+		userID, secret)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *totpService) Enable(userID db.ID, codeHashes []string) error {
+	tx, err := t.store.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE user_totp SET enabled = 1 WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM recovery_code WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(
+		"INSERT INTO recovery_code (user_id, code) VALUES (?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, h := range codeHashes {
+		_, err := stmt.Exec(userID, h)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (t *totpService) Disable(userID db.ID) error {
+	tx, err := t.store.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM recovery_code WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *totpService) UseStep(userID db.ID, step int64) error {
+	return used(t.store.Exec(
+		"UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?",
+		step, userID, step))
+}
+
+func (t *totpService) UseRecoveryCode(id db.ID) error {
+	return used(t.store.Exec(
+		"UPDATE recovery_code SET used = 1 WHERE id = ? AND used = 0", id))
+}
+
+// used fails with errvar.ErrTOTPInvalid if a code was used already,
+// concurrent logins with the same code only update its row once.
+func used(r sql.Result, err error) error {
+	err = affected(r, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errvar.ErrTOTPInvalid
+	}
+	return err
+}
+
+func NewTOTPService(store *db.Datastore) TOTPService {
+	return &totpService{store}
+}
@@ -1,13 +1,38 @@
 package services
 
 import (
+	"time"
+
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/query"
 )
 
+var UserQuery = query.Schema{
+	Sorts: []query.Field{
+		{Name: "id", Expr: "u.id"},
+		{Name: "name", Expr: "u.name"},
+	},
+	DefaultOrder: query.Asc,
+	Filters: map[string]query.Filter{
+		"name": query.Contains(`lower(u.name) LIKE lower(?) ESCAPE '\'`),
+		"session": query.ID(
+			"EXISTS (SELECT 1 FROM session_participant p WHERE p.session_id = ? AND p.user_id = u.id)"),
+	},
+	Key: "u.id",
+}
+
+// UserValues are the values of the sorts of UserQuery.
+var UserValues = query.Values[User]{
+	"id":   func(u User) any { return int64(u.ID) },
+	"name": func(u User) any { return u.Name },
+}
+
 type User struct {
 	ID   db.ID  `json:"id"`
 	Name string `json:"name"`
+	// Deactivated users cannot sign in or join sessions, their history is kept.
+	Deactivated *time.Time `json:"deactivated"`
 }
 
 func (u User) ResultID() db.ID {
@@ -33,101 +58,80 @@ type UserService interface {
 	ByName(name string) (UserWithPassword, error)
 	BySession(sessionID db.ID) ([]User, error)
 	All(p *pagination.P) ([]User, error)
+	Find(spec query.Spec) ([]User, error)
+	Count(spec query.Spec) (int, error)
+
+	Rename(id db.ID, name string) error
+	// SetPassword replaces the password hash of a user.
+	SetPassword(id db.ID, password string) error
+	Deactivate(id db.ID) error
+	Reactivate(id db.ID) error
 }
 
 type uService struct {
-	store *db.Datastore
+	repo UserRepository
 }
 
 func (u *uService) Create(name, password string) (User, error) {
-	usr := User{Name: name}
-	r, err := u.store.DB.Exec(
-		"INSERT INTO user (name, password) VALUES (?, ?)",
-		name, password,
-	)
-	if err != nil {
-		return usr, err
-	}
-	id, err := r.LastInsertId()
-	if err != nil {
-		return usr, err
-	}
-	usr.ID = db.ID(id)
-	return usr, nil
+	usr := UserWithPassword{User: User{Name: name}, Password: password}
+	err := u.repo.Insert(&usr)
+	return usr.User, err
 }
 
 func (u *uService) ByPK(id db.ID) (UserWithPassword, error) {
-	var usr UserWithPassword
-	err := u.store.DB.QueryRow(
-		"SELECT * from user WHERE id = ?",
-		id,
-	).Scan(&usr.ID, &usr.Name, &usr.Password)
-	if err != nil {
-		return usr, err
-	}
-	return usr, nil
+	return u.repo.ByPK(id)
 }
 
 func (u *uService) ByName(name string) (UserWithPassword, error) {
-	var usr UserWithPassword
-	err := u.store.DB.QueryRow(
-		"SELECT id, name, password from user WHERE name = ?",
-		name,
-	).Scan(&usr.ID, &usr.Name, &usr.Password)
-	if err != nil {
-		return usr, err
-	}
-	return usr, nil
+	return u.repo.ByName(name)
 }
 
 func (u *uService) BySession(sessionID db.ID) ([]User, error) {
-	usrs := make([]User, 0)
-	rows, err := u.store.DB.Query(`SELECT u.id, u.name
-FROM main.session_participant p
-         JOIN user u ON p.user_id = u.id
-WHERE p.session_id = ?`, sessionID)
-	if err != nil {
-		return usrs, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var usr User
-		err = rows.Scan(&usr.ID, &usr.Name)
-		if err != nil {
-			return usrs, err
-		}
-		usrs = append(usrs, usr)
-	}
-	err = rows.Err()
-	if err != nil {
-		return usrs, err
-	}
-	return usrs, nil
+	return u.repo.BySession(sessionID)
 }
 
 func (u *uService) All(p *pagination.P) ([]User, error) {
-	usrs := make([]User, 0)
-	rows, err := u.store.DB.Query(
-		pagination.MakeQuery("SELECT id, name from user ORDER BY id", p))
+	return u.repo.All(p)
+}
+
+func (u *uService) Find(spec query.Spec) ([]User, error) {
+	return u.repo.Find(spec)
+}
+
+func (u *uService) Count(spec query.Spec) (int, error) {
+	return u.repo.Count(spec)
+}
+
+// update applies change to the user of id and writes it.
+func (u *uService) update(id db.ID, change func(usr *UserWithPassword)) error {
+	usr, err := u.repo.ByPK(id)
 	if err != nil {
-		return usrs, err
+		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var usr User
-		err = rows.Scan(&usr.ID, &usr.Name)
-		if err != nil {
-			return usrs, err
+	change(&usr)
+	return u.repo.Update(usr)
+}
+
+func (u *uService) Rename(id db.ID, name string) error {
+	return u.update(id, func(usr *UserWithPassword) { usr.Name = name })
+}
+
+func (u *uService) SetPassword(id db.ID, password string) error {
+	return u.update(id, func(usr *UserWithPassword) { usr.Password = password })
+}
+
+func (u *uService) Deactivate(id db.ID) error {
+	return u.update(id, func(usr *UserWithPassword) {
+		if usr.Deactivated == nil {
+			usr.Deactivated = GetPtr(NewTime())
 		}
-		usrs = append(usrs, usr)
-	}
-	err = rows.Err()
-	if err != nil {
-		return usrs, err
-	}
-	return usrs, nil
+	})
+}
+
+func (u *uService) Reactivate(id db.ID) error {
+	return u.update(id, func(usr *UserWithPassword) { usr.Deactivated = nil })
 }
 
-func NewUserService(store *db.Datastore) UserService {
-	return &uService{store}
+func NewUserService(repo UserRepository) UserService {
+	return &uService{repo}
 }
@@ -1,12 +1,31 @@
 package services
 
-import "time"
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lindeneg/wager/internal/errvar"
+)
+
+// AnyVersion changes a resource regardless of its current version.
+const AnyVersion = 0
 
 // https://stackoverflow.com/questions/30744965/how-to-get-the-pointer-of-return-value-from-function-call
 func GetPtr[T any](x T) *T {
 	return &x
 }
 
+// jsonOf is the json of a column, drivers scan json as string or []byte.
+func jsonOf(src any) ([]byte, error) {
+	switch s := src.(type) {
+	case string:
+		return []byte(s), nil
+	case []byte:
+		return s, nil
+	}
+	return nil, errvar.ErrScanError
+}
+
 func NewTime() time.Time {
 	return time.Now().UTC()
 }
@@ -14,3 +33,69 @@ func NewTime() time.Time {
 func FormatTime(t time.Time) string {
 	return t.Format(time.RFC3339)
 }
+
+// timeValue and seconds are the sort values of a timestamp and of the
+// time between two, as sql has them from timestamps stored in seconds.
+func timeValue(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return FormatTime(*t)
+}
+
+func seconds(start time.Time, end *time.Time) any {
+	if end == nil {
+		return nil
+	}
+	return int64(end.Truncate(time.Second).Sub(start.Truncate(time.Second)) / time.Second)
+}
+
+// wagered is the money of the ended rounds.
+func wagered(rounds GameSessionRounds) int {
+	money := 0
+	for _, gr := range rounds {
+		if gr.Active == 0 {
+			money += gr.Wager
+		}
+	}
+	return money
+}
+
+// matchVersion fails unless want is AnyVersion or the current version.
+func matchVersion(want int, current int) error {
+	if want != AnyVersion && want != current {
+		return errvar.ErrPreconditionFailed
+	}
+	return nil
+}
+
+// affected fails with sql.ErrNoRows if a statement changed no rows.
+func affected(r sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// swapped fails if a compare-and-swap statement changed no rows,
+// the row was then changed since its version was read.
+func swapped(r sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errvar.ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/pagination"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/webhook"
+)
+
+type WebhookEvents []string
+
+func (w *WebhookEvents) Scan(src any) error {
+	b, err := jsonOf(src)
+	if err != nil {
+		return err
+	}
+	var evs WebhookEvents
+	if err = json.Unmarshal(b, &evs); err != nil {
+		return err
+	}
+	*w = evs
+	return nil
+}
+
+type Webhook struct {
+	ID      db.ID         `json:"id"`
+	URL     string        `json:"url"`
+	Events  WebhookEvents `json:"events"`
+	Created time.Time     `json:"created"`
+}
+
+type WebhookWithSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookDelivery struct {
+	ID        db.ID     `json:"id"`
+	WebhookID db.ID     `json:"webhookId"`
+	EventID   string    `json:"eventId"`
+	Event     string    `json:"event"`
+	Payload   string    `json:"payload"`
+	Attempt   int       `json:"attempt"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+	Delivered time.Time `json:"delivered"`
+}
+
+// RoundEndedData is the data of webhook.RoundEnded events.
+type RoundEndedData struct {
+	GameSession GameSession      `json:"gameSession"`
+	Round       GameSessionRound `json:"round"`
+	WinnerID    db.ID            `json:"winnerId"`
+}
+
+// PaymentData is the data of webhook.PaymentRecorded events, Result is
+// what the participants of an ended game session owe each other and
+// has been added to the session result.
+type PaymentData struct {
+	SessionID     db.ID            `json:"sessionId"`
+	GameSessionID db.ID            `json:"gameSessionId"`
+	GameID        db.ID            `json:"gameId"`
+	Result        result.ResultMap `json:"result"`
+}
+
+// WebhookService manages webhook subscriptions and their delivery log,
+// it is the store of the webhook dispatcher.
+type WebhookService interface {
+	webhook.Store
+
+	All() ([]Webhook, error)
+	ByPK(id db.ID) (Webhook, error)
+	Deliveries(id db.ID, p *pagination.P) ([]WebhookDelivery, error)
+
+	Create(url string, secret string, events []string) (WebhookWithSecret, error)
+	Delete(id db.ID) error
+}
+
+type whService struct {
+	store *db.Datastore
+}
+
+func (w *whService) All() ([]Webhook, error) {
+	whs := make([]Webhook, 0)
+	rows, err := w.store.Query("SELECT id, url, events, created FROM webhook ORDER BY id")
+	if err != nil {
+		return whs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wh Webhook
+		err = rows.Scan(&wh.ID, &wh.URL, &wh.Events, &wh.Created)
+		if err != nil {
+			return whs, err
+		}
+		whs = append(whs, wh)
+	}
+	return whs, rows.Err()
+}
+
+func (w *whService) ByPK(id db.ID) (Webhook, error) {
+	var wh Webhook
+	err := w.store.QueryRow(
+		"SELECT id, url, events, created FROM webhook WHERE id = ?", id,
+	).Scan(&wh.ID, &wh.URL, &wh.Events, &wh.Created)
+	return wh, err
+}
+
+// Subscribers matches the events of webhooks here, they are stored as a
+// json array that every database queries differently.
+func (w *whService) Subscribers(event string) ([]webhook.Subscription, error) {
+	subs := make([]webhook.Subscription, 0)
+	rows, err := w.store.Query("SELECT id, url, secret, events FROM webhook ORDER BY id")
+	if err != nil {
+		return subs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s webhook.Subscription
+		var events WebhookEvents
+		err = rows.Scan(&s.ID, &s.URL, &s.Secret, &events)
+		if err != nil {
+			return subs, err
+		}
+		for _, e := range events {
+			if e == event {
+				subs = append(subs, s)
+				break
+			}
+		}
+	}
+	return subs, rows.Err()
+}
+
+func (w *whService) Deliveries(id db.ID, p *pagination.P) ([]WebhookDelivery, error) {
+	ds := make([]WebhookDelivery, 0)
+	rows, err := w.store.Query(pagination.MakeQuery(`SELECT
+    id, webhook_id, event_id, event, payload, attempt, status, error, delivered
+FROM webhook_delivery WHERE webhook_id = ? ORDER BY id DESC`, p), id)
+	if err != nil {
+		return ds, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d WebhookDelivery
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event,
+			&d.Payload, &d.Attempt, &d.Status, &d.Error, &d.Delivered)
+		if err != nil {
+			return ds, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+func (w *whService) Record(a webhook.Attempt) error {
+	_, err := w.store.Exec(`INSERT INTO webhook_delivery
+    (webhook_id, event_id, event, payload, attempt, status, error, delivered)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.WebhookID, a.EventID, a.Event, a.Payload,
+		a.Attempt, a.Status, a.Error, FormatTime(a.Delivered))
+	return err
+}
+
+func (w *whService) Create(url string, secret string, events []string) (WebhookWithSecret, error) {
+	wh := WebhookWithSecret{
+		Webhook: Webhook{URL: url, Events: events, Created: NewTime()},
+		Secret:  secret,
+	}
+	evs, err := json.Marshal(events)
+	if err != nil {
+		return wh, err
+	}
+	err = w.store.QueryRow(
+		"INSERT INTO webhook (url, secret, events, created) VALUES (?, ?, ?, ?) RETURNING id",
+		wh.URL, wh.Secret, string(evs), FormatTime(wh.Created)).Scan(&wh.ID)
+	return wh, err
+}
+
+func (w *whService) Delete(id db.ID) error {
+	if _, err := w.ByPK(id); err != nil {
+		return err
+	}
+	tx, err := w.store.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM webhook_delivery WHERE webhook_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM webhook WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func NewWebhookService(store *db.Datastore) WebhookService {
+	return &whService{store}
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type Granularity string
+
+const (
+	ByRound       Granularity = "round"
+	ByGameSession Granularity = "game-session"
+	BySession     Granularity = "session"
+)
+
+func ParseGranularity(s string) (Granularity, bool) {
+	switch g := Granularity(s); g {
+	case ByRound, ByGameSession, BySession:
+		return g, true
+	case "":
+		return BySession, true
+	default:
+		return "", false
+	}
+}
+
+type BalancePoint struct {
+	ID       db.ID         `json:"id"`
+	Time     time.Time     `json:"time"`
+	Balances map[db.ID]int `json:"balances"`
+}
+
+type BalanceHistory struct {
+	By     Granularity     `json:"by"`
+	Users  []services.User `json:"users"`
+	Points []BalancePoint  `json:"points"`
+}
+
+// Balances reconstructs the net balance of every user after each ended round,
+// game session or session. Points are identified by the id of that entity.
+func Balances(
+	rounds []services.HistoryRound, sessions []services.Session,
+	usrs []services.User, by Granularity,
+) BalanceHistory {
+	bh := BalanceHistory{By: by, Users: usrs, Points: []BalancePoint{}}
+	ended := map[db.ID]time.Time{}
+	for _, s := range sessions {
+		if s.Ended != nil {
+			ended[s.ID] = *s.Ended
+		}
+	}
+	type step struct {
+		id     db.ID
+		time   time.Time
+		deltas map[db.ID]int
+	}
+	steps := []*step{}
+	index := map[db.ID]*step{}
+	for _, r := range rounds {
+		var key db.ID
+		var t time.Time
+		switch by {
+		case ByRound:
+			key, t = r.ID, playedAt(r)
+		case ByGameSession:
+			if r.Ended == nil {
+				continue
+			}
+			key, t = r.GameSessionID, *r.Ended
+		default:
+			e, ok := ended[r.SessionID]
+			if !ok {
+				continue
+			}
+			key, t = r.SessionID, e
+		}
+		s, ok := index[key]
+		if !ok {
+			s = &step{id: key, time: t, deltas: map[db.ID]int{}}
+			index[key] = s
+			steps = append(steps, s)
+		}
+		for id := range r.Result {
+			s.deltas[id] += r.Result.Net(id)
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].time.Before(steps[j].time)
+	})
+	current := make(map[db.ID]int, len(usrs))
+	for _, u := range usrs {
+		current[u.ID] = 0
+	}
+	for _, s := range steps {
+		for id, d := range s.deltas {
+			current[id] += d
+		}
+		balances := make(map[db.ID]int, len(current))
+		for id, v := range current {
+			balances[id] = v
+		}
+		bh.Points = append(bh.Points, BalancePoint{ID: s.id, Time: s.time, Balances: balances})
+	}
+	return bh
+}
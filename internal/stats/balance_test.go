@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func TestBalances(t *testing.T) {
+	all := []db.ID{1, 2, 3}
+	rounds := newRounds(
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 1, session: 1, users: all, winner: 2, wager: 200},
+		roundSpec{game: 2, session: 2, users: []db.ID{2, 3}, winner: 3, wager: 50},
+	)
+	sessions := []services.Session{
+		{ID: 1, Started: epoch, Ended: services.GetPtr(epoch.Add(5 * time.Hour))},
+		{ID: 2, Started: epoch, Ended: nil},
+	}
+
+	t.Run("can reconstruct per round", func(t *testing.T) {
+		got := Balances(rounds, sessions, testUsers, ByRound)
+		assertInt(t, "points", len(got.Points), 3)
+		assertInt(t, "first", got.Points[0].Balances[1], 100)
+		assertInt(t, "second", got.Points[1].Balances[1], 0)
+		assertInt(t, "second", got.Points[1].Balances[2], 150)
+		assertInt(t, "third", got.Points[2].Balances[2], 100)
+		assertInt(t, "third", got.Points[2].Balances[3], -100)
+	})
+
+	t.Run("only includes ended sessions", func(t *testing.T) {
+		got := Balances(rounds, sessions, testUsers, BySession)
+		assertInt(t, "points", len(got.Points), 1)
+		assertInt(t, "session", int(got.Points[0].ID), 1)
+		assertInt(t, "balance", got.Points[0].Balances[3], -150)
+	})
+
+	t.Run("balances always sum to zero", func(t *testing.T) {
+		got := Balances(rounds, sessions, testUsers, ByGameSession)
+		assertInt(t, "points", len(got.Points), 3)
+		for _, p := range got.Points {
+			sum := 0
+			for _, v := range p.Balances {
+				sum += v
+			}
+			assertInt(t, "sum", sum, 0)
+		}
+	})
+}
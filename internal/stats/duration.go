@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/lindeneg/wager/internal/services"
+)
+
+// Elapsed is the duration between started and ended,
+// or between started and now if ended is nil, rounded to the second.
+func Elapsed(started time.Time, ended *time.Time, now time.Time) time.Duration {
+	end := now
+	if ended != nil {
+		end = *ended
+	}
+	if end.Before(started) {
+		return 0
+	}
+	return end.Sub(started).Round(time.Second)
+}
+
+type DurationStats struct {
+	Games    int           `json:"games"`
+	Total    time.Duration `json:"total"`
+	Average  time.Duration `json:"average"`
+	Longest  time.Duration `json:"longest"`
+	Shortest time.Duration `json:"shortest"`
+}
+
+// Durations aggregates the game session durations,
+// an active game session counts up until now.
+func Durations(sessions []services.GameSession, now time.Time) DurationStats {
+	ds := DurationStats{Games: len(sessions)}
+	for i, s := range sessions {
+		d := Elapsed(s.Started, s.Ended, now)
+		ds.Total += d
+		if i == 0 || d > ds.Longest {
+			ds.Longest = d
+		}
+		if i == 0 || d < ds.Shortest {
+			ds.Shortest = d
+		}
+	}
+	if ds.Games > 0 {
+		ds.Average = (ds.Total / time.Duration(ds.Games)).Round(time.Second)
+	}
+	return ds
+}
@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func TestElapsed(t *testing.T) {
+	t.Run("uses ended when set", func(t *testing.T) {
+		got := Elapsed(epoch, services.GetPtr(epoch.Add(90*time.Second)), epoch.Add(time.Hour))
+		assertInt(t, "elapsed", int(got.Seconds()), 90)
+	})
+
+	t.Run("uses now when active", func(t *testing.T) {
+		got := Elapsed(epoch, nil, epoch.Add(time.Hour+400*time.Millisecond))
+		assertInt(t, "elapsed", int(got.Seconds()), 3600)
+	})
+
+	t.Run("is never negative", func(t *testing.T) {
+		got := Elapsed(epoch, nil, epoch.Add(-time.Minute))
+		assertInt(t, "elapsed", int(got), 0)
+	})
+}
+
+func TestDurations(t *testing.T) {
+	now := epoch.Add(10 * time.Hour)
+	sessions := []services.GameSession{
+		newGameSession(3, epoch.Add(9*time.Hour), nil),
+		newGameSession(2, epoch.Add(2*time.Hour), services.GetPtr(epoch.Add(5*time.Hour))),
+		newGameSession(1, epoch, services.GetPtr(epoch.Add(2*time.Hour))),
+	}
+	got := Durations(sessions, now)
+
+	assertInt(t, "games", got.Games, 3)
+	assertInt(t, "total", int(got.Total.Hours()), 6)
+	assertInt(t, "average", int(got.Average.Hours()), 2)
+	assertInt(t, "longest", int(got.Longest.Hours()), 3)
+	assertInt(t, "shortest", int(got.Shortest.Hours()), 1)
+
+	t.Run("is zero without game sessions", func(t *testing.T) {
+		got := Durations(nil, now)
+		assertInt(t, "average", int(got.Average), 0)
+	})
+}
@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type GameSessionSummary struct {
+	ID        db.ID      `json:"id"`
+	SessionID db.ID      `json:"sessionId"`
+	Rounds    int        `json:"rounds"`
+	Wagered   int        `json:"wagered"`
+	Started   time.Time  `json:"started"`
+	Ended     *time.Time `json:"ended"`
+	// Duration is in seconds and zero while the game session is active.
+	Duration int64 `json:"duration"`
+}
+
+type GameStats struct {
+	GameID           db.ID                `json:"gameId"`
+	Name             string               `json:"name"`
+	TimesPlayed      int                  `json:"timesPlayed"`
+	Rounds           int                  `json:"rounds"`
+	Wagered          int                  `json:"wagered"`
+	AverageWager     float64              `json:"averageWager"`
+	RoundsPerSession float64              `json:"roundsPerSession"`
+	AverageDuration  int64                `json:"averageDuration"`
+	TopWinners       []LeaderboardEntry   `json:"topWinners"`
+	Recent           []GameSessionSummary `json:"recent"`
+}
+
+// ForGame derives the statistics of gm from its ended rounds and
+// its game sessions, which are expected to be ordered most recent first.
+func ForGame(
+	gm services.Game, rounds []services.HistoryRound, sessions []services.GameSession,
+	usrs []services.User, top int, recent int,
+) GameStats {
+	gs := GameStats{
+		GameID:      gm.ID,
+		Name:        gm.Name,
+		TimesPlayed: len(sessions),
+		TopWinners:  []LeaderboardEntry{},
+		Recent:      []GameSessionSummary{},
+	}
+	for _, r := range rounds {
+		if _, ok := r.Result.Winner(); !ok {
+			continue
+		}
+		gs.Rounds++
+		gs.Wagered += r.Wager
+	}
+	if gs.Rounds > 0 {
+		gs.AverageWager = float64(gs.Wagered) / float64(gs.Rounds)
+	}
+	gs.RoundsPerSession = rate(gs.Rounds, gs.TimesPlayed)
+	var total int64
+	var ended int64
+	for _, s := range sessions {
+		summary := summarize(s)
+		if s.Ended != nil {
+			total += summary.Duration
+			ended++
+		}
+		if len(gs.Recent) < recent {
+			gs.Recent = append(gs.Recent, summary)
+		}
+	}
+	if ended > 0 {
+		gs.AverageDuration = total / ended
+	}
+	for _, e := range Leaderboard(rounds, usrs, SortNet) {
+		if len(gs.TopWinners) == top || e.Net <= 0 {
+			break
+		}
+		gs.TopWinners = append(gs.TopWinners, e)
+	}
+	return gs
+}
+
+func summarize(s services.GameSession) GameSessionSummary {
+	summary := GameSessionSummary{
+		ID:        s.ID,
+		SessionID: s.SessionID,
+		Started:   s.Started,
+		Ended:     s.Ended,
+	}
+	for _, r := range s.Rounds {
+		if r.Active == 1 {
+			continue
+		}
+		summary.Rounds++
+		summary.Wagered += r.Wager
+	}
+	if s.Ended != nil {
+		summary.Duration = int64(s.Ended.Sub(s.Started).Seconds())
+	}
+	return summary
+}
@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+func newGameSession(id db.ID, started time.Time, ended *time.Time, wagers ...int) services.GameSession {
+	gs := services.GameSession{SessionID: 1, GameID: 1}
+	gs.ID = id
+	gs.Started = started
+	gs.Ended = ended
+	for i, w := range wagers {
+		gr := services.GameSessionRound{GameSessionID: id}
+		gr.Round = i + 1
+		gr.Wager = w
+		gs.Rounds = append(gs.Rounds, gr)
+	}
+	return gs
+}
+
+func TestForGame(t *testing.T) {
+	all := []db.ID{1, 2, 3}
+	rounds := newRounds(
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 1, session: 1, users: all, winner: 2, wager: 300},
+		roundSpec{game: 1, session: 2, users: all, winner: 1, wager: 200},
+	)
+	active := newGameSession(3, epoch.Add(5*time.Hour), nil, 50)
+	active.Rounds[0].Active = 1
+	sessions := []services.GameSession{
+		active,
+		newGameSession(2, epoch.Add(2*time.Hour), services.GetPtr(epoch.Add(4*time.Hour)), 200),
+		newGameSession(1, epoch, services.GetPtr(epoch.Add(time.Hour)), 100, 300),
+	}
+	got := ForGame(testGames[0], rounds, sessions, testUsers, 2, 2)
+
+	t.Run("counts rounds and wagers", func(t *testing.T) {
+		assertInt(t, "times played", got.TimesPlayed, 3)
+		assertInt(t, "rounds", got.Rounds, 3)
+		assertInt(t, "wagered", got.Wagered, 600)
+		if got.AverageWager != 200 {
+			t.Errorf("got average wager %f want 200", got.AverageWager)
+		}
+		if got.RoundsPerSession != 1 {
+			t.Errorf("got rounds per session %f want 1", got.RoundsPerSession)
+		}
+	})
+
+	t.Run("averages duration of ended game sessions", func(t *testing.T) {
+		assertInt(t, "average duration", int(got.AverageDuration), int((90 * time.Minute).Seconds()))
+	})
+
+	t.Run("lists winners with a positive net", func(t *testing.T) {
+		assertInt(t, "top winners", len(got.TopWinners), 2)
+		assertInt(t, "first", int(got.TopWinners[0].UserID), 1)
+		assertInt(t, "first net", got.TopWinners[0].Net, 100-150+200)
+		assertInt(t, "second", int(got.TopWinners[1].UserID), 2)
+	})
+
+	t.Run("summarizes recent game sessions", func(t *testing.T) {
+		assertInt(t, "recent", len(got.Recent), 2)
+		assertInt(t, "first", int(got.Recent[0].ID), 3)
+		assertInt(t, "first rounds", got.Recent[0].Rounds, 0)
+		assertInt(t, "first duration", int(got.Recent[0].Duration), 0)
+		assertInt(t, "second wagered", got.Recent[1].Wagered, 200)
+	})
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type RivalGame struct {
+	GameID db.ID  `json:"gameId"`
+	Name   string `json:"name"`
+	Rounds int    `json:"rounds"`
+	WinsA  int    `json:"winsA"`
+	WinsB  int    `json:"winsB"`
+	Net    int    `json:"net"`
+}
+
+type FlowPoint struct {
+	RoundID db.ID     `json:"roundId"`
+	GameID  db.ID     `json:"gameId"`
+	Played  time.Time `json:"played"`
+	Delta   int       `json:"delta"`
+	Total   int       `json:"total"`
+}
+
+// HeadToHead compares A and B over the rounds both took part in.
+// Net and Flow are the money moved from B to A, so negative means B is up.
+type HeadToHead struct {
+	A            services.User `json:"a"`
+	B            services.User `json:"b"`
+	Rounds       int           `json:"rounds"`
+	WinsA        int           `json:"winsA"`
+	WinsB        int           `json:"winsB"`
+	WinsOther    int           `json:"winsOther"`
+	Net          int           `json:"net"`
+	Streak       int           `json:"streak"`
+	StreakHolder db.ID         `json:"streakHolder"`
+	Flow         []FlowPoint   `json:"flow"`
+	Games        []RivalGame   `json:"games"`
+}
+
+func Rivalry(
+	a services.User, b services.User,
+	rounds []services.HistoryRound, games []services.Game,
+) HeadToHead {
+	h := HeadToHead{A: a, B: b, Flow: []FlowPoint{}, Games: []RivalGame{}}
+	records := map[db.ID]*RivalGame{}
+	for _, r := range rounds {
+		if !participated(r, a.ID) || !participated(r, b.ID) {
+			continue
+		}
+		winner, ok := r.Result.Winner()
+		if !ok {
+			continue
+		}
+		rg, ok := records[r.GameID]
+		if !ok {
+			rg = &RivalGame{GameID: r.GameID, Name: nameFromID(r.GameID, games)}
+			records[r.GameID] = rg
+		}
+		delta := r.Result[b.ID][a.ID] - r.Result[a.ID][b.ID]
+		h.Rounds++
+		h.Net += delta
+		rg.Rounds++
+		rg.Net += delta
+		switch winner {
+		case a.ID:
+			h.WinsA++
+			rg.WinsA++
+		case b.ID:
+			h.WinsB++
+			rg.WinsB++
+		default:
+			h.WinsOther++
+		}
+		if winner == h.StreakHolder {
+			h.Streak++
+		} else if winner == a.ID || winner == b.ID {
+			h.StreakHolder = winner
+			h.Streak = 1
+		} else {
+			h.StreakHolder = 0
+			h.Streak = 0
+		}
+		h.Flow = append(h.Flow, FlowPoint{
+			RoundID: r.ID,
+			GameID:  r.GameID,
+			Played:  playedAt(r),
+			Delta:   delta,
+			Total:   h.Net,
+		})
+	}
+	for _, rg := range records {
+		h.Games = append(h.Games, *rg)
+	}
+	sort.Slice(h.Games, func(i, j int) bool {
+		if h.Games[i].Rounds == h.Games[j].Rounds {
+			return h.Games[i].GameID < h.Games[j].GameID
+		}
+		return h.Games[i].Rounds > h.Games[j].Rounds
+	})
+	return h
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+func TestRivalry(t *testing.T) {
+	all := []db.ID{1, 2, 3}
+	rounds := newRounds(
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 1, session: 1, users: all, winner: 3, wager: 100},
+		roundSpec{game: 2, session: 2, users: []db.ID{1, 2}, winner: 2, wager: 80},
+		roundSpec{game: 2, session: 2, users: []db.ID{1, 2}, winner: 2, wager: 40},
+		roundSpec{game: 2, session: 3, users: []db.ID{1, 3}, winner: 1, wager: 500},
+	)
+
+	t.Run("only counts rounds both played", func(t *testing.T) {
+		got := Rivalry(testUsers[0], testUsers[1], rounds, testGames)
+		assertInt(t, "rounds", got.Rounds, 4)
+		assertInt(t, "wins a", got.WinsA, 1)
+		assertInt(t, "wins b", got.WinsB, 2)
+		assertInt(t, "wins other", got.WinsOther, 1)
+	})
+
+	t.Run("tracks money flowed between them", func(t *testing.T) {
+		got := Rivalry(testUsers[0], testUsers[1], rounds, testGames)
+		assertInt(t, "net", got.Net, 50-80-40)
+		assertInt(t, "flow points", len(got.Flow), 4)
+		assertInt(t, "first total", got.Flow[0].Total, 50)
+		assertInt(t, "second delta", got.Flow[1].Delta, 0)
+		assertInt(t, "last total", got.Flow[3].Total, got.Net)
+	})
+
+	t.Run("tracks current streak", func(t *testing.T) {
+		got := Rivalry(testUsers[0], testUsers[1], rounds, testGames)
+		assertInt(t, "streak", got.Streak, 2)
+		assertInt(t, "streak holder", int(got.StreakHolder), 2)
+	})
+
+	t.Run("breaks down per game", func(t *testing.T) {
+		got := Rivalry(testUsers[0], testUsers[1], rounds, testGames)
+		assertInt(t, "games", len(got.Games), 2)
+		assertInt(t, "fifa net", got.Games[1].Net+got.Games[0].Net, got.Net)
+	})
+}
@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type LeaderboardSort string
+
+const (
+	SortNet     LeaderboardSort = "net"
+	SortWins    LeaderboardSort = "wins"
+	SortWinRate LeaderboardSort = "win-rate"
+	SortWager   LeaderboardSort = "wager"
+)
+
+var LeaderboardSorts = []LeaderboardSort{SortNet, SortWins, SortWinRate, SortWager}
+
+// ParseLeaderboardSort is SortNet for an empty s.
+func ParseLeaderboardSort(s string) (LeaderboardSort, error) {
+	if s == "" {
+		return SortNet, nil
+	}
+	names := make([]string, len(LeaderboardSorts))
+	for i, ls := range LeaderboardSorts {
+		if string(ls) == s {
+			return ls, nil
+		}
+		names[i] = string(ls)
+	}
+	return SortNet, fmt.Errorf("'sort' must be one of %s", strings.Join(names, ", "))
+}
+
+type LeaderboardEntry struct {
+	Rank         int     `json:"rank"`
+	UserID       db.ID   `json:"userId"`
+	Name         string  `json:"name"`
+	Rounds       int     `json:"rounds"`
+	Wins         int     `json:"wins"`
+	Net          int     `json:"net"`
+	WinRate      float64 `json:"winRate"`
+	Wagered      int     `json:"wagered"`
+	AverageWager float64 `json:"averageWager"`
+}
+
+func (l LeaderboardEntry) less(o LeaderboardEntry, by LeaderboardSort) bool {
+	switch by {
+	case SortWins:
+		if l.Wins != o.Wins {
+			return l.Wins > o.Wins
+		}
+	case SortWinRate:
+		if l.WinRate != o.WinRate {
+			return l.WinRate > o.WinRate
+		}
+	case SortWager:
+		if l.AverageWager != o.AverageWager {
+			return l.AverageWager > o.AverageWager
+		}
+	}
+	if l.Net != o.Net {
+		return l.Net > o.Net
+	}
+	return l.UserID < o.UserID
+}
+
+// Leaderboard ranks every user that played at least one of the rounds.
+func Leaderboard(
+	rounds []services.HistoryRound, usrs []services.User, by LeaderboardSort,
+) []LeaderboardEntry {
+	entries := map[db.ID]*LeaderboardEntry{}
+	for _, r := range rounds {
+		winner, ok := r.Result.Winner()
+		if !ok {
+			continue
+		}
+		for id := range r.Result {
+			e, ok := entries[id]
+			if !ok {
+				e = &LeaderboardEntry{UserID: id, Name: nameFromID(id, usrs)}
+				entries[id] = e
+			}
+			e.Rounds++
+			e.Wagered += r.Wager
+			e.Net += r.Result.Net(id)
+			if id == winner {
+				e.Wins++
+			}
+		}
+	}
+	lb := make([]LeaderboardEntry, 0, len(entries))
+	for _, e := range entries {
+		e.WinRate = rate(e.Wins, e.Rounds)
+		if e.Rounds > 0 {
+			e.AverageWager = float64(e.Wagered) / float64(e.Rounds)
+		}
+		lb = append(lb, *e)
+	}
+	sort.Slice(lb, func(i, j int) bool {
+		return lb[i].less(lb[j], by)
+	})
+	for i := range lb {
+		lb[i].Rank = i + 1
+	}
+	return lb
+}
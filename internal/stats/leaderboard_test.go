@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+func TestLeaderboard(t *testing.T) {
+	all := []db.ID{1, 2, 3}
+	rounds := newRounds(
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 1, session: 1, users: all, winner: 2, wager: 400},
+		roundSpec{game: 2, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 2, session: 2, users: []db.ID{2, 3}, winner: 3, wager: 50},
+	)
+
+	t.Run("ranks by net by default", func(t *testing.T) {
+		by, err := ParseLeaderboardSort("")
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		got := Leaderboard(rounds, testUsers, by)
+		assertInt(t, "entries", len(got), 3)
+		assertInt(t, "first", int(got[0].UserID), 2)
+		assertInt(t, "first net", got[0].Net, 400-50-50-50)
+		assertInt(t, "first rank", got[0].Rank, 1)
+		assertInt(t, "last", int(got[2].UserID), 3)
+	})
+
+	t.Run("refuses unknown sorts", func(t *testing.T) {
+		by, err := ParseLeaderboardSort("win-rate")
+		if err != nil || by != SortWinRate {
+			t.Errorf("got %q, %v want %q", by, err, SortWinRate)
+		}
+		if _, err = ParseLeaderboardSort("losses"); err == nil {
+			t.Error("got no error for an unknown sort")
+		}
+	})
+
+	t.Run("can rank by wins", func(t *testing.T) {
+		got := Leaderboard(rounds, testUsers, SortWins)
+		assertInt(t, "first", int(got[0].UserID), 1)
+		assertInt(t, "first wins", got[0].Wins, 2)
+	})
+
+	t.Run("can rank by win rate", func(t *testing.T) {
+		got := Leaderboard(rounds, testUsers, SortWinRate)
+		assertInt(t, "first", int(got[0].UserID), 1)
+		if got[0].WinRate < 0.66 || got[0].WinRate > 0.67 {
+			t.Errorf("got win rate %f want 2/3", got[0].WinRate)
+		}
+	})
+
+	t.Run("can rank by average wager", func(t *testing.T) {
+		got := Leaderboard(rounds, testUsers, SortWager)
+		assertInt(t, "first", int(got[0].UserID), 1)
+		assertInt(t, "last", int(got[2].UserID), 3)
+		if got[2].AverageWager != 650.0/4 {
+			t.Errorf("got average wager %f want %f", got[2].AverageWager, 650.0/4)
+		}
+	})
+}
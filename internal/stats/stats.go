@@ -0,0 +1,42 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type nameable interface {
+	ResultID() db.ID
+	ResultName() string
+}
+
+func nameFromID[T nameable](id db.ID, n []T) string {
+	for _, e := range n {
+		if e.ResultID() == id {
+			return e.ResultName()
+		}
+	}
+	return ""
+}
+
+func participated(r services.HistoryRound, id db.ID) bool {
+	return r.Result.Exists(id)
+}
+
+// playedAt is the best known time of a round,
+// as rounds are only timestamped through their game session.
+func playedAt(r services.HistoryRound) time.Time {
+	if r.Ended != nil {
+		return *r.Ended
+	}
+	return r.Started
+}
+
+func rate(n int, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+var testUsers = []services.User{
+	{ID: 1, Name: "miles"},
+	{ID: 2, Name: "bill"},
+	{ID: 3, Name: "jane"},
+}
+
+var testGames = []services.Game{
+	{ID: 1, Name: "Golf"},
+	{ID: 2, Name: "Fifa"},
+}
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type roundSpec struct {
+	game    db.ID
+	session db.ID
+	users   []db.ID
+	winner  db.ID
+	wager   int
+}
+
+// newRounds creates ended rounds, one game session per round, an hour apart.
+func newRounds(specs ...roundSpec) []services.HistoryRound {
+	rounds := []services.HistoryRound{}
+	for i, s := range specs {
+		usrs := []services.User{}
+		for _, id := range s.users {
+			usrs = append(usrs, services.User{ID: id})
+		}
+		rm := result.New(usrs)
+		rm.AddWinner(s.winner, s.wager)
+		started := epoch.Add(time.Duration(i) * time.Hour)
+		rounds = append(rounds, services.HistoryRound{
+			ID:            db.ID(i + 1),
+			GameSessionID: db.ID(i + 1),
+			SessionID:     s.session,
+			GameID:        s.game,
+			Round:         1,
+			Wager:         s.wager,
+			Result:        rm,
+			Started:       started,
+			Ended:         services.GetPtr(started.Add(30 * time.Minute)),
+		})
+	}
+	return rounds
+}
+
+func assertInt(t testing.TB, name string, got int, expected int) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("%s: got %d want %d", name, got, expected)
+	}
+}
@@ -0,0 +1,141 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+	"github.com/lindeneg/wager/internal/services"
+)
+
+type GameRecord struct {
+	GameID db.ID  `json:"gameId"`
+	Name   string `json:"name"`
+	Rounds int    `json:"rounds"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Won    int    `json:"won"`
+	Lost   int    `json:"lost"`
+	Net    int    `json:"net"`
+}
+
+type Activity struct {
+	RoundID       db.ID     `json:"roundId"`
+	GameSessionID db.ID     `json:"gameSessionId"`
+	SessionID     db.ID     `json:"sessionId"`
+	GameID        db.ID     `json:"gameId"`
+	Game          string    `json:"game"`
+	Round         int       `json:"round"`
+	Wager         int       `json:"wager"`
+	Won           bool      `json:"won"`
+	Amount        int       `json:"amount"`
+	Played        time.Time `json:"played"`
+}
+
+type UserStats struct {
+	UserID         db.ID        `json:"userId"`
+	Name           string       `json:"name"`
+	Balance        int          `json:"balance"`
+	SessionsPlayed int          `json:"sessionsPlayed"`
+	Rounds         int          `json:"rounds"`
+	Wins           int          `json:"wins"`
+	Losses         int          `json:"losses"`
+	Won            int          `json:"won"`
+	Lost           int          `json:"lost"`
+	WinRate        float64      `json:"winRate"`
+	BiggestWin     *Activity    `json:"biggestWin"`
+	LongestStreak  int          `json:"longestStreak"`
+	CurrentStreak  int          `json:"currentStreak"`
+	Games          []GameRecord `json:"games"`
+	Recent         []Activity   `json:"recent"`
+}
+
+// ForUser derives the statistics of usr from the chronologically ordered rounds.
+// CurrentStreak is positive for consecutive wins and negative for consecutive losses.
+func ForUser(
+	usr services.User, rounds []services.HistoryRound, games []services.Game,
+	ledger result.ResultMap, sessions int, recent int,
+) UserStats {
+	us := UserStats{
+		UserID:         usr.ID,
+		Name:           usr.Name,
+		Balance:        ledger.Net(usr.ID),
+		SessionsPlayed: sessions,
+		Games:          []GameRecord{},
+		Recent:         []Activity{},
+	}
+	records := map[db.ID]*GameRecord{}
+	activity := []Activity{}
+	streak := 0
+	for _, r := range rounds {
+		if !participated(r, usr.ID) {
+			continue
+		}
+		winner, ok := r.Result.Winner()
+		if !ok {
+			continue
+		}
+		gr, ok := records[r.GameID]
+		if !ok {
+			gr = &GameRecord{GameID: r.GameID, Name: nameFromID(r.GameID, games)}
+			records[r.GameID] = gr
+		}
+		a := Activity{
+			RoundID:       r.ID,
+			GameSessionID: r.GameSessionID,
+			SessionID:     r.SessionID,
+			GameID:        r.GameID,
+			Game:          gr.Name,
+			Round:         r.Round,
+			Wager:         r.Wager,
+			Won:           winner == usr.ID,
+			Amount:        r.Result.Net(usr.ID),
+			Played:        playedAt(r),
+		}
+		us.Rounds++
+		gr.Rounds++
+		gr.Net += a.Amount
+		if a.Won {
+			us.Wins++
+			us.Won += a.Amount
+			gr.Wins++
+			gr.Won += a.Amount
+			if us.BiggestWin == nil || a.Amount > us.BiggestWin.Amount {
+				us.BiggestWin = services.GetPtr(a)
+			}
+			if streak < 0 {
+				streak = 0
+			}
+			streak++
+		} else {
+			us.Losses++
+			us.Lost -= a.Amount
+			gr.Losses++
+			gr.Lost -= a.Amount
+			if streak > 0 {
+				streak = 0
+			}
+			streak--
+		}
+		if streak > us.LongestStreak {
+			us.LongestStreak = streak
+		}
+		activity = append(activity, a)
+	}
+	us.CurrentStreak = streak
+	us.WinRate = rate(us.Wins, us.Rounds)
+	for _, gr := range records {
+		us.Games = append(us.Games, *gr)
+	}
+	sort.Slice(us.Games, func(i, j int) bool {
+		if us.Games[i].Rounds == us.Games[j].Rounds {
+			return us.Games[i].GameID < us.Games[j].GameID
+		}
+		return us.Games[i].Rounds > us.Games[j].Rounds
+	})
+	for i := len(activity) - 1; i >= 0 && len(us.Recent) < recent; i-- {
+		us.Recent = append(us.Recent, activity[i])
+	}
+	return us
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/lindeneg/wager/internal/db"
+	"github.com/lindeneg/wager/internal/result"
+)
+
+func TestForUser(t *testing.T) {
+	all := []db.ID{1, 2, 3}
+	rounds := newRounds(
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 100},
+		roundSpec{game: 1, session: 1, users: all, winner: 1, wager: 200},
+		roundSpec{game: 2, session: 1, users: all, winner: 2, wager: 100},
+		roundSpec{game: 2, session: 2, users: []db.ID{2, 3}, winner: 3, wager: 50},
+		roundSpec{game: 2, session: 3, users: []db.ID{1, 2}, winner: 1, wager: 80},
+	)
+	ledger := result.Merge(testUsers, rounds...)
+
+	t.Run("can count wins, losses and amounts", func(t *testing.T) {
+		got := ForUser(testUsers[0], rounds, testGames, ledger, 2, 10)
+		assertInt(t, "rounds", got.Rounds, 4)
+		assertInt(t, "wins", got.Wins, 3)
+		assertInt(t, "losses", got.Losses, 1)
+		assertInt(t, "won", got.Won, 100+200+80)
+		assertInt(t, "lost", got.Lost, 50)
+		assertInt(t, "balance", got.Balance, 100+200+80-50)
+		assertInt(t, "sessions", got.SessionsPlayed, 2)
+		if got.BiggestWin == nil || got.BiggestWin.Amount != 200 {
+			t.Errorf("expected biggest win of 200, got %+v", got.BiggestWin)
+		}
+	})
+
+	t.Run("can track streaks", func(t *testing.T) {
+		got := ForUser(testUsers[0], rounds, testGames, ledger, 2, 10)
+		assertInt(t, "longest streak", got.LongestStreak, 2)
+		assertInt(t, "current streak", got.CurrentStreak, 1)
+		got = ForUser(testUsers[1], rounds, testGames, ledger, 3, 10)
+		assertInt(t, "current streak", got.CurrentStreak, -2)
+	})
+
+	t.Run("can break down per game", func(t *testing.T) {
+		got := ForUser(testUsers[0], rounds, testGames, ledger, 2, 10)
+		assertInt(t, "games", len(got.Games), 2)
+		golf := got.Games[0]
+		if golf.Name != "Golf" {
+			golf = got.Games[1]
+		}
+		assertInt(t, "golf wins", golf.Wins, 2)
+		assertInt(t, "golf net", golf.Net, 300)
+	})
+
+	t.Run("lists most recent activity first", func(t *testing.T) {
+		got := ForUser(testUsers[0], rounds, testGames, ledger, 2, 2)
+		assertInt(t, "recent", len(got.Recent), 2)
+		assertInt(t, "most recent round", int(got.Recent[0].RoundID), 5)
+	})
+}
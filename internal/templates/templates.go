@@ -3,22 +3,26 @@ package templates
 import (
 	"embed"
 	"strings"
+	"time"
 
+	"github.com/lindeneg/wager/internal/chart"
 	"github.com/lindeneg/wager/internal/db"
 	"github.com/lindeneg/wager/internal/result"
 	"github.com/lindeneg/wager/internal/services"
+	"github.com/lindeneg/wager/internal/stats"
 )
 
 //go:embed *.gohtml
 var FS embed.FS
 
 type ResultBox struct {
-	ID        db.ID
-	Name      string
-	TotalOwe  int
-	TotalOwed int
-	Owe       map[string]int
-	Owed      map[string]int
+	ID          db.ID
+	Name        string
+	Deactivated bool
+	TotalOwe    int
+	TotalOwed   int
+	Owe         map[string]int
+	Owed        map[string]int
 }
 
 func NewResultBoxes(r result.ResultMap, u []services.User) []ResultBox {
@@ -29,12 +33,28 @@ func NewResultBoxes(r result.ResultMap, u []services.User) []ResultBox {
 	return rb
 }
 
+func NewBalanceChart(bh stats.BalanceHistory, width int, height int) chart.Line {
+	l := chart.Line{Width: width, Height: height}
+	for _, p := range bh.Points {
+		l.Labels = append(l.Labels, p.Time.Local().Format("2006-01-02"))
+	}
+	for _, usr := range bh.Users {
+		s := chart.Series{Name: usr.Name}
+		for _, p := range bh.Points {
+			s.Values = append(s.Values, float64(p.Balances[usr.ID]))
+		}
+		l.Series = append(l.Series, s)
+	}
+	return l
+}
+
 var SessionCols = []string{"id", "users", "sessions", "started", "ended", "duration"}
 var GameSessionCols = []string{"id", "game", "rounds", "started", "ended", "duration"}
 
 type SessionRow map[string]any
 
 func NewSessionRows(sessions []services.SessionWithGames, usrs []services.User) []SessionRow {
+	now := services.NewTime()
 	return newRows(sessions, func(s services.SessionWithGames) SessionRow {
 		return SessionRow{
 			"id":       s.ID,
@@ -42,12 +62,14 @@ func NewSessionRows(sessions []services.SessionWithGames, usrs []services.User)
 			"sessions": len(s.GameSessions),
 			"started":  s.Started,
 			"ended":    s.Ended,
-			"duration": 0,
+			"duration": stats.Elapsed(s.Started, s.Ended, now),
+			"live":     LiveSince(s.Started, s.Ended),
 		}
 	})
 }
 
 func NewGameSessionRows(sessions []services.GameSession, games []services.Game) []SessionRow {
+	now := services.NewTime()
 	return newRows(sessions, func(s services.GameSession) SessionRow {
 		return SessionRow{
 			"id":         s.ID,
@@ -57,11 +79,21 @@ func NewGameSessionRows(sessions []services.GameSession, games []services.Game)
 			"started":    s.Started,
 			"result":     s.Result,
 			"ended":      s.Ended,
-			"duration":   0,
+			"duration":   stats.Elapsed(s.Started, s.Ended, now),
+			"live":       LiveSince(s.Started, s.Ended),
 		}
 	})
 }
 
+// LiveSince is the start of an active session, which the
+// client keeps counting the duration from.
+func LiveSince(started time.Time, ended *time.Time) string {
+	if ended != nil {
+		return ""
+	}
+	return services.FormatTime(started)
+}
+
 func newRows[T any](t []T, cb func(T) SessionRow) []SessionRow {
 	srs := []SessionRow{}
 	var active SessionRow = nil
@@ -106,12 +138,13 @@ func userIDsToNames(ids services.Users, usrs []services.User) string {
 
 func newResultBox(r result.ResultMap, u []services.User, usr services.User) ResultBox {
 	rb := ResultBox{
-		ID:        usr.ID,
-		Name:      usr.Name,
-		TotalOwe:  0,
-		TotalOwed: 0,
-		Owe:       map[string]int{},
-		Owed:      map[string]int{},
+		ID:          usr.ID,
+		Name:        usr.Name,
+		Deactivated: usr.Deactivated != nil,
+		TotalOwe:    0,
+		TotalOwed:   0,
+		Owe:         map[string]int{},
+		Owed:        map[string]int{},
 	}
 Outer:
 	for id, owe := range r {
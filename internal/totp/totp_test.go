@@ -0,0 +1,104 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6238#appendix-B
+var rfcKey = []byte("12345678901234567890")
+
+func TestGenerate(t *testing.T) {
+	t.Run("matches rfc 6238 sha1 vectors", func(t *testing.T) {
+		vectors := []struct {
+			unix int64
+			want string
+		}{
+			{59, "94287082"},
+			{1111111109, "07081804"},
+			{1111111111, "14050471"},
+			{1234567890, "89005924"},
+			{2000000000, "69279037"},
+			{20000000000, "65353130"},
+		}
+		for _, v := range vectors {
+			got := generate(rfcKey, uint64(v.unix/Period), 8)
+			assertCorrectCode(t, got, v.want)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	secret := encoding.EncodeToString(rfcKey)
+	now := time.Unix(1111111109, 0)
+
+	t.Run("accepts current code", func(t *testing.T) {
+		code, err := Code(secret, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertCorrectCode(t, code, "081804")
+		step, ok := Verify(secret, code, now)
+		if !ok {
+			t.Errorf("expected code %q to verify", code)
+		}
+		if step != Step(now) {
+			t.Errorf("got step %d want %d", step, Step(now))
+		}
+	})
+
+	t.Run("accepts code within skew", func(t *testing.T) {
+		code, _ := Code(secret, now.Add(-Period*time.Second))
+		if _, ok := Verify(secret, code, now); !ok {
+			t.Errorf("expected previous code %q to verify", code)
+		}
+	})
+
+	t.Run("rejects code outside skew", func(t *testing.T) {
+		code, _ := Code(secret, now.Add(-3*Period*time.Second))
+		if _, ok := Verify(secret, code, now); ok {
+			t.Errorf("expected old code %q to be rejected", code)
+		}
+	})
+
+	t.Run("rejects malformed code", func(t *testing.T) {
+		if _, ok := Verify(secret, "12345", now); ok {
+			t.Error("expected short code to be rejected")
+		}
+	})
+}
+
+func TestURI(t *testing.T) {
+	t.Run("creates otpauth uri", func(t *testing.T) {
+		got := URI("Bankmanden", "bob", "ABC")
+		want := "otpauth://totp/Bankmanden:bob?algorithm=SHA1&digits=6&issuer=Bankmanden&period=30&secret=ABC"
+		assertCorrectCode(t, got, want)
+	})
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	t.Run("creates unique codes", func(t *testing.T) {
+		codes, err := NewRecoveryCodes(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for _, c := range codes {
+			if len(c) != 11 || !strings.Contains(c, "-") {
+				t.Errorf("unexpected code format %q", c)
+			}
+			if seen[c] {
+				t.Errorf("duplicate code %q", c)
+			}
+			seen[c] = true
+		}
+	})
+}
+
+func assertCorrectCode(t testing.TB, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lindeneg/wager/internal/db"
+)
+
+const (
+	SessionStarted  = "session.started"
+	SessionEnded    = "session.ended"
+	RoundEnded      = "round.ended"
+	PaymentRecorded = "payment.recorded"
+)
+
+// Events are the events webhooks can subscribe to.
+var Events = []string{SessionStarted, SessionEnded, RoundEnded, PaymentRecorded}
+
+const (
+	EventHeader     = "X-Wager-Event"
+	DeliveryHeader  = "X-Wager-Delivery"
+	SignatureHeader = "X-Wager-Signature"
+)
+
+// QueueSize is the number of deliveries that can wait for a worker
+// before further events are dropped.
+const QueueSize = 256
+
+// ErrForbiddenAddress is returned for targets on addresses webhooks must not reach.
+var ErrForbiddenAddress = errors.New("address is private, loopback or link-local")
+
+func IsEvent(name string) bool {
+	for _, e := range Events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+type Subscription struct {
+	ID     db.ID
+	URL    string
+	Secret string
+}
+
+// Attempt is a single delivery attempt of an event to a subscription.
+type Attempt struct {
+	WebhookID db.ID
+	EventID   string
+	Event     string
+	Payload   string
+	Attempt   int
+	Status    int
+	Error     string
+	Delivered time.Time
+}
+
+// Store finds the subscriptions of events and keeps the delivery log.
+type Store interface {
+	Subscribers(event string) ([]Subscription, error)
+	Record(a Attempt) error
+}
+
+// Payload is the json body posted to subscribers.
+type Payload struct {
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	Created time.Time `json:"created"`
+	Data    any       `json:"data"`
+}
+
+// Dispatcher delivers events to their subscriptions in the background,
+// retrying failed deliveries with backoff until MaxAttempts is reached.
+type Dispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+	store       Store
+	queue       chan job
+	done        chan struct{}
+	stop        sync.Once
+	wg          sync.WaitGroup
+}
+
+type job struct {
+	id      string
+	event   string
+	payload []byte
+	sub     *Subscription
+	attempt int
+}
+
+// New has a Client that refuses to connect to forbidden addresses,
+// whatever the host of a subscription resolves to when it is delivered.
+func New(store Store) *Dispatcher {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect on behalf of the dispatcher, unchecked.
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{Timeout: 5 * time.Second, Control: control}).DialContext
+	return &Dispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second, Transport: t},
+		MaxAttempts: 5,
+		Backoff:     Backoff,
+		store:       store,
+		queue:       make(chan job, QueueSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// Backoff doubles the wait from a second for every failed attempt.
+func Backoff(attempt int) time.Duration {
+	return time.Second << (attempt - 1)
+}
+
+// Start runs n workers until Stop is called.
+func (d *Dispatcher) Start(n int) {
+	for i := 0; i < n; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+// Stop stops the workers after their current delivery,
+// queued deliveries and pending retries are dropped.
+func (d *Dispatcher) Stop() {
+	d.stop.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+// Dispatch queues event with data for delivery without blocking.
+func (d *Dispatcher) Dispatch(event string, data any) {
+	p := Payload{ID: newID(), Event: event, Created: time.Now().UTC(), Data: data}
+	b, err := json.Marshal(p)
+	if err != nil {
+		fmt.Printf("ERROR [webhook] '%s'\n", err)
+		return
+	}
+	select {
+	case d.queue <- job{id: p.ID, event: event, payload: b}:
+	default:
+		fmt.Printf("ERROR [webhook] queue is full, dropped %s %s\n", event, p.ID)
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case j := <-d.queue:
+			if j.sub == nil {
+				d.fanOut(j)
+			} else {
+				d.deliver(j)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) fanOut(j job) {
+	subs, err := d.store.Subscribers(j.event)
+	if err != nil {
+		fmt.Printf("ERROR [webhook] '%s'\n", err)
+		return
+	}
+	for i := range subs {
+		j.sub = &subs[i]
+		j.attempt = 1
+		d.deliver(j)
+	}
+}
+
+func (d *Dispatcher) deliver(j job) {
+	status, err := d.post(j)
+	a := Attempt{
+		WebhookID: j.sub.ID,
+		EventID:   j.id,
+		Event:     j.event,
+		Payload:   string(j.payload),
+		Attempt:   j.attempt,
+		Status:    status,
+		Delivered: time.Now().UTC(),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if err := d.store.Record(a); err != nil {
+		fmt.Printf("ERROR [webhook] '%s'\n", err)
+	}
+	if err == nil || j.attempt >= d.MaxAttempts {
+		return
+	}
+	j.attempt++
+	time.AfterFunc(d.Backoff(j.attempt-1), func() {
+		select {
+		case <-d.done:
+		case d.queue <- j:
+		}
+	})
+}
+
+func (d *Dispatcher) post(j job) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, j.sub.URL, bytes.NewReader(j.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wager-webhook")
+	req.Header.Set(EventHeader, j.event)
+	req.Header.Set(DeliveryHeader, j.id)
+	req.Header.Set(SignatureHeader, Sign(j.sub.Secret, j.payload))
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Forbidden reports if ip is a private, loopback, link-local or
+// unspecified address, which webhooks must not reach.
+func Forbidden(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// CheckHost returns ErrForbiddenAddress if host is, or resolves to, a forbidden address.
+func CheckHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if Forbidden(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if Forbidden(a.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// control runs before every connection of the dispatcher,
+// after the host has been resolved to address.
+func control(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || Forbidden(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Sign is the signature of body sent in the SignatureHeader,
+// the hex encoded HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports if signature is the signature of body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret is a random secret for signing deliveries.
+func NewSecret() string {
+	return newID() + newID()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testStore struct {
+	subs     map[string][]Subscription
+	recorded chan Attempt
+}
+
+func newTestStore(subs map[string][]Subscription) *testStore {
+	return &testStore{subs: subs, recorded: make(chan Attempt, 64)}
+}
+
+func (s *testStore) Subscribers(event string) ([]Subscription, error) {
+	return s.subs[event], nil
+}
+
+func (s *testStore) Record(a Attempt) error {
+	s.recorded <- a
+	return nil
+}
+
+func (s *testStore) wait(t testing.TB, n int) []Attempt {
+	t.Helper()
+	as := make([]Attempt, 0, n)
+	for len(as) < n {
+		select {
+		case a := <-s.recorded:
+			as = append(as, a)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d attempts want %d", len(as), n)
+		}
+	}
+	return as
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func receiver(t testing.TB, statuses ...int) (*httptest.Server, chan received) {
+	var calls atomic.Int32
+	ch := make(chan received, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		ch <- received{r.Header, b}
+		i := int(calls.Add(1)) - 1
+		if i < len(statuses) {
+			w.WriteHeader(statuses[i])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func newTestDispatcher(t testing.TB, s Store, backoff func(int) time.Duration) *Dispatcher {
+	d := New(s)
+	// The receivers listen on loopback, which the client of New refuses.
+	d.Client = &http.Client{Timeout: time.Second}
+	d.MaxAttempts = 3
+	d.Backoff = backoff
+	d.Start(2)
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func noBackoff(int) time.Duration {
+	return time.Millisecond
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("posts signed events to subscribers", func(t *testing.T) {
+		srv, ch := receiver(t)
+		s := newTestStore(map[string][]Subscription{
+			RoundEnded: {{ID: 1, URL: srv.URL, Secret: "secret"}},
+		})
+		d := newTestDispatcher(t, s, noBackoff)
+		d.Dispatch(RoundEnded, map[string]int{"winnerId": 2})
+		r := <-ch
+		if !Verify("secret", r.body, r.header.Get(SignatureHeader)) {
+			t.Errorf("got invalid signature %q", r.header.Get(SignatureHeader))
+		}
+		assertString(t, r.header.Get(EventHeader), RoundEnded)
+		var p struct {
+			ID    string         `json:"id"`
+			Event string         `json:"event"`
+			Data  map[string]int `json:"data"`
+		}
+		if err := json.Unmarshal(r.body, &p); err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		assertString(t, p.Event, RoundEnded)
+		assertString(t, r.header.Get(DeliveryHeader), p.ID)
+		assertInt(t, p.Data["winnerId"], 2)
+		a := s.wait(t, 1)[0]
+		assertInt(t, a.Status, http.StatusOK)
+		assertInt(t, a.Attempt, 1)
+		assertString(t, a.Error, "")
+		assertString(t, a.Payload, string(r.body))
+	})
+
+	t.Run("only delivers to subscribers of the event", func(t *testing.T) {
+		srv, ch := receiver(t)
+		s := newTestStore(map[string][]Subscription{
+			SessionEnded: {{ID: 1, URL: srv.URL}},
+		})
+		d := newTestDispatcher(t, s, noBackoff)
+		d.Dispatch(SessionStarted, nil)
+		d.Dispatch(SessionEnded, nil)
+		r := <-ch
+		assertString(t, r.header.Get(EventHeader), SessionEnded)
+		s.wait(t, 1)
+		assertInt(t, len(ch), 0)
+	})
+
+	t.Run("retries failed deliveries with backoff", func(t *testing.T) {
+		srv, _ := receiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+		s := newTestStore(map[string][]Subscription{
+			PaymentRecorded: {{ID: 3, URL: srv.URL}},
+		})
+		var waits []int
+		var mu sync.Mutex
+		d := newTestDispatcher(t, s, func(attempt int) time.Duration {
+			mu.Lock()
+			defer mu.Unlock()
+			waits = append(waits, attempt)
+			return time.Millisecond
+		})
+		d.Dispatch(PaymentRecorded, nil)
+		as := s.wait(t, 3)
+		for i, status := range []int{500, 502, 204} {
+			assertInt(t, as[i].Attempt, i+1)
+			assertInt(t, as[i].Status, status)
+			assertString(t, as[i].EventID, as[0].EventID)
+		}
+		assertString(t, as[0].Error, "unexpected status 500")
+		assertString(t, as[2].Error, "")
+		mu.Lock()
+		defer mu.Unlock()
+		assertInt(t, len(waits), 2)
+		assertInt(t, waits[1], 2)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		s := newTestStore(map[string][]Subscription{
+			SessionStarted: {{ID: 1, URL: "http://127.0.0.1:1"}},
+		})
+		d := newTestDispatcher(t, s, noBackoff)
+		d.Dispatch(SessionStarted, nil)
+		as := s.wait(t, 3)
+		assertInt(t, as[2].Attempt, 3)
+		assertInt(t, as[2].Status, 0)
+		if as[2].Error == "" {
+			t.Error("got no error")
+		}
+		select {
+		case a := <-s.recorded:
+			t.Errorf("got attempt %d after giving up", a.Attempt)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestForbidden(t *testing.T) {
+	t.Run("refuses to deliver to forbidden addresses", func(t *testing.T) {
+		srv, ch := receiver(t)
+		s := newTestStore(map[string][]Subscription{
+			RoundEnded: {{ID: 1, URL: srv.URL}},
+		})
+		d := New(s)
+		d.MaxAttempts = 1
+		d.Start(1)
+		t.Cleanup(d.Stop)
+		d.Dispatch(RoundEnded, nil)
+		a := s.wait(t, 1)[0]
+		assertInt(t, a.Status, 0)
+		if !strings.Contains(a.Error, ErrForbiddenAddress.Error()) {
+			t.Errorf("got error %q", a.Error)
+		}
+		assertInt(t, len(ch), 0)
+	})
+
+	t.Run("refuses private, loopback and link-local hosts", func(t *testing.T) {
+		for _, host := range []string{
+			"127.0.0.1", "10.0.0.8", "172.16.4.1", "192.168.1.1", "169.254.169.254",
+			"0.0.0.0", "::1", "fc00::1", "fe80::1", "::ffff:127.0.0.1", "localhost", "api.localhost",
+		} {
+			if err := CheckHost(context.Background(), host); !errors.Is(err, ErrForbiddenAddress) {
+				t.Errorf("%s: got error %v want %v", host, err, ErrForbiddenAddress)
+			}
+		}
+	})
+
+	t.Run("allows public hosts", func(t *testing.T) {
+		for _, host := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+			if err := CheckHost(context.Background(), host); err != nil {
+				t.Errorf("%s: got error %v", host, err)
+			}
+		}
+	})
+}
+
+func TestSign(t *testing.T) {
+	t.Run("signs with the secret", func(t *testing.T) {
+		body := []byte(`{"event":"round.ended"}`)
+		sig := Sign("a", body)
+		if !Verify("a", body, sig) {
+			t.Error("got invalid signature")
+		}
+		if Verify("b", body, sig) || Verify("a", []byte(`{}`), sig) {
+			t.Error("got valid signature")
+		}
+	})
+
+	t.Run("doubles the backoff", func(t *testing.T) {
+		assertInt(t, int(Backoff(1)/time.Second), 1)
+		assertInt(t, int(Backoff(4)/time.Second), 8)
+	})
+}
+
+func assertString(t testing.TB, got string, expected string) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
+
+func assertInt(t testing.TB, got int, expected int) {
+	t.Helper()
+	if got != expected {
+		t.Errorf("got %d want %d", got, expected)
+	}
+}
@@ -1,8 +1,15 @@
+DROP TABLE IF EXISTS migration;
+DROP TABLE IF EXISTS idempotency_key;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook;
+DROP TABLE IF EXISTS rating;
 DROP TABLE IF EXISTS game_session_round;
 DROP TABLE IF EXISTS game_session;
 DROP TABLE IF EXISTS session_participant;
 DROP TABLE IF EXISTS session;
 DROP TABLE IF EXISTS event;
+DROP TABLE IF EXISTS recovery_code;
+DROP TABLE IF EXISTS user_totp;
 DROP TABLE IF EXISTS user;
 DROP TABLE IF EXISTS game;
 DROP TABLE IF EXISTS result;
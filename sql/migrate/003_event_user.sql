@@ -0,0 +1,14 @@
+-- Failed logins with unknown usernames are events without a user.
+CREATE TABLE event_new
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER   DEFAULT NULL,
+    description TEXT      NOT NULL,
+    occured     TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user (id)
+);
+INSERT INTO event_new (id, user_id, description, occured)
+SELECT id, user_id, description, occured
+FROM event;
+DROP TABLE event;
+ALTER TABLE event_new RENAME TO event;
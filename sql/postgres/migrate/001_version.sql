@@ -0,0 +1,4 @@
+-- Sessions, game sessions and rounds are versioned for If-Match.
+ALTER TABLE session ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE game_session ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE game_session_round ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- Deactivated users keep their history but cannot sign in.
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS deactivated TIMESTAMPTZ DEFAULT NULL;
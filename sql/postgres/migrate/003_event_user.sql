@@ -0,0 +1,2 @@
+-- Failed logins with unknown usernames are events without a user.
+ALTER TABLE event ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,132 @@
+CREATE TABLE IF NOT EXISTS "user"
+(
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    password    TEXT NOT NULL,
+    deactivated TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS game
+(
+    id   SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS session
+(
+    id      SERIAL PRIMARY KEY,
+    result  TEXT        NOT NULL,
+    started TIMESTAMPTZ NOT NULL,
+    ended   TIMESTAMPTZ DEFAULT NULL,
+    version INTEGER     NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS session_participant
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES "user" (id),
+    session_id INTEGER NOT NULL REFERENCES session (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS game_session
+(
+    id         SERIAL PRIMARY KEY,
+    session_id INTEGER     NOT NULL REFERENCES session (id) ON DELETE CASCADE,
+    game_id    INTEGER     NOT NULL REFERENCES game (id),
+    result     TEXT        NOT NULL,
+    started    TIMESTAMPTZ NOT NULL,
+    ended      TIMESTAMPTZ DEFAULT NULL,
+    version    INTEGER     NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS game_session_round
+(
+    id              SERIAL PRIMARY KEY,
+    game_session_id INTEGER NOT NULL REFERENCES game_session (id) ON DELETE CASCADE,
+    result          TEXT    NOT NULL,
+    round           INTEGER NOT NULL,
+    wager           INTEGER NOT NULL,
+    active          INTEGER NOT NULL DEFAULT 1,
+    version         INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS result
+(
+    id   SERIAL PRIMARY KEY,
+    data TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS event
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER     DEFAULT NULL REFERENCES "user" (id),
+    description TEXT        NOT NULL,
+    occured     TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id   INTEGER PRIMARY KEY REFERENCES "user" (id) ON DELETE CASCADE,
+    secret    TEXT    NOT NULL,
+    enabled   INTEGER NOT NULL DEFAULT 0,
+    last_step BIGINT  NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recovery_code
+(
+    id      SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+    code    TEXT    NOT NULL,
+    used    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS rating
+(
+    id                    SERIAL PRIMARY KEY,
+    user_id               INTEGER          NOT NULL REFERENCES "user" (id),
+    game_id               INTEGER          NOT NULL REFERENCES game (id),
+    game_session_round_id INTEGER          NOT NULL REFERENCES game_session_round (id) ON DELETE CASCADE,
+    rating                DOUBLE PRECISION NOT NULL,
+    delta                 DOUBLE PRECISION NOT NULL,
+    created               TIMESTAMPTZ      NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook
+(
+    id      SERIAL PRIMARY KEY,
+    url     TEXT        NOT NULL,
+    secret  TEXT        NOT NULL,
+    events  TEXT        NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id         SERIAL PRIMARY KEY,
+    webhook_id INTEGER     NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event_id   TEXT        NOT NULL,
+    event      TEXT        NOT NULL,
+    payload    TEXT        NOT NULL,
+    attempt    INTEGER     NOT NULL,
+    status     INTEGER     NOT NULL,
+    error      TEXT        NOT NULL,
+    delivered  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_key
+(
+    user_id     INTEGER     NOT NULL,
+    key         TEXT        NOT NULL,
+    fingerprint TEXT        NOT NULL,
+    status      INTEGER     NOT NULL DEFAULT 0,
+    header      TEXT        NOT NULL DEFAULT '{}',
+    body        BYTEA,
+    created     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS migration
+(
+    name    TEXT PRIMARY KEY,
+    applied TIMESTAMPTZ NOT NULL
+);
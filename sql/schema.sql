@@ -1,8 +1,9 @@
 ﻿CREATE TABLE IF NOT EXISTS user
 (
-    id       INTEGER PRIMARY KEY AUTOINCREMENT,
-    name     TEXT NOT NULL UNIQUE,
-    password TEXT NOT NULL
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT NOT NULL UNIQUE,
+    password    TEXT NOT NULL,
+    deactivated TIMESTAMP DEFAULT NULL
 );
 
 CREATE TABLE IF NOT EXISTS game
@@ -16,7 +17,8 @@ CREATE TABLE IF NOT EXISTS session
     id      INTEGER PRIMARY KEY AUTOINCREMENT,
     result  TEXT NOT NULL,
     started TIMESTAMP NOT NULL,
-    ended   TIMESTAMP DEFAULT NULL
+    ended   TIMESTAMP DEFAULT NULL,
+    version INTEGER   NOT NULL DEFAULT 1
 );
 
 CREATE TABLE IF NOT EXISTS session_participant
@@ -36,6 +38,7 @@ CREATE TABLE IF NOT EXISTS game_session
     result     TEXT      NOT NULL,
     started    TIMESTAMP NOT NULL,
     ended      TIMESTAMP DEFAULT NULL,
+    version    INTEGER   NOT NULL DEFAULT 1,
     FOREIGN KEY (session_id) REFERENCES session (id) ON DELETE CASCADE,
     FOREIGN KEY (game_id) REFERENCES game (id)
 );
@@ -48,6 +51,7 @@ CREATE TABLE IF NOT EXISTS game_session_round
     round           INT       NOT NULL,
     wager           INT       NOT NULL,
     active          INT       NOT NULL DEFAULT 1,
+    version         INTEGER   NOT NULL DEFAULT 1,
     FOREIGN KEY (game_session_id) REFERENCES game_session (id) ON DELETE CASCADE
 );
 
@@ -60,8 +64,81 @@ CREATE TABLE IF NOT EXISTS result
 CREATE TABLE IF NOT EXISTS event
 (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id     INTEGER   NOT NULL,
+    user_id     INTEGER   DEFAULT NULL,
     description TEXT      NOT NULL,
     occured     TIMESTAMP NOT NULL,
     FOREIGN KEY (user_id) REFERENCES user (id)
 );
+
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id   INTEGER PRIMARY KEY,
+    secret    TEXT NOT NULL,
+    enabled   INT  NOT NULL DEFAULT 0,
+    last_step INT  NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_code
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code    TEXT    NOT NULL,
+    used    INT     NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rating
+(
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id               INTEGER   NOT NULL,
+    game_id               INTEGER   NOT NULL,
+    game_session_round_id INTEGER   NOT NULL,
+    rating                REAL      NOT NULL,
+    delta                 REAL      NOT NULL,
+    created               TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user (id),
+    FOREIGN KEY (game_id) REFERENCES game (id),
+    FOREIGN KEY (game_session_round_id) REFERENCES game_session_round (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webhook
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    url     TEXT      NOT NULL,
+    secret  TEXT      NOT NULL,
+    events  TEXT      NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER   NOT NULL,
+    event_id   TEXT      NOT NULL,
+    event      TEXT      NOT NULL,
+    payload    TEXT      NOT NULL,
+    attempt    INT       NOT NULL,
+    status     INT       NOT NULL,
+    error      TEXT      NOT NULL,
+    delivered  TIMESTAMP NOT NULL,
+    FOREIGN KEY (webhook_id) REFERENCES webhook (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_key
+(
+    user_id     INTEGER   NOT NULL,
+    key         TEXT      NOT NULL,
+    fingerprint TEXT      NOT NULL,
+    status      INT       NOT NULL DEFAULT 0,
+    header      TEXT      NOT NULL DEFAULT '{}',
+    body        BLOB,
+    created     TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS migration
+(
+    name    TEXT PRIMARY KEY,
+    applied TIMESTAMP NOT NULL
+);